@@ -69,10 +69,20 @@ func main() {
 	openaiAPIKey := os.Getenv("OPENAI_API_KEY")
 	imageAnalysisService := services.NewImageAnalysisService(openaiAPIKey)
 
+	// Initialize ingest service (format detection, HEIC/RAW developing)
+	ingestService := services.NewImageIngestService(minioService)
+
+	// Initialize edit service (non-destructive edit stacks)
+	editService := services.NewEditService(dbService, minioService, filterService)
+
+	// Initialize batch service (background filter jobs)
+	batchService := services.NewBatchService(dbService, filterService, editService)
+
 	// Initialize handlers
-	mediaHandler := handlers.NewMediaHandler(dbService, minioService, imageAnalysisService)
+	mediaHandler := handlers.NewMediaHandler(dbService, minioService, imageAnalysisService, ingestService, editService)
 	authHandler := handlers.NewAuthHandler(authService, minioService)
-	filterHandler := handlers.NewFilterHandler(dbService.GetDatabase(), filterService, aiFilterService)
+	filterHandler := handlers.NewFilterHandler(dbService.GetDatabase(), filterService, aiFilterService, editService)
+	jobHandler := handlers.NewJobHandler(batchService)
 
 	// Create Gin router
 	router := gin.New()
@@ -97,6 +107,9 @@ func main() {
 			auth.POST("/logout", authHandler.Logout)
 		}
 
+		// Public delivery of media their owners published
+		api.GET("/public/media/:id", mediaHandler.PublicFile)
+
 		// Protected routes
 		protected := api.Group("")
 		protected.Use(middleware.AuthMiddleware(jwtService))
@@ -112,12 +125,19 @@ func main() {
 			{
 				media.POST("/upload", mediaHandler.UploadFile)
 				media.POST("/auto-suggestions", mediaHandler.GenerateAutoSuggestions)
+				media.POST("/export", mediaHandler.ExportFiles)
 				media.GET("", mediaHandler.ListFiles)  // Remove the trailing slash
 				media.GET("/", mediaHandler.ListFiles) // Keep both for compatibility
 				media.GET("/:id", mediaHandler.GetFile)
 				media.PUT("/:id", mediaHandler.UpdateFile)
 				media.DELETE("/:id", mediaHandler.DeleteFile)
 				media.GET("/:id/download", mediaHandler.DownloadFile)
+				media.POST("/:id/rotate", mediaHandler.RotateFile)
+				media.GET("/:id/edits", mediaHandler.GetEdits)
+				media.PUT("/:id/edits", mediaHandler.SaveEdits)
+				media.DELETE("/:id/edits", mediaHandler.RevertEdits)
+				media.POST("/:id/edits/export", mediaHandler.ExportEdits)
+				media.GET("/:id/render", mediaHandler.RenderFile)
 			}
 
 			// Categories endpoint (now protected)
@@ -127,7 +147,29 @@ func main() {
 			filters := protected.Group("/filters")
 			{
 				filters.GET("/presets", filterHandler.GetFilterPresets)
+				filters.GET("/presets/:id/tweaks", filterHandler.GetPresetTweaks)
+				filters.PUT("/presets/:id/tweaks", filterHandler.SavePresetTweaks)
+				filters.DELETE("/presets/:id/tweaks", filterHandler.DeletePresetTweaks)
+				filters.POST("/presets/:id/duplicate", filterHandler.DuplicatePreset)
+				filters.GET("/custom", filterHandler.ListCustomFilters)
 				filters.POST("/custom", filterHandler.CreateCustomFilter)
+				filters.GET("/custom/:id", filterHandler.GetCustomFilter)
+				filters.PUT("/custom/:id", filterHandler.UpdateCustomFilter)
+				filters.DELETE("/custom/:id", filterHandler.DeleteCustomFilter)
+				filters.GET("/custom/:id/versions", filterHandler.GetCustomFilterVersions)
+				filters.PUT("/custom/:id/visibility", filterHandler.SetFilterVisibility)
+				filters.GET("/gallery", filterHandler.ListFilterGallery)
+				filters.GET("/gallery/:id", filterHandler.GetGalleryFilter)
+				filters.POST("/gallery/:id/fork", filterHandler.ForkFilter)
+				filters.PUT("/gallery/:id/rating", filterHandler.RateFilter)
+				filters.POST("/export", filterHandler.ExportFilters)
+				filters.POST("/import", filterHandler.ImportFilters)
+				filters.POST("/batch", jobHandler.CreateBatch)
+				filters.GET("/luts", filterHandler.GetLUTs)
+				filters.POST("/luts", filterHandler.UploadLUT)
+				filters.GET("/masks", filterHandler.GetMasks)
+				filters.POST("/masks", filterHandler.UploadMask)
+				filters.GET("/encoders", filterHandler.GetImageEncoders)
 			}
 
 			// Media filter endpoints - use different base path to avoid conflict
@@ -150,6 +192,20 @@ func main() {
 				userFilters.GET("/analytics", filterHandler.GetUserFilterAnalytics)
 				userFilters.GET("/history", filterHandler.GetFilterHistory)
 				userFilters.POST("/style-profile", filterHandler.UpdateUserStyleProfile)
+				userFilters.GET("/watermark", filterHandler.GetDefaultWatermark)
+				userFilters.PUT("/watermark", filterHandler.SaveDefaultWatermark)
+				userFilters.DELETE("/watermark", filterHandler.DeleteDefaultWatermark)
+			}
+
+			// Background job progress
+			protected.GET("/jobs/:id", jobHandler.GetJob)
+
+			// Admin moderation endpoints
+			admin := protected.Group("/admin")
+			admin.Use(middleware.AdminMiddleware())
+			{
+				admin.POST("/filters/:id/unpublish", filterHandler.UnpublishFilter)
+				admin.GET("/filters/cache/stats", filterHandler.GetRenderCacheStats)
 			}
 		}
 	}
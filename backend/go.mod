@@ -11,8 +11,11 @@ require (
 	github.com/google/uuid v1.5.0
 	github.com/joho/godotenv v1.5.1
 	github.com/minio/minio-go/v7 v7.0.63
+	github.com/srwiley/oksvg v0.0.0-20221011165216-be6e8873101c
+	github.com/srwiley/rasterx v0.0.0-20220730225603-2ab79fcdd4ef
 	go.mongodb.org/mongo-driver v1.13.1
 	golang.org/x/crypto v0.42.0
+	golang.org/x/image v0.25.0
 )
 
 require (
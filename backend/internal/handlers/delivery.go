@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"mediaVault-backend/internal/middleware"
+	"mediaVault-backend/internal/models"
+	"mediaVault-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PublicFile serves a media item its owner made public, with edits applied
+// and the owner's default watermark stamped on images, SVG rasters included.
+// No authentication.
+// GET /api/v1/public/media/:id
+func (h *MediaHandler) PublicFile(c *gin.Context) {
+	mediaFile, err := h.dbService.GetMediaFileByID(c.Request.Context(), c.Param("id"))
+	if err != nil || !mediaFile.Public {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	if !services.IsImageUpload(mediaFile.MimeType, mediaFile.OriginalName) {
+		reader, err := h.minioService.GetFileContent(mediaFile.FileName)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve file content"})
+			return
+		}
+		defer reader.Close()
+
+		// Uploads are served from the app's origin, so anything that isn't an
+		// image is downloaded rather than rendered, and can't run script
+		c.Header("Content-Disposition", "attachment; filename=\""+mediaFile.OriginalName+"\"")
+		c.Header("Content-Security-Policy", services.SVGContentSecurityPolicy)
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Header("Cache-Control", "public, max-age=300")
+		c.DataFromReader(http.StatusOK, mediaFile.Size, mediaFile.MimeType, reader, nil)
+		return
+	}
+
+	delivered, err := h.editService.Deliver(c.Request.Context(), mediaFile)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render image"})
+		return
+	}
+
+	if delivered.Format == "svg" {
+		// An SVG without a raster rendition; like the media URL, never let
+		// the markup render inline
+		c.Header("Content-Disposition", "attachment; filename=\""+mediaFile.OriginalName+"\"")
+		c.Header("Content-Security-Policy", services.SVGContentSecurityPolicy)
+	}
+	// Unedited originals go out as stored, under the type the uploader sent
+	c.Header("X-Content-Type-Options", "nosniff")
+	// Short lifetime so edits, unpublishing and watermark changes show up
+	c.Header("Cache-Control", "public, max-age=300")
+	c.Data(http.StatusOK, delivered.MimeType, delivered.Data)
+}
+
+// ExportFiles streams the selected media as a ZIP archive. Images are
+// delivered with their edits and the user's default watermark.
+// POST /api/media/export
+func (h *MediaHandler) ExportFiles(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User authentication required"})
+		return
+	}
+
+	var req models.ExportMediaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Check everything up front; once the archive starts there's no way to
+	// report an error in the response
+	files := make([]*models.MediaFile, 0, len(req.IDs))
+	for _, id := range req.IDs {
+		mediaFile, err := h.dbService.GetMediaFileByID(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "File not found: " + id})
+			return
+		}
+		if mediaFile.UserID != userID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied: " + id})
+			return
+		}
+		files = append(files, mediaFile)
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"mediavault-%s.zip\"", time.Now().Format("20060102-150405")))
+	c.Status(http.StatusOK)
+
+	archive := zip.NewWriter(c.Writer)
+	names := make(map[string]int)
+	for _, mediaFile := range files {
+		if err := h.writeExportEntry(c, archive, mediaFile, names); err != nil {
+			log.Printf("ZIP export aborted at %s: %v", mediaFile.ID.Hex(), err)
+			return
+		}
+	}
+	if err := archive.Close(); err != nil {
+		log.Printf("Failed to finish ZIP export: %v", err)
+	}
+}
+
+// writeExportEntry adds one media item to the archive under a name not
+// used before
+func (h *MediaHandler) writeExportEntry(c *gin.Context, archive *zip.Writer, mediaFile *models.MediaFile, names map[string]int) error {
+	name := mediaFile.OriginalName
+	if !services.IsImageUpload(mediaFile.MimeType, mediaFile.OriginalName) {
+		reader, err := h.minioService.GetFileContent(mediaFile.FileName)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+
+		entry, err := archive.CreateHeader(&zip.FileHeader{Name: uniqueName(name, names), Method: zip.Deflate, Modified: mediaFile.UpdatedAt})
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(entry, reader)
+		return err
+	}
+
+	delivered, err := h.editService.Deliver(c.Request.Context(), mediaFile)
+	if err != nil {
+		return err
+	}
+	name = strings.TrimSuffix(name, filepath.Ext(name)) + "." + delivered.Format
+
+	// Encoded images don't compress further
+	entry, err := archive.CreateHeader(&zip.FileHeader{Name: uniqueName(name, names), Method: zip.Store, Modified: mediaFile.UpdatedAt})
+	if err != nil {
+		return err
+	}
+	_, err = entry.Write(delivered.Data)
+	return err
+}
+
+// uniqueName returns name, or name with a counter when it's already taken
+func uniqueName(name string, names map[string]int) string {
+	name = filepath.Base(name)
+	n := names[name]
+	names[name] = n + 1
+	if n == 0 {
+		return name
+	}
+	ext := filepath.Ext(name)
+	return uniqueName(fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext), names)
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"net/http"
+
+	"mediaVault-backend/internal/middleware"
+	"mediaVault-backend/internal/models"
+	"mediaVault-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetEdits returns the edit stack of a media item
+// GET /api/media/:id/edits
+func (h *MediaHandler) GetEdits(c *gin.Context) {
+	mediaFile, ok := h.ownedImage(c)
+	if !ok {
+		return
+	}
+
+	steps := []models.EditStep{}
+	if mediaFile.Edits != nil {
+		steps = mediaFile.Edits.Steps
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"mediaId": mediaFile.ID,
+		"steps":   steps,
+	})
+}
+
+// SaveEdits replaces the edit stack of a media item. The original is kept
+// untouched; an empty stack reverts to it.
+// PUT /api/media/:id/edits
+func (h *MediaHandler) SaveEdits(c *gin.Context) {
+	mediaFile, ok := h.ownedImage(c)
+	if !ok {
+		return
+	}
+
+	var req models.SaveEditsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if err := services.ValidateEditStack(req.Steps); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.editService.SaveEdits(c.Request.Context(), mediaFile, req.Steps); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save edits: " + err.Error()})
+		return
+	}
+
+	if err := h.resolveURLs(mediaFile); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate file URL"})
+		return
+	}
+
+	c.JSON(http.StatusOK, mediaFile)
+}
+
+// RevertEdits discards the edit stack, restoring the original
+// DELETE /api/media/:id/edits
+func (h *MediaHandler) RevertEdits(c *gin.Context) {
+	mediaFile, ok := h.ownedImage(c)
+	if !ok {
+		return
+	}
+
+	if err := h.editService.RevertEdits(c.Request.Context(), mediaFile); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revert edits: " + err.Error()})
+		return
+	}
+
+	if err := h.resolveURLs(mediaFile); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate file URL"})
+		return
+	}
+
+	c.JSON(http.StatusOK, mediaFile)
+}
+
+// RenderFile serves the display rendition of a media item, with its edit
+// stack applied when ?edited=1. Edited renders are cached until the stack
+// or the original changes.
+// GET /api/media/:id/render
+func (h *MediaHandler) RenderFile(c *gin.Context) {
+	mediaFile, ok := h.ownedImage(c)
+	if !ok {
+		return
+	}
+
+	target := *mediaFile
+	if c.Query("edited") != "1" {
+		target.Edits = nil
+	}
+
+	rendered, err := h.editService.Render(c.Request.Context(), &target)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render image: " + err.Error()})
+		return
+	}
+
+	if rendered.Cached {
+		c.Header("X-Render-Cache", "hit")
+	} else if target.Edits != nil {
+		c.Header("X-Render-Cache", "miss")
+	}
+	if rendered.Format == "svg" {
+		c.Header("Content-Security-Policy", services.SVGContentSecurityPolicy)
+		c.Header("X-Content-Type-Options", "nosniff")
+	}
+	c.Header("Cache-Control", "private, no-cache")
+	c.Data(http.StatusOK, rendered.MimeType, rendered.Data)
+}
+
+// ExportEdits saves the edited result as a new media item, leaving the
+// source and its edit stack as they are
+// POST /api/media/:id/edits/export
+func (h *MediaHandler) ExportEdits(c *gin.Context) {
+	mediaFile, ok := h.ownedImage(c)
+	if !ok {
+		return
+	}
+
+	var req models.ExportEditsRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+	}
+
+	if mediaFile.Edits == nil || len(mediaFile.Edits.Steps) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Media has no edits to export"})
+		return
+	}
+
+	exported, err := h.editService.ExportEdited(c.Request.Context(), mediaFile, req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export edits: " + err.Error()})
+		return
+	}
+
+	if err := h.resolveURLs(exported); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate file URL"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, exported)
+}
+
+// ownedImage loads the image named by :id and checks it belongs to the
+// current user, writing the error response if not
+func (h *MediaHandler) ownedImage(c *gin.Context) (*models.MediaFile, bool) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User authentication required"})
+		return nil, false
+	}
+
+	mediaFile, err := h.dbService.GetMediaFileByID(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return nil, false
+	}
+
+	if mediaFile.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return nil, false
+	}
+
+	if !services.IsImageUpload(mediaFile.MimeType, mediaFile.OriginalName) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only images can be edited"})
+		return nil, false
+	}
+
+	return mediaFile, true
+}
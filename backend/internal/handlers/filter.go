@@ -1,10 +1,14 @@
 package handlers
 
 import (
+	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -22,19 +26,21 @@ type FilterHandler struct {
 	filterService    *services.FilterService
 	aiFilterService  *services.AIFilterService
 	analyticsService *services.FilterAnalyticsService
+	editService      *services.EditService
 	db               *mongo.Database
 }
 
-func NewFilterHandler(db *mongo.Database, filterService *services.FilterService, aiFilterService *services.AIFilterService) *FilterHandler {
+func NewFilterHandler(db *mongo.Database, filterService *services.FilterService, aiFilterService *services.AIFilterService, editService *services.EditService) *FilterHandler {
 	return &FilterHandler{
 		filterService:    filterService,
 		aiFilterService:  aiFilterService,
 		analyticsService: services.NewFilterAnalyticsService(db),
+		editService:      editService,
 		db:               db,
 	}
 }
 
-// GetFilterPresets returns all available filter presets
+// GetFilterPresets returns the built-in presets and the user's own
 // GET /api/filters/presets
 func (fh *FilterHandler) GetFilterPresets(c *gin.Context) {
 	category := c.Query("category")
@@ -42,6 +48,7 @@ func (fh *FilterHandler) GetFilterPresets(c *gin.Context) {
 
 	collection := fh.db.Collection("filter_presets")
 	filter := make(map[string]interface{})
+	filter["$or"] = []bson.M{{"isCustom": false}, {"createdBy": c.MustGet("user_id")}}
 
 	if category != "" {
 		filter["category"] = category
@@ -62,6 +69,9 @@ func (fh *FilterHandler) GetFilterPresets(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode filter presets"})
 		return
 	}
+	for i := range presets {
+		fh.filterService.ResolveThumbnailURLs(&presets[i])
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"presets": presets,
@@ -69,7 +79,8 @@ func (fh *FilterHandler) GetFilterPresets(c *gin.Context) {
 	})
 }
 
-// ApplyFilter applies a filter to a media file
+// ApplyFilter applies a filter to a media file. With ?preview=1 it renders
+// a downscaled copy (?maxDim=, default 800) for interactive tweaking.
 // POST /api/media/:mediaId/filters/:filterId/apply
 func (fh *FilterHandler) ApplyFilter(c *gin.Context) {
 	mediaIDStr := c.Param("mediaId")
@@ -136,23 +147,122 @@ func (fh *FilterHandler) ApplyFilter(c *gin.Context) {
 		}
 	}
 
+	// Resolve the output format: explicit option, then ?format=, then Accept header
+	output := models.OutputOptions{}
+	if req.Output != nil {
+		output = *req.Output
+	}
+	if output.Format == "" {
+		output.Format = c.Query("format")
+	}
+	if output.Format == "" {
+		output.Format = services.NegotiateImageFormat(c.GetHeader("Accept"))
+	}
+	if output.ColorSpace == "" {
+		output.ColorSpace = c.Query("colorSpace")
+	}
+	if err := services.ValidateOutputOptions(output); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Mask != nil {
+		// The request's mask is the topmost layer
+		if req.CustomConfig == nil {
+			req.CustomConfig = &models.FilterConfig{}
+		}
+		req.CustomConfig.Mask = req.Mask
+	}
+	if req.CustomConfig != nil {
+		if err := services.ValidateFilterConfig(*req.CustomConfig); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Previews render a cached downscaled copy within a latency budget; the
+	// full-resolution render happens when the result is saved
+	if c.Query("preview") == "1" {
+		if c.Query("store") == "1" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Previews can't be stored"})
+			return
+		}
+		maxDim := services.DefaultPreviewDim
+		if v := c.Query("maxDim"); v != "" {
+			if maxDim, err = strconv.Atoi(v); err != nil || maxDim < services.MinPreviewDim || maxDim > services.MaxPreviewDim {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("maxDim must be between %d and %d", services.MinPreviewDim, services.MaxPreviewDim)})
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), services.PreviewTimeout)
+		defer cancel()
+		result, err := fh.filterService.ApplyFilterPreview(ctx, mediaID, filterID, userObjID, req.CustomConfig, output, maxDim)
+		if err != nil {
+			switch {
+			case errors.Is(err, context.DeadlineExceeded):
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Preview took too long"})
+			case errors.Is(err, context.Canceled):
+				// The client went away; nobody is listening
+				c.Status(499)
+			case errors.Is(err, services.ErrPresetNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": "Filter not found"})
+			case errors.Is(err, services.ErrMediaNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to render preview: %v", err)})
+			}
+			return
+		}
+		c.Header("X-Preview", "1")
+		fh.respondFilterResult(c, result, mediaIDStr, filterIDStr)
+		return
+	}
+
 	// Apply the filter
-	processedImage, format, err := fh.filterService.ApplyFilter(c.Request.Context(), mediaID, filterID, userObjID, req.CustomConfig)
+	result, err := fh.filterService.ApplyFilter(c.Request.Context(), mediaID, filterID, userObjID, req.CustomConfig, output)
+	if errors.Is(err, services.ErrPresetNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Filter not found"})
+		return
+	}
+	if errors.Is(err, services.ErrMediaNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to apply filter: %v", err)})
 		return
 	}
 
+	if c.Query("store") == "1" {
+		fh.respondStored(c, mediaID, userObjID, result.Data, result.FilterName)
+		return
+	}
+	fh.respondFilterResult(c, result, mediaIDStr, filterIDStr)
+}
+
+// respondFilterResult sends the image itself when the client prefers it,
+// or the JSON body with the image base64-encoded
+func (fh *FilterHandler) respondFilterResult(c *gin.Context, result *services.FilterResult, mediaIDStr, filterIDStr string) {
+	if result.Cache != "" {
+		c.Header("X-Render-Cache", result.Cache)
+	}
+	if services.PrefersImageResponse(c.GetHeader("Accept")) {
+		respondImage(c, result.Data, services.MimeTypeForFormat(result.Format))
+		return
+	}
+
 	// Return the processed image as base64
-	encodedImage := base64.StdEncoding.EncodeToString(processedImage)
+	encodedImage := base64.StdEncoding.EncodeToString(result.Data)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"data": gin.H{
-			"processedImage": encodedImage,
-			"format":         format,
-			"mediaId":        mediaIDStr,
-			"filterId":       filterIDStr,
+			"processedImage":  encodedImage,
+			"format":          result.Format,
+			"mimeType":        services.MimeTypeForFormat(result.Format),
+			"mediaId":         mediaIDStr,
+			"filterId":        filterIDStr,
+			"effectiveConfig": result.Config,
 		},
 	})
 }
@@ -272,6 +382,9 @@ func (fh *FilterHandler) ApplyAIStyleTransfer(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to apply AI style transfer: %v", err)})
 		return
 	}
+	if fh.respondAIImage(c, result.ProcessedImage, fmt.Sprintf("AI %s", req.StyleType)) {
+		return
+	}
 
 	encodedImage := base64.StdEncoding.EncodeToString(result.ProcessedImage)
 
@@ -359,6 +472,9 @@ func (fh *FilterHandler) ApplyAIMoodEnhancement(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to apply AI mood enhancement: %v", err)})
 		return
 	}
+	if fh.respondAIImage(c, result.ProcessedImage, fmt.Sprintf("AI %s mood", req.MoodType)) {
+		return
+	}
 
 	encodedImage := base64.StdEncoding.EncodeToString(result.ProcessedImage)
 
@@ -374,7 +490,9 @@ func (fh *FilterHandler) ApplyAIMoodEnhancement(c *gin.Context) {
 	})
 }
 
-// GetFilterSuggestions returns AI-powered filter suggestions for a media file
+// GetFilterSuggestions returns AI-powered filter suggestions for a media file.
+// With ?previews=true each suggested preset is rendered on the media at
+// thumbnail size.
 // GET /api/media/:mediaId/filters/suggestions
 func (fh *FilterHandler) GetFilterSuggestions(c *gin.Context) {
 	mediaIDStr := c.Param("mediaId")
@@ -444,6 +562,7 @@ func (fh *FilterHandler) GetFilterSuggestions(c *gin.Context) {
 		if err := collection.FindOne(c.Request.Context(), bson.M{"_id": suggestion.FilterID}).Decode(&filter); err != nil {
 			continue // Skip if filter not found
 		}
+		fh.filterService.ResolveThumbnailURLs(&filter)
 
 		enrichedSuggestions = append(enrichedSuggestions, models.EnrichedFilterSuggestion{
 			FilterSuggestion: suggestion,
@@ -451,6 +570,20 @@ func (fh *FilterHandler) GetFilterSuggestions(c *gin.Context) {
 		})
 	}
 
+	// With ?previews=true each suggestion is also rendered on the media
+	if previews, _ := strconv.ParseBool(c.Query("previews")); previews {
+		filterIDs := make([]primitive.ObjectID, len(enrichedSuggestions))
+		for i, suggestion := range enrichedSuggestions {
+			filterIDs[i] = suggestion.FilterID
+		}
+		rendered := fh.filterService.RenderMediaPreviews(c.Request.Context(), mediaID, userObjID, filterIDs)
+		for i, suggestion := range enrichedSuggestions {
+			if data, ok := rendered[suggestion.FilterID]; ok {
+				enrichedSuggestions[i].Preview = "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(data)
+			}
+		}
+	}
+
 	response := models.FilterSuggestionResponse{
 		Suggestions: enrichedSuggestions,
 		MediaID:     mediaID,
@@ -483,9 +616,105 @@ func (fh *FilterHandler) GetUserFilterAnalytics(c *gin.Context) {
 	c.JSON(http.StatusOK, analytics)
 }
 
-// CreateCustomFilter creates a new custom filter preset
-// POST /api/filters/custom
-func (fh *FilterHandler) CreateCustomFilter(c *gin.Context) {
+// GetPresetTweaks returns the user's saved adjustments for a preset
+// GET /api/filters/presets/:id/tweaks
+func (fh *FilterHandler) GetPresetTweaks(c *gin.Context) {
+	userObjID, filterID, ok := fh.presetParams(c)
+	if !ok {
+		return
+	}
+
+	tweaks, err := fh.filterService.GetPresetTweaks(c.Request.Context(), userObjID, filterID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load preset tweaks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"filterId": filterID,
+		"tweaks":   tweaks,
+	})
+}
+
+// SavePresetTweaks stores adjustments applied on top of a preset whenever the
+// user applies it, before any per-request override
+// PUT /api/filters/presets/:id/tweaks
+func (fh *FilterHandler) SavePresetTweaks(c *gin.Context) {
+	userObjID, filterID, ok := fh.presetParams(c)
+	if !ok {
+		return
+	}
+
+	var tweaks models.FilterConfig
+	if err := c.ShouldBindJSON(&tweaks); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := services.ValidateFilterConfig(tweaks); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := fh.filterService.SavePresetTweaks(c.Request.Context(), userObjID, filterID, tweaks)
+	if errors.Is(err, services.ErrPresetNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Filter not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save preset tweaks: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"filterId": filterID,
+		"tweaks":   tweaks,
+	})
+}
+
+// DeletePresetTweaks discards the user's saved adjustments for a preset
+// DELETE /api/filters/presets/:id/tweaks
+func (fh *FilterHandler) DeletePresetTweaks(c *gin.Context) {
+	userObjID, filterID, ok := fh.presetParams(c)
+	if !ok {
+		return
+	}
+
+	if err := fh.filterService.DeletePresetTweaks(c.Request.Context(), userObjID, filterID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete preset tweaks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// presetParams reads the authenticated user and preset ID, writing an
+// error response if either is missing
+func (fh *FilterHandler) presetParams(c *gin.Context) (primitive.ObjectID, primitive.ObjectID, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+
+	userObjID, ok := userID.(primitive.ObjectID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+
+	filterID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filter ID"})
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+
+	return userObjID, filterID, true
+}
+
+// UploadLUT stores a .cube 3D LUT for use in "lut" effects
+// POST /api/filters/luts
+func (fh *FilterHandler) UploadLUT(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
@@ -498,34 +727,182 @@ func (fh *FilterHandler) CreateCustomFilter(c *gin.Context) {
 		return
 	}
 
-	var req models.CreateFilterPresetRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file provided"})
+		return
+	}
+	if !strings.EqualFold(filepath.Ext(file.Filename), ".cube") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only .cube LUT files are supported"})
+		return
+	}
+	if file.Size > services.MaxLUTFileSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("LUT files are limited to %d MB", services.MaxLUTFileSize>>20)})
 		return
 	}
 
-	// Create custom filter preset
-	preset := models.FilterPreset{
-		ID:          primitive.NewObjectID(),
-		Name:        req.Name,
-		Category:    req.Category,
-		Type:        req.Type,
-		Description: req.Description,
-		Config:      req.Config,
-		IsCustom:    true,
-		CreatedBy:   &userObjID,
+	fileContent, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open file"})
+		return
 	}
+	defer fileContent.Close()
 
-	collection := fh.db.Collection("filter_presets")
-	_, err := collection.InsertOne(c.Request.Context(), preset)
+	data, err := io.ReadAll(io.LimitReader(fileContent, services.MaxLUTFileSize))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file content"})
+		return
+	}
+
+	name := c.PostForm("name")
+	if name == "" {
+		name = file.Filename
+	}
+
+	lut, err := fh.filterService.UploadLUT(c.Request.Context(), userObjID, name, data)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create custom filter"})
+		if errors.Is(err, services.ErrInvalidLUT) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to upload LUT: %v", err)})
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{
 		"success": true,
-		"filter":  preset,
+		"lut":     lut,
+	})
+}
+
+// GetLUTs lists the built-in LUTs and the user's uploads
+// GET /api/filters/luts
+func (fh *FilterHandler) GetLUTs(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userObjID, ok := userID.(primitive.ObjectID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	builtin, uploaded, err := fh.filterService.ListLUTs(c.Request.Context(), userObjID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list LUTs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"builtin": builtin,
+		"luts":    uploaded,
+	})
+}
+
+// UploadMask stores a grayscale mask image for use in image masks
+// POST /api/filters/masks
+func (fh *FilterHandler) UploadMask(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userObjID, ok := userID.(primitive.ObjectID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file provided"})
+		return
+	}
+	if !services.IsImageUpload(file.Header.Get("Content-Type"), file.Filename) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Masks must be image files"})
+		return
+	}
+	if file.Size > services.MaxMaskFileSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Mask files are limited to %d MB", services.MaxMaskFileSize>>20)})
+		return
+	}
+
+	fileContent, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open file"})
+		return
+	}
+	defer fileContent.Close()
+
+	data, err := io.ReadAll(io.LimitReader(fileContent, services.MaxMaskFileSize))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file content"})
+		return
+	}
+
+	name := c.PostForm("name")
+	if name == "" {
+		name = file.Filename
+	}
+
+	mask, err := fh.filterService.UploadMask(c.Request.Context(), userObjID, name, data)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidMask) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to upload mask: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"mask":    mask,
+	})
+}
+
+// GetMasks lists the user's uploaded masks
+// GET /api/filters/masks
+func (fh *FilterHandler) GetMasks(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userObjID, ok := userID.(primitive.ObjectID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	masks, err := fh.filterService.ListMasks(c.Request.Context(), userObjID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list masks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"masks": masks})
+}
+
+// GetImageEncoders lists the output formats available in this build
+// GET /api/filters/encoders
+func (fh *FilterHandler) GetImageEncoders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"encoders": services.AvailableEncoders(),
+	})
+}
+
+// GetRenderCacheStats reports hit and miss counts of the render cache to
+// admins
+// GET /api/admin/filters/cache/stats
+func (fh *FilterHandler) GetRenderCacheStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"cache": fh.filterService.RenderCacheStats(),
 	})
 }
 
@@ -630,3 +1007,88 @@ func (fh *FilterHandler) GetFilterHistory(c *gin.Context) {
 		},
 	})
 }
+
+// GetDefaultWatermark returns the watermark stamped on the user's media on
+// public delivery and ZIP export
+// GET /api/users/me/filters/watermark
+func (fh *FilterHandler) GetDefaultWatermark(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userObjID, ok := userID.(primitive.ObjectID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	watermark, err := fh.filterService.GetDefaultWatermark(c.Request.Context(), userObjID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load default watermark"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"watermark": watermark})
+}
+
+// SaveDefaultWatermark sets the user's default watermark; the body holds
+// the params of a "watermark" effect
+// PUT /api/users/me/filters/watermark
+func (fh *FilterHandler) SaveDefaultWatermark(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userObjID, ok := userID.(primitive.ObjectID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	var params map[string]interface{}
+	if err := c.ShouldBindJSON(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := fh.filterService.SaveDefaultWatermark(c.Request.Context(), userObjID, params); err != nil {
+		if errors.Is(err, services.ErrInvalidWatermark) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save default watermark: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"watermark": params,
+	})
+}
+
+// DeleteDefaultWatermark stops watermarking the user's delivered media
+// DELETE /api/users/me/filters/watermark
+func (fh *FilterHandler) DeleteDefaultWatermark(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userObjID, ok := userID.(primitive.ObjectID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	if err := fh.filterService.DeleteDefaultWatermark(c.Request.Context(), userObjID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete default watermark"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
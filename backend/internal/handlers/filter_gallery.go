@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"mediaVault-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetFilterVisibility publishes one of the user's presets to the gallery or
+// makes it private again
+// PUT /api/filters/custom/:id/visibility
+func (fh *FilterHandler) SetFilterVisibility(c *gin.Context) {
+	userID, presetID, ok := fh.presetParams(c)
+	if !ok {
+		return
+	}
+
+	var req models.SetPresetVisibilityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	preset, err := fh.filterService.SetPresetVisibility(c.Request.Context(), userID, presetID, req.Visibility)
+	if err != nil {
+		respondPresetError(c, err, "Failed to change filter visibility")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"filter":  preset,
+	})
+}
+
+// ListFilterGallery searches the presets users have published. Sort is
+// popular (default), rating or newest.
+// GET /api/filters/gallery?category=&type=&search=&sort=&page=&limit=
+func (fh *FilterHandler) ListFilterGallery(c *gin.Context) {
+	query := models.PresetGalleryQuery{
+		Category: c.Query("category"),
+		Type:     c.Query("type"),
+		Search:   c.Query("search"),
+		Sort:     c.DefaultQuery("sort", models.GallerySortPopular),
+		Page:     1,
+		Limit:    20,
+	}
+	switch query.Sort {
+	case models.GallerySortPopular, models.GallerySortRating, models.GallerySortNewest:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be popular, rating or newest"})
+		return
+	}
+	if page, err := strconv.Atoi(c.Query("page")); err == nil && page > 0 {
+		query.Page = page
+	}
+	if limit, err := strconv.Atoi(c.Query("limit")); err == nil && limit > 0 && limit <= 100 {
+		query.Limit = limit
+	}
+
+	presets, total, err := fh.filterService.ListGalleryPresets(c.Request.Context(), query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list gallery"})
+		return
+	}
+	for i := range presets {
+		fh.filterService.ResolveThumbnailURLs(&presets[i].FilterPreset)
+	}
+
+	totalPages := (total + int64(query.Limit) - 1) / int64(query.Limit)
+	c.JSON(http.StatusOK, gin.H{
+		"presets": presets,
+		"pagination": gin.H{
+			"page":       query.Page,
+			"limit":      query.Limit,
+			"total":      total,
+			"totalPages": totalPages,
+			"hasNext":    query.Page < int(totalPages),
+			"hasPrev":    query.Page > 1,
+		},
+	})
+}
+
+// GetGalleryFilter returns a published preset with the user's rating
+// GET /api/filters/gallery/:id
+func (fh *FilterHandler) GetGalleryFilter(c *gin.Context) {
+	userID, presetID, ok := fh.presetParams(c)
+	if !ok {
+		return
+	}
+
+	preset, err := fh.filterService.GetGalleryPreset(c.Request.Context(), userID, presetID)
+	if err != nil {
+		respondPresetError(c, err, "Failed to get filter")
+		return
+	}
+	fh.filterService.ResolveThumbnailURLs(&preset.FilterPreset)
+
+	c.JSON(http.StatusOK, gin.H{"filter": preset})
+}
+
+// ForkFilter copies a published preset into the user's presets
+// POST /api/filters/gallery/:id/fork
+func (fh *FilterHandler) ForkFilter(c *gin.Context) {
+	userID, presetID, ok := fh.presetParams(c)
+	if !ok {
+		return
+	}
+
+	var req models.DuplicateFilterPresetRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	preset, err := fh.filterService.ForkPreset(c.Request.Context(), userID, presetID, req.Name)
+	if err != nil {
+		respondPresetError(c, err, "Failed to fork filter")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"filter":  preset,
+	})
+}
+
+// RateFilter rates a published preset from 1 to 5 stars
+// PUT /api/filters/gallery/:id/rating
+func (fh *FilterHandler) RateFilter(c *gin.Context) {
+	userID, presetID, ok := fh.presetParams(c)
+	if !ok {
+		return
+	}
+
+	var req models.RatePresetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rating, err := fh.filterService.RatePreset(c.Request.Context(), userID, presetID, req.Rating)
+	if err != nil {
+		respondPresetError(c, err, "Failed to rate filter")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"rating":   rating,
+		"myRating": req.Rating,
+	})
+}
+
+// UnpublishFilter lets an admin take a preset out of the gallery
+// POST /api/admin/filters/:id/unpublish
+func (fh *FilterHandler) UnpublishFilter(c *gin.Context) {
+	adminID, presetID, ok := fh.presetParams(c)
+	if !ok {
+		return
+	}
+
+	var req models.UnpublishPresetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := fh.filterService.UnpublishPreset(c.Request.Context(), adminID, presetID, req.Reason); err != nil {
+		respondPresetError(c, err, "Failed to unpublish filter")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"mediaVault-backend/internal/models"
+	"mediaVault-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ListCustomFilters lists the user's own presets
+// GET /api/filters/custom
+func (fh *FilterHandler) ListCustomFilters(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userObjID, ok := userID.(primitive.ObjectID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	presets, err := fh.filterService.ListCustomPresets(c.Request.Context(), userObjID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list custom filters"})
+		return
+	}
+	for i := range presets {
+		fh.filterService.ResolveThumbnailURLs(&presets[i])
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"presets": presets,
+		"total":   len(presets),
+	})
+}
+
+// CreateCustomFilter creates a new custom filter preset
+// POST /api/filters/custom
+func (fh *FilterHandler) CreateCustomFilter(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userObjID, ok := userID.(primitive.ObjectID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	var req models.CreateFilterPresetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	preset, err := fh.filterService.CreateCustomPreset(c.Request.Context(), userObjID, req)
+	if err != nil {
+		respondPresetError(c, err, "Failed to create custom filter")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"filter":  preset,
+	})
+}
+
+// GetCustomFilter returns one of the user's presets
+// GET /api/filters/custom/:id
+func (fh *FilterHandler) GetCustomFilter(c *gin.Context) {
+	userID, presetID, ok := fh.presetParams(c)
+	if !ok {
+		return
+	}
+
+	preset, err := fh.filterService.GetCustomPreset(c.Request.Context(), userID, presetID)
+	if err != nil {
+		respondPresetError(c, err, "Failed to get custom filter")
+		return
+	}
+	fh.filterService.ResolveThumbnailURLs(preset)
+
+	c.JSON(http.StatusOK, gin.H{"filter": preset})
+}
+
+// UpdateCustomFilter replaces one of the user's presets, recording a new
+// version
+// PUT /api/filters/custom/:id
+func (fh *FilterHandler) UpdateCustomFilter(c *gin.Context) {
+	userID, presetID, ok := fh.presetParams(c)
+	if !ok {
+		return
+	}
+
+	var req models.CreateFilterPresetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	preset, err := fh.filterService.UpdateCustomPreset(c.Request.Context(), userID, presetID, req)
+	if err != nil {
+		respondPresetError(c, err, "Failed to update custom filter")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"filter":  preset,
+	})
+}
+
+// DeleteCustomFilter deletes one of the user's presets
+// DELETE /api/filters/custom/:id
+func (fh *FilterHandler) DeleteCustomFilter(c *gin.Context) {
+	userID, presetID, ok := fh.presetParams(c)
+	if !ok {
+		return
+	}
+
+	if err := fh.filterService.DeleteCustomPreset(c.Request.Context(), userID, presetID); err != nil {
+		respondPresetError(c, err, "Failed to delete custom filter")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// GetCustomFilterVersions lists every saved version of one of the user's
+// presets, newest first
+// GET /api/filters/custom/:id/versions
+func (fh *FilterHandler) GetCustomFilterVersions(c *gin.Context) {
+	userID, presetID, ok := fh.presetParams(c)
+	if !ok {
+		return
+	}
+
+	versions, err := fh.filterService.GetPresetVersions(c.Request.Context(), userID, presetID)
+	if err != nil {
+		respondPresetError(c, err, "Failed to list filter versions")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"versions": versions})
+}
+
+// DuplicatePreset copies a built-in or custom preset into a new custom
+// preset the user can edit
+// POST /api/filters/presets/:id/duplicate
+func (fh *FilterHandler) DuplicatePreset(c *gin.Context) {
+	userID, presetID, ok := fh.presetParams(c)
+	if !ok {
+		return
+	}
+
+	var req models.DuplicateFilterPresetRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	preset, err := fh.filterService.DuplicatePreset(c.Request.Context(), userID, presetID, req.Name)
+	if err != nil {
+		respondPresetError(c, err, "Failed to duplicate filter")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"filter":  preset,
+	})
+}
+
+// ExportFilters returns presets as a JSON bundle that ImportFilters
+// accepts, with the uploaded LUTs and masks they use, and the assets that
+// had to be left out
+// POST /api/filters/export
+func (fh *FilterHandler) ExportFilters(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userObjID, ok := userID.(primitive.ObjectID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	var req models.ExportPresetsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := fh.filterService.ExportPresets(c.Request.Context(), userObjID, req.PresetIDs)
+	if err != nil {
+		respondPresetError(c, err, "Failed to export filters")
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// ImportFilters creates custom presets from an uploaded JSON bundle or a
+// Lightroom .xmp preset, reporting settings that couldn't be carried over
+// POST /api/filters/import
+func (fh *FilterHandler) ImportFilters(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userObjID, ok := userID.(primitive.ObjectID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file provided"})
+		return
+	}
+	if file.Size > services.MaxPresetImportSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Preset files are limited to %d MB", services.MaxPresetImportSize>>20)})
+		return
+	}
+
+	fileContent, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open file"})
+		return
+	}
+	defer fileContent.Close()
+
+	data, err := io.ReadAll(io.LimitReader(fileContent, services.MaxPresetImportSize))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file content"})
+		return
+	}
+
+	result, err := fh.filterService.ImportPresets(c.Request.Context(), userObjID, file.Filename, data)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidPresetImport) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		respondPresetError(c, err, "Failed to import filters")
+		return
+	}
+	if len(result.Presets) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":       "No presets could be imported",
+			"unsupported": result.Unsupported,
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success":     true,
+		"presets":     result.Presets,
+		"unsupported": result.Unsupported,
+	})
+}
+
+// respondPresetError maps preset service errors to status codes
+func respondPresetError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrPresetNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Filter not found"})
+	case errors.Is(err, services.ErrInvalidPreset):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrPresetModerated):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrPresetConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "Filter was changed concurrently; reload and try again"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message + ": " + err.Error()})
+	}
+}
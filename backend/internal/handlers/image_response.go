@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+
+	"mediaVault-backend/internal/middleware"
+	"mediaVault-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// respondImage sends processed image bytes as the response body. The ETag
+// lets clients revalidate instead of downloading the same result again.
+func respondImage(c *gin.Context, data []byte, mimeType string) {
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	c.Header("Vary", "Accept")
+	c.Header("Cache-Control", "private, no-cache")
+	c.Header("ETag", etag)
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Header("Content-Length", strconv.Itoa(len(data)))
+	c.Data(http.StatusOK, mimeType, data)
+}
+
+// respondStored saves a processed image as a new media item and replies
+// with where to find it
+func (fh *FilterHandler) respondStored(c *gin.Context, mediaID, userID primitive.ObjectID, data []byte, label string) {
+	saved, err := fh.editService.SaveResult(c.Request.Context(), mediaID, userID, data, label)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store result: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"mediaId": saved.ID,
+		"url":     saved.URL,
+	})
+}
+
+// respondAIImage handles ?store=1 and Accept: image/* for AI results. It
+// returns false when the caller should send the JSON response instead.
+func (fh *FilterHandler) respondAIImage(c *gin.Context, data []byte, label string) bool {
+	store := c.Query("store") == "1"
+	if !store && !services.PrefersImageResponse(c.GetHeader("Accept")) {
+		return false
+	}
+	if len(data) == 0 {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "AI service returned no image"})
+		return true
+	}
+
+	if !store {
+		respondImage(c, data, http.DetectContentType(data))
+		return true
+	}
+
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User authentication required"})
+		return true
+	}
+	mediaID, err := primitive.ObjectIDFromHex(c.Param("mediaId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid media ID"})
+		return true
+	}
+	fh.respondStored(c, mediaID, userID, data, label)
+	return true
+}
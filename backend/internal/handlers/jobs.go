@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"mediaVault-backend/internal/middleware"
+	"mediaVault-backend/internal/models"
+	"mediaVault-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type JobHandler struct {
+	batchService *services.BatchService
+}
+
+func NewJobHandler(batchService *services.BatchService) *JobHandler {
+	return &JobHandler{batchService: batchService}
+}
+
+// CreateBatch queues a job applying a filter to many media items and
+// returns it right away; poll GET /api/jobs/:id for progress
+// POST /api/filters/batch
+func (h *JobHandler) CreateBatch(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User authentication required"})
+		return
+	}
+
+	var req models.BatchFilterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.CustomConfig != nil {
+		if err := services.ValidateFilterConfig(*req.CustomConfig); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	job, err := h.batchService.CreateBatch(c.Request.Context(), userID, req)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidBatch) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to queue batch: %v", err)})
+		return
+	}
+
+	c.Header("Location", "/api/v1/jobs/"+job.ID.Hex())
+	c.JSON(http.StatusAccepted, job)
+}
+
+// GetJob reports a job's progress and the outcome of each item
+// GET /api/jobs/:id
+func (h *JobHandler) GetJob(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User authentication required"})
+		return
+	}
+
+	jobID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	job, err := h.batchService.GetJob(c.Request.Context(), userID, jobID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get job"})
+		return
+	}
+	if job == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
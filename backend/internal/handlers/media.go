@@ -3,6 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"io"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -18,13 +19,17 @@ type MediaHandler struct {
 	dbService           *services.DatabaseService
 	minioService        *services.MinioService
 	imageAnalysisService *services.ImageAnalysisService
+	ingestService       *services.ImageIngestService
+	editService         *services.EditService
 }
 
-func NewMediaHandler(dbService *services.DatabaseService, minioService *services.MinioService, imageAnalysisService *services.ImageAnalysisService) *MediaHandler {
+func NewMediaHandler(dbService *services.DatabaseService, minioService *services.MinioService, imageAnalysisService *services.ImageAnalysisService, ingestService *services.ImageIngestService, editService *services.EditService) *MediaHandler {
 	return &MediaHandler{
 		dbService:           dbService,
 		minioService:        minioService,
 		imageAnalysisService: imageAnalysisService,
+		ingestService:       ingestService,
+		editService:         editService,
 	}
 }
 
@@ -76,29 +81,45 @@ func (h *MediaHandler) UploadFile(c *gin.Context) {
 		}
 	}
 
-	// Upload to MinIO
-	mediaFile, err := h.minioService.UploadFile(file, metadata, userID)
+	// Upload to MinIO; SVGs are sanitized before they reach the public bucket
+	var mediaFile *models.MediaFile
+	if services.IsSVGUpload(file) {
+		sanitized, sanitizeErr := services.ReadSanitizedSVG(file)
+		if sanitizeErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": sanitizeErr.Error()})
+			return
+		}
+		mediaFile, err = h.minioService.UploadContent(sanitized, file.Filename, "image/svg+xml", metadata, userID)
+	} else {
+		mediaFile, err = h.minioService.UploadFile(file, metadata, userID)
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload file: " + err.Error()})
 		return
 	}
 
+	// Detect the real format and generate derived variants (e.g. HEIC/RAW previews)
+	if err := h.ingestService.ProcessUpload(c.Request.Context(), mediaFile, file); err != nil {
+		log.Printf("Ingest processing failed for %s: %v", mediaFile.FileName, err)
+	}
+
 	// Save to database
 	err = h.dbService.CreateMediaFile(c.Request.Context(), mediaFile)
 	if err != nil {
-		// If DB save fails, try to clean up the uploaded file
+		// If DB save fails, try to clean up the uploaded file and its variants
 		_ = h.minioService.DeleteFile(mediaFile.FileName)
+		for _, name := range mediaFile.VariantFileNames() {
+			_ = h.minioService.DeleteFile(name)
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file metadata: " + err.Error()})
 		return
 	}
 
 	// Get file URL
-	url, err := h.minioService.GetFileURL(mediaFile.FileName)
-	if err != nil {
+	if err := h.resolveURLs(mediaFile); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate file URL"})
 		return
 	}
-	mediaFile.URL = url
 
 	c.JSON(http.StatusCreated, mediaFile)
 }
@@ -127,12 +148,10 @@ func (h *MediaHandler) GetFile(c *gin.Context) {
 	}
 
 	// Get file URL
-	url, err := h.minioService.GetFileURL(mediaFile.FileName)
-	if err != nil {
+	if err := h.resolveURLs(mediaFile); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate file URL"})
 		return
 	}
-	mediaFile.URL = url
 
 	c.JSON(http.StatusOK, mediaFile)
 }
@@ -191,9 +210,7 @@ func (h *MediaHandler) ListFiles(c *gin.Context) {
 
 	// Generate URLs for all files
 	for _, mediaFile := range mediaFiles {
-		if url, err := h.minioService.GetFileURL(mediaFile.FileName); err == nil {
-			mediaFile.URL = url
-		}
+		_ = h.resolveURLs(mediaFile)
 	}
 
 	// Calculate pagination info
@@ -250,12 +267,10 @@ func (h *MediaHandler) UpdateFile(c *gin.Context) {
 	}
 
 	// Get file URL
-	url, err := h.minioService.GetFileURL(mediaFile.FileName)
-	if err != nil {
+	if err := h.resolveURLs(mediaFile); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate file URL"})
 		return
 	}
-	mediaFile.URL = url
 
 	c.JSON(http.StatusOK, mediaFile)
 }
@@ -289,16 +304,77 @@ func (h *MediaHandler) DeleteFile(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete file from storage"})
 		return
 	}
+	for _, name := range mediaFile.VariantFileNames() {
+		if err := h.minioService.DeleteFile(name); err != nil {
+			log.Printf("Failed to delete variant %s: %v", name, err)
+		}
+	}
 
 	// Delete from database
 	if err := h.dbService.DeleteMediaFile(c.Request.Context(), id); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete file metadata"})
 		return
 	}
+	h.editService.InvalidateRenders(mediaFile.ID)
 
 	c.JSON(http.StatusOK, gin.H{"message": "File deleted successfully"})
 }
 
+// RotateFile rotates an image clockwise by a multiple of 90 degrees
+// POST /api/media/:id/rotate
+func (h *MediaHandler) RotateFile(c *gin.Context) {
+	// Get current user ID
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User authentication required"})
+		return
+	}
+
+	var req models.RotateMediaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	mediaFile, err := h.dbService.GetMediaFileByID(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	if mediaFile.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	if !services.IsImageUpload(mediaFile.MimeType, mediaFile.OriginalName) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only images can be rotated"})
+		return
+	}
+
+	mode, err := h.ingestService.RotateMedia(c.Request.Context(), mediaFile, req.Degrees, req.Mode)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to rotate image: " + err.Error()})
+		return
+	}
+
+	if err := h.dbService.UpdateMediaRenditions(c.Request.Context(), mediaFile); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save rotation: " + err.Error()})
+		return
+	}
+	h.editService.InvalidateRenders(mediaFile.ID)
+
+	if err := h.resolveURLs(mediaFile); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate file URL"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"mode":  mode,
+		"media": mediaFile,
+	})
+}
+
 // DownloadFile serves the file content
 func (h *MediaHandler) DownloadFile(c *gin.Context) {
 	// Get current user ID
@@ -333,12 +409,43 @@ func (h *MediaHandler) DownloadFile(c *gin.Context) {
 	// Set appropriate headers
 	c.Header("Content-Disposition", "attachment; filename=\""+mediaFile.OriginalName+"\"")
 	c.Header("Content-Type", mediaFile.MimeType)
+	if mediaFile.IsSVG() {
+		c.Header("Content-Security-Policy", services.SVGContentSecurityPolicy)
+		c.Header("X-Content-Type-Options", "nosniff")
+	}
 	c.Header("Content-Length", strconv.FormatInt(mediaFile.Size, 10))
 
 	// Stream the file content
 	c.DataFromReader(http.StatusOK, mediaFile.Size, mediaFile.MimeType, reader, nil)
 }
 
+// resolveURLs fills in presigned URLs. URL points at the display rendition
+// (the developed variant for HEIC/RAW originals, the PNG raster for SVGs);
+// downloads still serve the untouched original.
+func (h *MediaHandler) resolveURLs(mediaFile *models.MediaFile) error {
+	var url string
+	var err error
+	if mediaFile.IsSVG() && mediaFile.WorkingFileName() == mediaFile.FileName {
+		// No raster preview; never let the bucket render the markup inline
+		url, err = h.minioService.GetAttachmentURL(mediaFile.FileName, mediaFile.OriginalName)
+	} else {
+		url, err = h.minioService.GetFileURL(mediaFile.WorkingFileName())
+	}
+	if err != nil {
+		return err
+	}
+	mediaFile.URL = url
+
+	for name, variant := range mediaFile.Variants {
+		if variantURL, err := h.minioService.GetFileURL(variant.FileName); err == nil {
+			variant.URL = variantURL
+			mediaFile.Variants[name] = variant
+		}
+	}
+
+	return nil
+}
+
 // GetCategories retrieves all available categories
 func (h *MediaHandler) GetCategories(c *gin.Context) {
 	categories, err := h.dbService.GetCategories(c.Request.Context())
@@ -382,7 +489,7 @@ func (h *MediaHandler) GenerateAutoSuggestions(c *gin.Context) {
 	}
 
 	// Check if it's an image
-	if !strings.HasPrefix(file.Header.Get("Content-Type"), "image/") {
+	if !services.IsImageUpload(file.Header.Get("Content-Type"), file.Filename) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Only image files are supported for auto-suggestions"})
 		return
 	}
@@ -401,6 +508,18 @@ func (h *MediaHandler) GenerateAutoSuggestions(c *gin.Context) {
 		return
 	}
 
+	// Convert HEIC/RAW uploads to something the analysis models can read
+	mimeType := file.Header.Get("Content-Type")
+	imageData, mimeType, err = h.ingestService.DevelopImage(c.Request.Context(), imageData, file.Filename)
+	if err != nil {
+		suggestions := h.generateBasicSuggestions(file.Filename, file.Header.Get("Content-Type"))
+		c.JSON(http.StatusOK, suggestions)
+		return
+	}
+	if mimeType == "" {
+		mimeType = file.Header.Get("Content-Type")
+	}
+
 	// If image analysis service is not available, return basic suggestions
 	if h.imageAnalysisService == nil {
 		suggestions := h.generateBasicSuggestions(file.Filename, file.Header.Get("Content-Type"))
@@ -409,7 +528,7 @@ func (h *MediaHandler) GenerateAutoSuggestions(c *gin.Context) {
 	}
 
 	// Analyze the image
-	analysis, err := h.imageAnalysisService.AnalyzeImage(c.Request.Context(), imageData, file.Header.Get("Content-Type"))
+	analysis, err := h.imageAnalysisService.AnalyzeImage(c.Request.Context(), imageData, mimeType)
 	if err != nil {
 		// Fallback to basic suggestions
 		suggestions := h.generateBasicSuggestions(file.Filename, file.Header.Get("Content-Type"))
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Edit step types
+const (
+	EditStepFilter = "filter"
+	EditStepCrop   = "crop"
+	EditStepRotate = "rotate"
+)
+
+// VariantEdited is the cached render of a media item's edit stack
+const VariantEdited = "edited"
+
+// EditStack is the ordered, non-destructive list of edits on a media item.
+// The original is never modified; the result is rendered on demand and
+// cached as the "edited" variant.
+type EditStack struct {
+	Steps []EditStep `json:"steps" bson:"steps"`
+	// RenderKey identifies the inputs of the cached render, so it is rebuilt
+	// when the stack, the original or a referenced preset changes
+	RenderKey string    `json:"-" bson:"renderKey,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`
+}
+
+// EditStep is one operation in an edit stack. Filter steps reference a
+// preset, optionally layered with Config, or carry a standalone Config.
+type EditStep struct {
+	Type     string              `json:"type" bson:"type"`
+	FilterID *primitive.ObjectID `json:"filterId,omitempty" bson:"filterId,omitempty"`
+	Config   *FilterConfig       `json:"config,omitempty" bson:"config,omitempty"`
+	Crop     *CropRect           `json:"crop,omitempty" bson:"crop,omitempty"`
+	Degrees  int                 `json:"degrees,omitempty" bson:"degrees,omitempty"` // clockwise, multiple of 90
+}
+
+// CropRect selects a region as fractions (0-1) of the image at that point in
+// the stack, so crops survive resolution changes of the original
+type CropRect struct {
+	X      float64 `json:"x" bson:"x"`
+	Y      float64 `json:"y" bson:"y"`
+	Width  float64 `json:"width" bson:"width"`
+	Height float64 `json:"height" bson:"height"`
+}
+
+type SaveEditsRequest struct {
+	Steps []EditStep `json:"steps"`
+}
+
+type ExportEditsRequest struct {
+	Title       string   `json:"title"`
+	Description *string  `json:"description"`
+	Category    *string  `json:"category"`
+	Tags        []string `json:"tags"`
+}
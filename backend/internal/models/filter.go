@@ -38,17 +38,68 @@ const (
 
 // FilterPreset represents a pre-defined filter configuration
 type FilterPreset struct {
-	ID          primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
-	Name        string              `json:"name" bson:"name"`
-	Category    FilterCategory      `json:"category" bson:"category"`
-	Type        string              `json:"type" bson:"type"` // ArtisticFilterType or MoodFilterType
-	Description string              `json:"description" bson:"description"`
-	Thumbnail   *string             `json:"thumbnail" bson:"thumbnail,omitempty"`
-	Config      FilterConfig        `json:"config" bson:"config"`
-	IsCustom    bool                `json:"isCustom" bson:"isCustom"`
-	CreatedBy   *primitive.ObjectID `json:"createdBy" bson:"createdBy,omitempty"`
-	CreatedAt   time.Time           `json:"createdAt" bson:"createdAt"`
-	UpdatedAt   time.Time           `json:"updatedAt" bson:"updatedAt"`
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name        string             `json:"name" bson:"name"`
+	Category    FilterCategory     `json:"category" bson:"category"`
+	Type        string             `json:"type" bson:"type"` // ArtisticFilterType or MoodFilterType
+	Description string             `json:"description" bson:"description"`
+	// Thumbnail is the bucket object of the preset's default thumbnail and
+	// ThumbnailURL a link to it. CustomThumbnail marks one that was
+	// supplied, by an import, rather than rendered; renders leave it in
+	// place until the config changes.
+	Thumbnail       *string `json:"thumbnail" bson:"thumbnail,omitempty"`
+	ThumbnailURL    string  `json:"thumbnailUrl,omitempty" bson:"-"`
+	CustomThumbnail bool    `json:"-" bson:"customThumbnail,omitempty"`
+	// Thumbnails are the preset rendered on each bundled reference image;
+	// ThumbnailHash identifies the config they were rendered from
+	Thumbnails    []PresetThumbnail   `json:"thumbnails,omitempty" bson:"thumbnails,omitempty"`
+	ThumbnailHash string              `json:"-" bson:"thumbnailHash,omitempty"`
+	Config        FilterConfig        `json:"config" bson:"config"`
+	IsCustom      bool                `json:"isCustom" bson:"isCustom"`
+	CreatedBy     *primitive.ObjectID `json:"createdBy" bson:"createdBy,omitempty"`
+	// Version increases whenever the definition changes; built-ins take it
+	// from the preset catalog
+	Version int `json:"version,omitempty" bson:"version,omitempty"`
+	// Visibility is PresetPublic for custom presets shared in the gallery
+	Visibility  PresetVisibility    `json:"visibility,omitempty" bson:"visibility,omitempty"`
+	PublishedAt *time.Time          `json:"publishedAt,omitempty" bson:"publishedAt,omitempty"`
+	ForkedFrom  *primitive.ObjectID `json:"forkedFrom,omitempty" bson:"forkedFrom,omitempty"`
+	Forks       int                 `json:"forks,omitempty" bson:"forks,omitempty"`
+	Rating      *PresetRating       `json:"rating,omitempty" bson:"rating,omitempty"`
+	// Moderation is set when an admin took the preset out of the gallery
+	Moderation *PresetModeration `json:"moderation,omitempty" bson:"moderation,omitempty"`
+	CreatedAt  time.Time         `json:"createdAt" bson:"createdAt"`
+	UpdatedAt  time.Time         `json:"updatedAt" bson:"updatedAt"`
+}
+
+// PresetThumbnail is a preset rendered on one of the reference images
+type PresetThumbnail struct {
+	Reference string `json:"reference" bson:"reference"`
+	Object    string `json:"-" bson:"object"`
+	URL       string `json:"url,omitempty" bson:"-"`
+}
+
+// PresetVisibility controls who can find and apply a custom preset
+type PresetVisibility string
+
+const (
+	PresetPrivate PresetVisibility = "private"
+	PresetPublic  PresetVisibility = "public"
+)
+
+// PresetRating is the aggregate of a public preset's star ratings
+type PresetRating struct {
+	Average float64 `json:"average" bson:"average"`
+	Count   int     `json:"count" bson:"count"`
+}
+
+// PresetModeration records why an admin unpublished a preset. The owner can
+// publish again once they've saved a newer version.
+type PresetModeration struct {
+	Reason        string             `json:"reason" bson:"reason"`
+	Version       int                `json:"version" bson:"version"`
+	UnpublishedBy primitive.ObjectID `json:"-" bson:"unpublishedBy"`
+	UnpublishedAt time.Time          `json:"unpublishedAt" bson:"unpublishedAt"`
 }
 
 // FilterConfig holds all the parameters for a filter
@@ -64,16 +115,136 @@ type FilterConfig struct {
 	Opacity    *float64 `json:"opacity,omitempty" bson:"opacity,omitempty"`
 	Invert     *float64 `json:"invert,omitempty" bson:"invert,omitempty"`
 
-	// Advanced effects
-	Effects []Effect `json:"effects,omitempty" bson:"effects,omitempty"`
+	// Tone adjustments, applied after the CSS-like filters in the same pass
+	// in the order levels, curves, HSL
+	Levels *LevelsConfig            `json:"levels,omitempty" bson:"levels,omitempty"`
+	Curves *ToneCurves              `json:"curves,omitempty" bson:"curves,omitempty"`
+	HSL    map[string]HSLAdjustment `json:"hsl,omitempty" bson:"hsl,omitempty"` // keyed by HSL band, e.g. "reds"
+
+	// Geometry is applied before the color adjustments and effects
+	Geometry *GeometryConfig `json:"geometry,omitempty" bson:"geometry,omitempty"`
+	// Mask limits the adjustments and effects to part of the image
+	Mask *MaskConfig `json:"mask,omitempty" bson:"mask,omitempty"`
+
+	// Advanced effects. Stored even when empty, since an empty list in
+	// replace mode clears the effects underneath.
+	Effects []Effect `json:"effects,omitempty" bson:"effects"`
+	// EffectsMode controls how Effects combine with the layer underneath
+	// when configs are stacked; see the EffectsMerge constants
+	EffectsMode string `json:"effectsMode,omitempty" bson:"effectsMode,omitempty"`
+}
+
+// GeometryConfig crops and orients the image. The operations always run in
+// the order rotate, flip, straighten, crop, aspect.
+type GeometryConfig struct {
+	Rotate     *int      `json:"rotate,omitempty" bson:"rotate,omitempty"`         // clockwise, multiple of 90
+	FlipH      *bool     `json:"flipH,omitempty" bson:"flipH,omitempty"`           // mirror left to right
+	FlipV      *bool     `json:"flipV,omitempty" bson:"flipV,omitempty"`           // mirror top to bottom
+	Straighten *float64  `json:"straighten,omitempty" bson:"straighten,omitempty"` // degrees clockwise, -45 to 45; the empty corners are cropped away
+	Crop       *CropRect `json:"crop,omitempty" bson:"crop,omitempty"`             // fractions of the image after the steps above
+	Aspect     string    `json:"aspect,omitempty" bson:"aspect,omitempty"`         // e.g. "1:1" or "16:9", cropped around the focal point
+	FocalX     *float64  `json:"focalX,omitempty" bson:"focalX,omitempty"`         // 0-1, default 0.5
+	FocalY     *float64  `json:"focalY,omitempty" bson:"focalY,omitempty"`         // 0-1, default 0.5
+}
+
+// LevelsConfig remaps tones like a levels dialog: InputBlack and InputWhite
+// (0-255) become OutputBlack and OutputWhite, with Gamma (0.1-10, 1 is
+// linear) bending the midtones in between
+type LevelsConfig struct {
+	InputBlack  *float64 `json:"inputBlack,omitempty" bson:"inputBlack,omitempty"`
+	InputWhite  *float64 `json:"inputWhite,omitempty" bson:"inputWhite,omitempty"`
+	Gamma       *float64 `json:"gamma,omitempty" bson:"gamma,omitempty"`
+	OutputBlack *float64 `json:"outputBlack,omitempty" bson:"outputBlack,omitempty"`
+	OutputWhite *float64 `json:"outputWhite,omitempty" bson:"outputWhite,omitempty"`
+}
+
+// ToneCurves maps tones through smooth curves drawn through control points.
+// RGB applies to every channel before the per-channel curves. An empty
+// curve is linear, which lets a layer reset one set underneath it.
+type ToneCurves struct {
+	RGB   []CurvePoint `json:"rgb,omitempty" bson:"rgb"`
+	Red   []CurvePoint `json:"red,omitempty" bson:"red"`
+	Green []CurvePoint `json:"green,omitempty" bson:"green"`
+	Blue  []CurvePoint `json:"blue,omitempty" bson:"blue"`
+}
+
+// CurvePoint maps input tone X to output tone Y, both 0-255
+type CurvePoint struct {
+	X float64 `json:"x" bson:"x"`
+	Y float64 `json:"y" bson:"y"`
+}
+
+// HSLAdjustment shifts one color band, each value from -100 to 100
+type HSLAdjustment struct {
+	Hue        *float64 `json:"hue,omitempty" bson:"hue,omitempty"`
+	Saturation *float64 `json:"saturation,omitempty" bson:"saturation,omitempty"`
+	Luminance  *float64 `json:"luminance,omitempty" bson:"luminance,omitempty"`
+}
+
+// HSL mixer bands, in hue order
+const (
+	HSLReds     = "reds"
+	HSLOranges  = "oranges"
+	HSLYellows  = "yellows"
+	HSLGreens   = "greens"
+	HSLAquas    = "aquas"
+	HSLBlues    = "blues"
+	HSLPurples  = "purples"
+	HSLMagentas = "magentas"
+)
+
+// Mask types
+const (
+	MaskNone    = "none" // clears a mask set in a lower layer
+	MaskRect    = "rect"
+	MaskEllipse = "ellipse"
+	MaskLinear  = "linear"
+	MaskRadial  = "radial"
+	MaskImage   = "image"
+)
+
+// MaskConfig blends the filtered image over the unfiltered one: where the
+// mask is 1 the filter applies fully, where it is 0 the image is untouched.
+// Positions are fractions (0-1) of the image after geometry.
+type MaskConfig struct {
+	Type string `json:"type" bson:"type"`
+	// Rect bounds rect and ellipse masks; Feather (0-1) softens their edge
+	// inwards, as a fraction of the shape's half size
+	Rect    *CropRect `json:"rect,omitempty" bson:"rect,omitempty"`
+	Feather float64   `json:"feather,omitempty" bson:"feather,omitempty"`
+	// Linear gradients fade from full at From to none at To; radial ones
+	// from full at From (the center) to none at the distance of To
+	From *MaskPoint `json:"from,omitempty" bson:"from,omitempty"`
+	To   *MaskPoint `json:"to,omitempty" bson:"to,omitempty"`
+	// MaskID references an uploaded grayscale mask, stretched to the image
+	MaskID *primitive.ObjectID `json:"maskId,omitempty" bson:"maskId,omitempty"`
+	Invert bool                `json:"invert,omitempty" bson:"invert,omitempty"`
+}
+
+type MaskPoint struct {
+	X float64 `json:"x" bson:"x"`
+	Y float64 `json:"y" bson:"y"`
 }
 
 // Effect represents advanced image processing effects
 type Effect struct {
 	Type   string                 `json:"type" bson:"type"`
 	Params map[string]interface{} `json:"params" bson:"params"`
+	// Remove drops the effect of this type from the layers underneath
+	// (byType merging only)
+	Remove bool `json:"remove,omitempty" bson:"remove,omitempty"`
 }
 
+const (
+	// EffectsMergeByType (the default) updates the params of effects whose
+	// type is already present and appends the rest
+	EffectsMergeByType = "byType"
+	// EffectsMergeAppend adds the effects after the ones underneath
+	EffectsMergeAppend = "append"
+	// EffectsMergeReplace discards the effects underneath
+	EffectsMergeReplace = "replace"
+)
+
 // UserFilterPreference tracks user's filter usage and preferences
 type UserFilterPreference struct {
 	ID             primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
@@ -83,8 +254,14 @@ type UserFilterPreference struct {
 	StyleProfile   StyleProfile         `json:"styleProfile" bson:"styleProfile"`
 	LastUsed       *primitive.ObjectID  `json:"lastUsed" bson:"lastUsed,omitempty"`
 	UsageCount     map[string]int       `json:"usageCount" bson:"usageCount"`
-	CreatedAt      time.Time            `json:"createdAt" bson:"createdAt"`
-	UpdatedAt      time.Time            `json:"updatedAt" bson:"updatedAt"`
+	// PresetTweaks holds the user's saved adjustments per preset ID, layered
+	// between the preset and per-request overrides
+	PresetTweaks map[string]FilterConfig `json:"presetTweaks,omitempty" bson:"presetTweaks,omitempty"`
+	// DefaultWatermark holds the params of the watermark effect stamped on
+	// the user's media on public delivery and ZIP export
+	DefaultWatermark map[string]interface{} `json:"defaultWatermark,omitempty" bson:"defaultWatermark,omitempty"`
+	CreatedAt        time.Time              `json:"createdAt" bson:"createdAt"`
+	UpdatedAt        time.Time              `json:"updatedAt" bson:"updatedAt"`
 }
 
 // StyleProfile represents user's learned style preferences
@@ -110,7 +287,10 @@ type FilterApplication struct {
 	UserID       primitive.ObjectID `json:"userId" bson:"userId"`
 	FilterID     primitive.ObjectID `json:"filterId" bson:"filterId"`
 	CustomConfig *FilterConfig      `json:"customConfig" bson:"customConfig,omitempty"`
-	AppliedAt    time.Time          `json:"appliedAt" bson:"appliedAt"`
+	// PresetVersion is the version of the preset that was applied, so later
+	// edits to it don't change what this application meant
+	PresetVersion int       `json:"presetVersion,omitempty" bson:"presetVersion,omitempty"`
+	AppliedAt     time.Time `json:"appliedAt" bson:"appliedAt"`
 }
 
 // FilterSuggestion represents AI-generated filter recommendations
@@ -136,8 +316,32 @@ const (
 type ApplyFilterRequest struct {
 	FilterID     primitive.ObjectID `json:"filterId" binding:"required"`
 	CustomConfig *FilterConfig      `json:"customConfig,omitempty"`
+	// Mask restricts this application to part of the image, replacing any
+	// mask from the preset or CustomConfig
+	Mask   *MaskConfig    `json:"mask,omitempty"`
+	Output *OutputOptions `json:"output,omitempty"`
 }
 
+// OutputOptions controls how a processed image is encoded
+type OutputOptions struct {
+	Format       string `json:"format,omitempty"`       // jpeg, png, webp, avif; empty keeps the source format
+	Quality      *int   `json:"quality,omitempty"`      // 1-100, lossy encoders only
+	Lossless     bool   `json:"lossless,omitempty"`     // webp and avif only
+	Effort       *int   `json:"effort,omitempty"`       // 0-10, higher is slower and smaller
+	AlphaQuality *int   `json:"alphaQuality,omitempty"` // 0-100, webp and avif only
+	StripAlpha   *bool  `json:"stripAlpha,omitempty"`   // flatten transparency onto white
+	ColorSpace   string `json:"colorSpace,omitempty"`   // "source" (default) or "srgb"
+}
+
+const (
+	// OutputColorSpaceSource keeps wide-gamut output in the source color space
+	// and embeds its ICC profile
+	OutputColorSpaceSource = "source"
+	// OutputColorSpaceSRGB converts output to sRGB for maximum compatibility
+	OutputColorSpaceSRGB = "srgb"
+)
+
+// CreateFilterPresetRequest creates a custom preset, or replaces one in full
 type CreateFilterPresetRequest struct {
 	Name        string         `json:"name" binding:"required"`
 	Category    FilterCategory `json:"category" binding:"required"`
@@ -146,6 +350,146 @@ type CreateFilterPresetRequest struct {
 	Config      FilterConfig   `json:"config" binding:"required"`
 }
 
+// DuplicateFilterPresetRequest copies a preset into a new custom preset.
+// Name defaults to the source's name with " (copy)" appended.
+type DuplicateFilterPresetRequest struct {
+	Name string `json:"name"`
+}
+
+// SetPresetVisibilityRequest publishes a custom preset to the gallery or
+// makes it private again
+type SetPresetVisibilityRequest struct {
+	Visibility PresetVisibility `json:"visibility" binding:"required,oneof=private public"`
+}
+
+// RatePresetRequest rates a public preset from 1 to 5 stars
+type RatePresetRequest struct {
+	Rating int `json:"rating" binding:"required,min=1,max=5"`
+}
+
+// UnpublishPresetRequest is an admin's reason for taking a preset out of
+// the gallery
+type UnpublishPresetRequest struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+// Preset gallery sort orders
+const (
+	GallerySortPopular = "popular"
+	GallerySortRating  = "rating"
+	GallerySortNewest  = "newest"
+)
+
+// PresetGalleryQuery searches the public presets
+type PresetGalleryQuery struct {
+	Category string `form:"category"`
+	Type     string `form:"type"`
+	Search   string `form:"search"`
+	Sort     string `form:"sort"`
+	Page     int    `form:"page"`
+	Limit    int    `form:"limit"`
+}
+
+// GalleryPreset is a public preset with how often it has been applied
+type GalleryPreset struct {
+	FilterPreset `bson:",inline"`
+	UsageCount   int `json:"usageCount" bson:"usageCount"`
+	// MyRating is the requesting user's rating, if they rated it
+	MyRating int `json:"myRating,omitempty" bson:"-"`
+}
+
+// FilterPresetRating is one user's rating of a public preset
+type FilterPresetRating struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	PresetID  primitive.ObjectID `json:"presetId" bson:"presetId"`
+	UserID    primitive.ObjectID `json:"userId" bson:"userId"`
+	Rating    int                `json:"rating" bson:"rating"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// PresetBundleSchema is the version of the preset bundle format
+const PresetBundleSchema = 1
+
+// PresetBundle is a portable export of presets together with the uploaded
+// LUTs and masks they reference
+type PresetBundle struct {
+	SchemaVersion int            `json:"schemaVersion"`
+	ExportedAt    time.Time      `json:"exportedAt"`
+	Presets       []BundlePreset `json:"presets"`
+	LUTs          []BundleAsset  `json:"luts,omitempty"`
+	Masks         []BundleAsset  `json:"masks,omitempty"`
+}
+
+// BundlePreset is a preset in a bundle. Configs keep referring to LUTs and
+// masks by the IDs they had where the bundle was exported.
+type BundlePreset struct {
+	ID          string         `json:"id"`
+	Version     int            `json:"version,omitempty"`
+	Name        string         `json:"name"`
+	Category    FilterCategory `json:"category"`
+	Type        string         `json:"type"`
+	Description string         `json:"description"`
+	Config      FilterConfig   `json:"config"`
+	Thumbnail   *BundleAsset   `json:"thumbnail,omitempty"`
+}
+
+// BundleAsset is a file embedded in a bundle, base64-encoded in JSON
+type BundleAsset struct {
+	ID       string `json:"id,omitempty"`
+	Name     string `json:"name,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+	Data     []byte `json:"data"`
+}
+
+type ExportPresetsRequest struct {
+	PresetIDs []primitive.ObjectID `json:"presetIds" binding:"required,min=1,max=100"`
+}
+
+// PresetExportResult is an exported bundle and every asset that had to be
+// left out of it
+type PresetExportResult struct {
+	Bundle  *PresetBundle       `json:"bundle"`
+	Skipped []PresetExportIssue `json:"skipped"`
+}
+
+// PresetExportIssue is a LUT, mask or thumbnail missing from a bundle
+type PresetExportIssue struct {
+	Preset string `json:"preset"`
+	Asset  string `json:"asset"` // lut, mask or thumbnail
+	ID     string `json:"id,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// PresetImportResult lists the presets an import created and every setting
+// that couldn't be carried over
+type PresetImportResult struct {
+	Presets     []FilterPreset      `json:"presets"`
+	Unsupported []PresetImportIssue `json:"unsupported"`
+}
+
+// PresetImportIssue is a setting that was left out of an imported preset
+type PresetImportIssue struct {
+	Preset  string `json:"preset"`
+	Setting string `json:"setting"`
+	Value   string `json:"value,omitempty"`
+	Reason  string `json:"reason"`
+}
+
+// FilterPresetVersion is a snapshot of a custom preset as it was at one
+// version, kept after the preset is edited or deleted
+type FilterPresetVersion struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	PresetID    primitive.ObjectID `json:"presetId" bson:"presetId"`
+	Version     int                `json:"version" bson:"version"`
+	Name        string             `json:"name" bson:"name"`
+	Category    FilterCategory     `json:"category" bson:"category"`
+	Type        string             `json:"type" bson:"type"`
+	Description string             `json:"description" bson:"description"`
+	Config      FilterConfig       `json:"config" bson:"config"`
+	CreatedAt   time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
 type FilterSuggestionResponse struct {
 	Suggestions []EnrichedFilterSuggestion `json:"suggestions"`
 	MediaID     primitive.ObjectID         `json:"mediaId"`
@@ -154,6 +498,8 @@ type FilterSuggestionResponse struct {
 type EnrichedFilterSuggestion struct {
 	FilterSuggestion
 	Filter FilterPreset `json:"filter"`
+	// Preview is the preset rendered on the media itself, as a data URI
+	Preview string `json:"preview,omitempty"`
 }
 
 type FilterAnalytics struct {
@@ -174,3 +520,35 @@ type RecentFilterApplication struct {
 	Filter FilterPreset `json:"filter"`
 	Media  MediaFile    `json:"media"`
 }
+
+// LUT is a 3D color lookup table uploaded as a .cube file. Effects of type
+// "lut" reference it by ID in their "lut" param.
+type LUT struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `json:"userId" bson:"userId"`
+	Name      string             `json:"name" bson:"name"`
+	Title     string             `json:"title,omitempty" bson:"title,omitempty"`
+	Size      int                `json:"size" bson:"size"` // grid points per axis
+	FileName  string             `json:"-" bson:"fileName"`
+	FileSize  int64              `json:"fileSize" bson:"fileSize"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+// BuiltinLUT is a LUT shipped with the server, referenced by Name
+type BuiltinLUT struct {
+	Name  string `json:"name"`
+	Title string `json:"title"`
+	Size  int    `json:"size"`
+}
+
+// FilterMask is an uploaded grayscale mask image, referenced from
+// MaskConfig.MaskID
+type FilterMask struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `json:"userId" bson:"userId"`
+	Name      string             `json:"name" bson:"name"`
+	Width     int                `json:"width" bson:"width"`
+	Height    int                `json:"height" bson:"height"`
+	FileName  string             `json:"-" bson:"fileName"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+}
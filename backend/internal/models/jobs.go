@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Job statuses
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+)
+
+// Job item statuses
+const (
+	JobItemPending = "pending"
+	JobItemDone    = "done"
+	JobItemFailed  = "failed"
+)
+
+// Where batch results go
+const (
+	BatchSaveMedia = "media" // a new media item per input
+	BatchSaveEdits = "edits" // a filter step appended to each input's edit stack
+)
+
+// FilterJob applies a filter to many media items in the background. A
+// completed job may still have failed items; see Failed and Items.
+type FilterJob struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID       primitive.ObjectID `json:"userId" bson:"userId"`
+	FilterID     primitive.ObjectID `json:"filterId" bson:"filterId"`
+	CustomConfig *FilterConfig      `json:"customConfig,omitempty" bson:"customConfig,omitempty"`
+	SaveAs       string             `json:"saveAs" bson:"saveAs"`
+	Output       *OutputOptions     `json:"output,omitempty" bson:"output,omitempty"`
+	Status       string             `json:"status" bson:"status"`
+	Error        string             `json:"error,omitempty" bson:"error,omitempty"`
+	Total        int                `json:"total" bson:"total"`
+	Processed    int                `json:"processed" bson:"processed"`
+	Succeeded    int                `json:"succeeded" bson:"succeeded"`
+	Failed       int                `json:"failed" bson:"failed"`
+	Items        []JobItem          `json:"items" bson:"items"`
+	CreatedAt    time.Time          `json:"createdAt" bson:"createdAt"`
+	StartedAt    *time.Time         `json:"startedAt,omitempty" bson:"startedAt,omitempty"`
+	FinishedAt   *time.Time         `json:"finishedAt,omitempty" bson:"finishedAt,omitempty"`
+}
+
+// JobItem is the outcome for one media item of a job. ResultID is the new
+// media item when saving as media.
+type JobItem struct {
+	MediaID  primitive.ObjectID  `json:"mediaId" bson:"mediaId"`
+	Status   string              `json:"status" bson:"status"`
+	ResultID *primitive.ObjectID `json:"resultId,omitempty" bson:"resultId,omitempty"`
+	Error    string              `json:"error,omitempty" bson:"error,omitempty"`
+}
+
+// BatchFilterRequest selects media by ID, or by category and/or search
+// query, and applies a filter to all of them
+type BatchFilterRequest struct {
+	FilterID     primitive.ObjectID `json:"filterId" binding:"required"`
+	CustomConfig *FilterConfig      `json:"customConfig,omitempty"`
+	MediaIDs     []string           `json:"mediaIds,omitempty"`
+	Category     string             `json:"category,omitempty"`
+	Search       string             `json:"search,omitempty"`
+	SaveAs       string             `json:"saveAs,omitempty"` // "media" (default) or "edits"
+	Output       *OutputOptions     `json:"output,omitempty"`
+}
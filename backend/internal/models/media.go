@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -32,6 +33,97 @@ type MediaFile struct {
 	DominantColors    []string            `json:"dominantColors,omitempty" bson:"dominantColors,omitempty"`
 	AnalysisComplete  bool                `json:"analysisComplete" bson:"analysisComplete"`
 	AnalysisError     *string             `json:"analysisError,omitempty" bson:"analysisError,omitempty"`
+
+	// Format detection and derived renditions
+	OriginalFormat string                  `json:"originalFormat,omitempty" bson:"originalFormat,omitempty"` // e.g. jpeg, heic, cr2
+	ColorSpace     string                  `json:"colorSpace,omitempty" bson:"colorSpace,omitempty"`         // e.g. srgb, display-p3, adobe-rgb
+	Orientation    int                     `json:"orientation,omitempty" bson:"orientation,omitempty"`       // EXIF orientation (1-8) applied when decoding the original
+	Variants       map[string]MediaVariant `json:"variants,omitempty" bson:"variants,omitempty"`
+	ContentVersion int                     `json:"contentVersion,omitempty" bson:"contentVersion,omitempty"` // bumped when the original or its variants are rewritten in place
+
+	// Non-destructive editing
+	Edits       *EditStack          `json:"edits,omitempty" bson:"edits,omitempty"`
+	DerivedFrom *primitive.ObjectID `json:"derivedFrom,omitempty" bson:"derivedFrom,omitempty"` // set on edited exports and batch filter results
+
+	// Public media is served to anyone by the public delivery endpoint
+	Public bool `json:"public" bson:"public,omitempty"`
+}
+
+const (
+	// VariantDeveloped is a full-resolution JPEG/WebP rendition of an original
+	// browsers and image decoders can't read (HEIC, camera RAW)
+	VariantDeveloped = "developed"
+	// VariantRaster is a PNG preview of an SVG, used for grids and filters
+	VariantRaster = "raster"
+)
+
+// MediaVariant is a rendition derived from the original and stored next to it
+type MediaVariant struct {
+	FileName string `json:"fileName" bson:"fileName"`
+	MimeType string `json:"mimeType" bson:"mimeType"`
+	Width    int    `json:"width" bson:"width"`
+	Height   int    `json:"height" bson:"height"`
+	Size     int64  `json:"size" bson:"size"`
+	URL      string `json:"url,omitempty" bson:"-"`
+}
+
+// SetVariant records a derived rendition
+func (m *MediaFile) SetVariant(name string, variant MediaVariant) {
+	if m.Variants == nil {
+		m.Variants = make(map[string]MediaVariant)
+	}
+	m.Variants[name] = variant
+}
+
+// WorkingFileName returns the object that should be decoded for display,
+// filtering and analysis: the developed rendition if there is one, otherwise
+// the original
+func (m *MediaFile) WorkingFileName() string {
+	if v, ok := m.workingVariant(); ok {
+		return v.FileName
+	}
+	return m.FileName
+}
+
+// WorkingMimeType is the content type of WorkingFileName
+func (m *MediaFile) WorkingMimeType() string {
+	if v, ok := m.workingVariant(); ok {
+		return v.MimeType
+	}
+	return m.MimeType
+}
+
+// WorkingOrientation is the orientation to apply when decoding
+// WorkingFileName. Variants are stored upright; 0 means "use the file's own
+// EXIF orientation".
+func (m *MediaFile) WorkingOrientation() int {
+	if _, ok := m.workingVariant(); ok {
+		return 1
+	}
+	return m.Orientation
+}
+
+// IsSVG reports whether the original is an SVG document
+func (m *MediaFile) IsSVG() bool {
+	return m.OriginalFormat == "svg" || strings.Contains(m.MimeType, "svg")
+}
+
+func (m *MediaFile) workingVariant() (MediaVariant, bool) {
+	for _, name := range []string{VariantDeveloped, VariantRaster} {
+		if v, ok := m.Variants[name]; ok {
+			return v, true
+		}
+	}
+	return MediaVariant{}, false
+}
+
+// VariantFileNames lists every derived object stored for this media
+func (m *MediaFile) VariantFileNames() []string {
+	names := make([]string, 0, len(m.Variants))
+	for _, v := range m.Variants {
+		names = append(names, v.FileName)
+	}
+	return names
 }
 
 type AIAnalysisMetadata struct {
@@ -53,8 +145,27 @@ type UpdateMediaRequest struct {
 	Description *string  `json:"description"`
 	Category    *string  `json:"category"`
 	Tags        []string `json:"tags"`
+	Public      *bool    `json:"public"`
 }
 
+// ExportMediaRequest selects the media to bundle into a ZIP archive
+type ExportMediaRequest struct {
+	IDs []string `json:"ids" binding:"required,min=1,max=500"`
+}
+
+// RotateMediaRequest turns an image clockwise. Mode is "auto" (default:
+// lossless for JPEG when possible, metadata otherwise), "lossless" or "metadata".
+type RotateMediaRequest struct {
+	Degrees int    `json:"degrees" binding:"required"`
+	Mode    string `json:"mode"`
+}
+
+const (
+	RotateModeAuto     = "auto"
+	RotateModeLossless = "lossless"
+	RotateModeMetadata = "metadata"
+)
+
 type MediaResponse struct {
 	ID           primitive.ObjectID `json:"id"`
 	FileName     string             `json:"fileName"`
@@ -0,0 +1,288 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"mediaVault-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	jobCollection = "filter_jobs"
+	// MaxBatchItems bounds how many media items one job may cover
+	MaxBatchItems = 500
+	// batchConcurrency is how many items are processed at once across all
+	// jobs; each render already uses every core for its pixel passes
+	batchConcurrency = 2
+	// batchItemTimeout bounds processing one item, so a stuck decoder or
+	// encoder fails that item instead of holding a slot forever
+	batchItemTimeout = 5 * time.Minute
+)
+
+// ErrInvalidBatch is returned for batch requests that can't be queued
+var ErrInvalidBatch = errors.New("invalid batch")
+
+// BatchService runs filter jobs over many media items in the background
+type BatchService struct {
+	dbSvc     *DatabaseService
+	filterSvc *FilterService
+	editSvc   *EditService
+	// slots limits items in flight across all jobs
+	slots chan struct{}
+}
+
+func NewBatchService(dbSvc *DatabaseService, filterSvc *FilterService, editSvc *EditService) *BatchService {
+	bs := &BatchService{
+		dbSvc:     dbSvc,
+		filterSvc: filterSvc,
+		editSvc:   editSvc,
+		slots:     make(chan struct{}, batchConcurrency),
+	}
+
+	// Jobs run in this process, so any left unfinished died with the last one
+	bs.failInterruptedJobs()
+
+	return bs
+}
+
+// CreateBatch resolves the media a request selects, records the job and
+// starts it. Requests that can't be run wrap ErrInvalidBatch.
+func (bs *BatchService) CreateBatch(ctx context.Context, userID primitive.ObjectID, req models.BatchFilterRequest) (*models.FilterJob, error) {
+	if req.SaveAs == "" {
+		req.SaveAs = models.BatchSaveMedia
+	}
+	if req.SaveAs != models.BatchSaveMedia && req.SaveAs != models.BatchSaveEdits {
+		return nil, fmt.Errorf("%w: saveAs must be %q or %q", ErrInvalidBatch, models.BatchSaveMedia, models.BatchSaveEdits)
+	}
+	if req.Output != nil {
+		if err := ValidateOutputOptions(*req.Output); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBatch, err)
+		}
+	}
+	if _, err := bs.filterSvc.getAccessiblePreset(ctx, req.FilterID, userID); err != nil {
+		return nil, fmt.Errorf("%w: filter not found", ErrInvalidBatch)
+	}
+
+	mediaIDs, err := bs.selectMedia(ctx, userID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &models.FilterJob{
+		ID:           primitive.NewObjectID(),
+		UserID:       userID,
+		FilterID:     req.FilterID,
+		CustomConfig: req.CustomConfig,
+		SaveAs:       req.SaveAs,
+		Output:       req.Output,
+		Status:       models.JobQueued,
+		Total:        len(mediaIDs),
+		Items:        make([]models.JobItem, len(mediaIDs)),
+		CreatedAt:    time.Now(),
+	}
+	for i, id := range mediaIDs {
+		job.Items[i] = models.JobItem{MediaID: id, Status: models.JobItemPending}
+	}
+	if _, err := bs.jobs().InsertOne(ctx, job); err != nil {
+		return nil, fmt.Errorf("failed to create job: %w", err)
+	}
+
+	go bs.run(*job)
+	return job, nil
+}
+
+// GetJob returns one of the user's jobs, or nil if there's no such job
+func (bs *BatchService) GetJob(ctx context.Context, userID, jobID primitive.ObjectID) (*models.FilterJob, error) {
+	var job models.FilterJob
+	err := bs.jobs().FindOne(ctx, bson.M{"_id": jobID, "userId": userID}).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+	return &job, nil
+}
+
+// selectMedia returns the IDs a request names, or the user's images
+// matching its category and search query
+func (bs *BatchService) selectMedia(ctx context.Context, userID primitive.ObjectID, req models.BatchFilterRequest) ([]primitive.ObjectID, error) {
+	if len(req.MediaIDs) > 0 {
+		if req.Category != "" || req.Search != "" {
+			return nil, fmt.Errorf("%w: select media by ID or by category and search, not both", ErrInvalidBatch)
+		}
+		if len(req.MediaIDs) > MaxBatchItems {
+			return nil, fmt.Errorf("%w: a batch is limited to %d items", ErrInvalidBatch, MaxBatchItems)
+		}
+		seen := make(map[primitive.ObjectID]bool, len(req.MediaIDs))
+		ids := make([]primitive.ObjectID, 0, len(req.MediaIDs))
+		for _, hex := range req.MediaIDs {
+			id, err := primitive.ObjectIDFromHex(hex)
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid media ID %q", ErrInvalidBatch, hex)
+			}
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		return ids, nil
+	}
+
+	if req.Category == "" && req.Search == "" {
+		return nil, fmt.Errorf("%w: mediaIds, category or search is required", ErrInvalidBatch)
+	}
+	query := models.MediaQuery{Category: req.Category, Search: req.Search, Type: "image", Limit: 100}
+	var ids []primitive.ObjectID
+	for query.Page = 1; ; query.Page++ {
+		page, err := bs.dbSvc.ListMediaFiles(ctx, userID, query)
+		if err != nil {
+			return nil, err
+		}
+		for _, media := range page {
+			ids = append(ids, media.ID)
+		}
+		if len(ids) > MaxBatchItems {
+			return nil, fmt.Errorf("%w: more than %d media items match; narrow the selection", ErrInvalidBatch, MaxBatchItems)
+		}
+		if len(page) < query.Limit {
+			break
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("%w: no images match the selection", ErrInvalidBatch)
+	}
+	return ids, nil
+}
+
+// run processes a job's items, recording each outcome as it finishes
+func (bs *BatchService) run(job models.FilterJob) {
+	ctx := context.Background()
+
+	started := time.Now()
+	bs.updateJob(ctx, job.ID, bson.M{"$set": bson.M{"status": models.JobRunning, "startedAt": started}})
+
+	preset, err := bs.filterSvc.getAccessiblePreset(ctx, job.FilterID, job.UserID)
+	if err != nil {
+		finished := time.Now()
+		bs.updateJob(ctx, job.ID, bson.M{"$set": bson.M{
+			"status":     models.JobFailed,
+			"error":      fmt.Sprintf("failed to get filter preset: %v", err),
+			"finishedAt": finished,
+		}})
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i, item := range job.Items {
+		bs.slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-bs.slots
+				wg.Done()
+			}()
+
+			itemCtx, cancel := context.WithTimeout(ctx, batchItemTimeout)
+			resultID, err := bs.processItem(itemCtx, job, preset, item.MediaID)
+			cancel()
+			if errors.Is(err, context.DeadlineExceeded) {
+				err = fmt.Errorf("timed out after %s", batchItemTimeout)
+			}
+			item.ResultID = resultID
+			counter := "succeeded"
+			item.Status = models.JobItemDone
+			if err != nil {
+				counter = "failed"
+				item.Status = models.JobItemFailed
+				item.Error = err.Error()
+			}
+			bs.updateJob(ctx, job.ID, bson.M{
+				"$set": bson.M{fmt.Sprintf("items.%d", i): item},
+				"$inc": bson.M{"processed": 1, counter: 1},
+			})
+		}()
+	}
+	wg.Wait()
+
+	finished := time.Now()
+	bs.updateJob(ctx, job.ID, bson.M{"$set": bson.M{"status": models.JobCompleted, "finishedAt": finished}})
+}
+
+// processItem applies the job's filter to one media item
+func (bs *BatchService) processItem(ctx context.Context, job models.FilterJob, preset *models.FilterPreset, mediaID primitive.ObjectID) (*primitive.ObjectID, error) {
+	media, err := bs.dbSvc.GetMediaFileByID(ctx, mediaID.Hex())
+	if err != nil || media.UserID != job.UserID {
+		return nil, fmt.Errorf("media not found")
+	}
+	if !IsImageUpload(media.MimeType, media.OriginalName) || media.IsSVG() {
+		return nil, fmt.Errorf("filters can only be applied to raster images")
+	}
+
+	if job.SaveAs == models.BatchSaveEdits {
+		var steps []models.EditStep
+		if media.Edits != nil {
+			steps = append(steps, media.Edits.Steps...)
+		}
+		filterID := job.FilterID
+		steps = append(steps, models.EditStep{Type: models.EditStepFilter, FilterID: &filterID, Config: job.CustomConfig})
+		if err := bs.editSvc.SaveEdits(ctx, media, steps); err != nil {
+			return nil, err
+		}
+		// Render now so failures show up in the job and the result is cached
+		if _, err := bs.editSvc.Render(ctx, media); err != nil {
+			return nil, err
+		}
+		bs.filterSvc.recordFilterApplication(ctx, media.ID, job.UserID, preset, job.CustomConfig)
+		return nil, nil
+	}
+
+	output := models.OutputOptions{}
+	if job.Output != nil {
+		output = *job.Output
+	}
+	result, err := bs.filterSvc.ApplyFilter(ctx, media.ID, job.FilterID, job.UserID, job.CustomConfig, output)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered := &RenderedMedia{Data: result.Data, Format: result.Format, MimeType: MimeTypeForFormat(result.Format)}
+	derived, err := bs.editSvc.saveFiltered(ctx, media, rendered, preset.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &derived.ID, nil
+}
+
+func (bs *BatchService) updateJob(ctx context.Context, jobID primitive.ObjectID, update bson.M) {
+	if _, err := bs.jobs().UpdateOne(ctx, bson.M{"_id": jobID}, update); err != nil {
+		log.Printf("Failed to update job %s: %v", jobID.Hex(), err)
+	}
+}
+
+func (bs *BatchService) failInterruptedJobs() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"status": bson.M{"$in": []string{models.JobQueued, models.JobRunning}}}
+	update := bson.M{"$set": bson.M{
+		"status":     models.JobFailed,
+		"error":      "interrupted by a server restart",
+		"finishedAt": time.Now(),
+	}}
+	if _, err := bs.jobs().UpdateMany(ctx, filter, update); err != nil {
+		log.Printf("Failed to mark interrupted jobs: %v", err)
+	}
+}
+
+func (bs *BatchService) jobs() *mongo.Collection {
+	return bs.dbSvc.GetDatabase().Collection(jobCollection)
+}
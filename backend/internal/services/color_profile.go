@@ -0,0 +1,601 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// Color space identifiers recorded on MediaFile.ColorSpace
+const (
+	ColorSpaceSRGB      = "srgb"
+	ColorSpaceDisplayP3 = "display-p3"
+	ColorSpaceAdobeRGB  = "adobe-rgb"
+	ColorSpaceProPhoto  = "prophoto-rgb"
+	ColorSpaceRec2020   = "rec2020"
+	ColorSpaceUnknown   = "unknown"
+)
+
+// colorProfile is the subset of an ICC profile needed for matrix/TRC
+// conversions. LUT-based profiles are recognised but not converted.
+type colorProfile struct {
+	Data         []byte
+	Description  string
+	ColorSpace   string
+	toXYZ        [9]float64 // linear RGB -> PCS XYZ (D50)
+	trc          [3]toneCurve
+	matrixShaper bool
+}
+
+// toneCurve is an ICC curv/para transfer function mapping encoded values to
+// linear light
+type toneCurve struct {
+	gamma  float64
+	table  []float64
+	params []float64 // parametric function type 0-4, see ICC.1 10.18
+}
+
+// Known primaries (rXYZ, gXYZ, bXYZ adapted to D50) used to identify
+// profiles whose description tag is missing or localised
+var knownPrimaries = map[string][9]float64{
+	ColorSpaceSRGB:      {0.4361, 0.2225, 0.0139, 0.3851, 0.7169, 0.0971, 0.1431, 0.0606, 0.7141},
+	ColorSpaceDisplayP3: {0.5151, 0.2412, -0.0011, 0.2920, 0.6922, 0.0419, 0.1571, 0.0666, 0.7841},
+	ColorSpaceAdobeRGB:  {0.6097, 0.3111, 0.0195, 0.2053, 0.6257, 0.0609, 0.1492, 0.0632, 0.7446},
+	ColorSpaceProPhoto:  {0.7977, 0.2880, 0.0000, 0.1352, 0.7119, 0.0000, 0.0313, 0.0001, 0.8249},
+	ColorSpaceRec2020:   {0.6734, 0.2790, -0.0019, 0.1656, 0.6753, 0.0300, 0.1251, 0.0457, 0.7973},
+}
+
+// srgbProfile is the implicit profile of untagged images and the target of
+// sRGB output conversion
+var srgbProfile = &colorProfile{
+	Description:  "sRGB IEC61966-2.1",
+	ColorSpace:   ColorSpaceSRGB,
+	toXYZ:        knownPrimaries[ColorSpaceSRGB],
+	trc:          [3]toneCurve{srgbCurve(), srgbCurve(), srgbCurve()},
+	matrixShaper: true,
+}
+
+func srgbCurve() toneCurve {
+	return toneCurve{params: []float64{2.4, 1 / 1.055, 0.055 / 1.055, 1 / 12.92, 0.04045}}
+}
+
+// needsConversion reports whether pixels in this profile differ from sRGB
+// enough to require color management
+func (p *colorProfile) needsConversion() bool {
+	return p != nil && p.matrixShaper && p.ColorSpace != ColorSpaceSRGB
+}
+
+// colorSpaceOf returns the identifier recorded for a decoded profile;
+// untagged images are assumed to be sRGB
+func colorSpaceOf(p *colorProfile) string {
+	if p == nil {
+		return ColorSpaceSRGB
+	}
+	return p.ColorSpace
+}
+
+// extractICCProfile returns the embedded ICC profile of a JPEG, PNG or WebP
+// file, or nil if there is none
+func extractICCProfile(data []byte) []byte {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8}):
+		return extractJPEGICC(data)
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return extractPNGICC(data)
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return extractWebPICC(data)
+	}
+	return nil
+}
+
+func extractJPEGICC(data []byte) []byte {
+	chunks := map[int][]byte{}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			break
+		}
+		marker := data[i+1]
+		if marker == 0xD8 || (marker >= 0xD0 && marker <= 0xD7) {
+			i += 2
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			break
+		}
+		segment := data[i+4 : end]
+		if marker == 0xE2 && len(segment) > 14 && string(segment[:12]) == "ICC_PROFILE\x00" {
+			chunks[int(segment[12])] = segment[14:]
+		}
+		i = end
+	}
+
+	if len(chunks) == 0 {
+		return nil
+	}
+	seqs := make([]int, 0, len(chunks))
+	for seq := range chunks {
+		seqs = append(seqs, seq)
+	}
+	sort.Ints(seqs)
+
+	var profile []byte
+	for _, seq := range seqs {
+		profile = append(profile, chunks[seq]...)
+	}
+	return profile
+}
+
+func extractPNGICC(data []byte) []byte {
+	for i := 8; i+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		chunkType := string(data[i+4 : i+8])
+		if i+12+length > len(data) {
+			break
+		}
+		if chunkType == "iCCP" {
+			body := data[i+8 : i+8+length]
+			nul := bytes.IndexByte(body, 0)
+			if nul < 0 || nul+2 > len(body) {
+				return nil
+			}
+			r, err := zlib.NewReader(bytes.NewReader(body[nul+2:]))
+			if err != nil {
+				return nil
+			}
+			defer r.Close()
+			profile, err := io.ReadAll(r)
+			if err != nil {
+				return nil
+			}
+			return profile
+		}
+		if chunkType == "IDAT" {
+			break
+		}
+		i += 12 + length
+	}
+	return nil
+}
+
+func extractWebPICC(data []byte) []byte {
+	for i := 12; i+8 <= len(data); {
+		length := int(binary.LittleEndian.Uint32(data[i+4:]))
+		if i+8+length > len(data) {
+			break
+		}
+		if string(data[i:i+4]) == "ICCP" {
+			return data[i+8 : i+8+length]
+		}
+		i += 8 + length + length%2
+	}
+	return nil
+}
+
+// parseICCProfile reads the header, description, primaries and tone curves of
+// an ICC profile
+func parseICCProfile(data []byte) (*colorProfile, error) {
+	if len(data) < 132 || string(data[36:40]) != "acsp" {
+		return nil, fmt.Errorf("not an ICC profile")
+	}
+
+	profile := &colorProfile{Data: data, ColorSpace: ColorSpaceUnknown}
+	if string(data[16:20]) != "RGB " {
+		profile.Description = strings.TrimSpace(string(data[16:20]))
+		return profile, nil
+	}
+
+	tags := map[string][]byte{}
+	count := int(binary.BigEndian.Uint32(data[128:]))
+	for i := 0; i < count && 132+i*12+12 <= len(data); i++ {
+		entry := data[132+i*12:]
+		offset := int(binary.BigEndian.Uint32(entry[4:]))
+		size := int(binary.BigEndian.Uint32(entry[8:]))
+		if offset+size <= len(data) {
+			tags[string(entry[:4])] = data[offset : offset+size]
+		}
+	}
+
+	profile.Description = parseICCText(tags["desc"])
+
+	rXYZ, okR := parseICCXYZ(tags["rXYZ"])
+	gXYZ, okG := parseICCXYZ(tags["gXYZ"])
+	bXYZ, okB := parseICCXYZ(tags["bXYZ"])
+	rTRC, okRT := parseICCCurve(tags["rTRC"])
+	gTRC, okGT := parseICCCurve(tags["gTRC"])
+	bTRC, okBT := parseICCCurve(tags["bTRC"])
+
+	if okR && okG && okB && okRT && okGT && okBT {
+		profile.matrixShaper = true
+		profile.toXYZ = [9]float64{rXYZ[0], rXYZ[1], rXYZ[2], gXYZ[0], gXYZ[1], gXYZ[2], bXYZ[0], bXYZ[1], bXYZ[2]}
+		profile.trc = [3]toneCurve{rTRC, gTRC, bTRC}
+	}
+
+	profile.ColorSpace = identifyColorSpace(profile)
+	return profile, nil
+}
+
+// identifyColorSpace matches primaries against well-known spaces, falling
+// back to the profile description
+func identifyColorSpace(p *colorProfile) string {
+	if p.matrixShaper {
+		for name, primaries := range knownPrimaries {
+			match := true
+			for i := range primaries {
+				if math.Abs(primaries[i]-p.toXYZ[i]) > 0.003 {
+					match = false
+					break
+				}
+			}
+			if match {
+				return name
+			}
+		}
+	}
+
+	desc := strings.ToLower(p.Description)
+	switch {
+	case strings.Contains(desc, "srgb"):
+		return ColorSpaceSRGB
+	case strings.Contains(desc, "p3"):
+		return ColorSpaceDisplayP3
+	case strings.Contains(desc, "adobe rgb"):
+		return ColorSpaceAdobeRGB
+	case strings.Contains(desc, "prophoto"):
+		return ColorSpaceProPhoto
+	case strings.Contains(desc, "2020"):
+		return ColorSpaceRec2020
+	}
+	return ColorSpaceUnknown
+}
+
+func parseICCText(tag []byte) string {
+	if len(tag) < 12 {
+		return ""
+	}
+	switch string(tag[:4]) {
+	case "desc":
+		n := int(binary.BigEndian.Uint32(tag[8:]))
+		if 12+n <= len(tag) {
+			return strings.TrimRight(string(tag[12:12+n]), "\x00")
+		}
+	case "mluc":
+		if len(tag) < 28 {
+			return ""
+		}
+		length := int(binary.BigEndian.Uint32(tag[20:]))
+		offset := int(binary.BigEndian.Uint32(tag[24:]))
+		if offset+length > len(tag) {
+			return ""
+		}
+		units := make([]uint16, length/2)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(tag[offset+i*2:])
+		}
+		return string(utf16.Decode(units))
+	case "text":
+		return strings.TrimRight(string(tag[8:]), "\x00")
+	}
+	return ""
+}
+
+func parseICCXYZ(tag []byte) ([3]float64, bool) {
+	if len(tag) < 20 || string(tag[:4]) != "XYZ " {
+		return [3]float64{}, false
+	}
+	return [3]float64{s15Fixed16(tag[8:]), s15Fixed16(tag[12:]), s15Fixed16(tag[16:])}, true
+}
+
+func parseICCCurve(tag []byte) (toneCurve, bool) {
+	if len(tag) < 12 {
+		return toneCurve{}, false
+	}
+	switch string(tag[:4]) {
+	case "curv":
+		n := int(binary.BigEndian.Uint32(tag[8:]))
+		switch {
+		case n == 0:
+			return toneCurve{gamma: 1}, true
+		case n == 1 && len(tag) >= 14:
+			return toneCurve{gamma: float64(binary.BigEndian.Uint16(tag[12:])) / 256}, true
+		case len(tag) >= 12+2*n:
+			table := make([]float64, n)
+			for i := range table {
+				table[i] = float64(binary.BigEndian.Uint16(tag[12+2*i:])) / 65535
+			}
+			return toneCurve{table: table}, true
+		}
+	case "para":
+		counts := []int{1, 3, 4, 5, 7}
+		fn := int(binary.BigEndian.Uint16(tag[8:]))
+		if fn >= len(counts) || len(tag) < 12+4*counts[fn] {
+			return toneCurve{}, false
+		}
+		params := make([]float64, counts[fn])
+		for i := range params {
+			params[i] = s15Fixed16(tag[12+4*i:])
+		}
+		return toneCurve{params: params}, true
+	}
+	return toneCurve{}, false
+}
+
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+// toLinear maps an encoded value in [0,1] to linear light
+func (c toneCurve) toLinear(v float64) float64 {
+	switch {
+	case c.table != nil:
+		pos := v * float64(len(c.table)-1)
+		i := int(pos)
+		if i >= len(c.table)-1 {
+			return c.table[len(c.table)-1]
+		}
+		frac := pos - float64(i)
+		return c.table[i]*(1-frac) + c.table[i+1]*frac
+	case c.params != nil:
+		p := c.params
+		g := p[0]
+		switch len(p) {
+		case 1:
+			return math.Pow(v, g)
+		case 3:
+			if v >= -p[2]/p[1] {
+				return math.Pow(p[1]*v+p[2], g)
+			}
+			return 0
+		case 4:
+			if v >= -p[2]/p[1] {
+				return math.Pow(p[1]*v+p[2], g) + p[3]
+			}
+			return p[3]
+		case 5:
+			if v >= p[4] {
+				return math.Pow(p[1]*v+p[2], g)
+			}
+			return p[3] * v
+		case 7:
+			if v >= p[4] {
+				return math.Pow(p[1]*v+p[2], g) + p[5]
+			}
+			return p[3]*v + p[6]
+		}
+	}
+	return math.Pow(v, c.gamma)
+}
+
+// fromLinear inverts toLinear by bisection; curves are monotonic
+func (c toneCurve) fromLinear(v float64) float64 {
+	if c.table == nil && c.params == nil && c.gamma > 0 {
+		return math.Pow(v, 1/c.gamma)
+	}
+	lo, hi := 0.0, 1.0
+	for i := 0; i < 24; i++ {
+		mid := (lo + hi) / 2
+		if c.toLinear(mid) < v {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2
+}
+
+// colorTransform converts encoded RGB between two matrix/TRC profiles
+// through linear light
+type colorTransform struct {
+	toLinear   [3][]float64 // per channel, indexed by encoded value * (len-1)
+	matrix     [9]float64
+	fromLinear [3][]float64 // per channel, indexed by sqrt(linear value) * (len-1)
+}
+
+const linearLUTSize = 4096
+
+func newColorTransform(src, dst *colorProfile) *colorTransform {
+	t := &colorTransform{}
+
+	for ch := 0; ch < 3; ch++ {
+		t.toLinear[ch] = make([]float64, linearLUTSize)
+		t.fromLinear[ch] = make([]float64, linearLUTSize)
+		for i := 0; i < linearLUTSize; i++ {
+			v := float64(i) / (linearLUTSize - 1)
+			t.toLinear[ch][i] = src.trc[ch].toLinear(v)
+			// Sampled on a square-root axis, as encoding curves are steep
+			// near black
+			t.fromLinear[ch][i] = clamp01(dst.trc[ch].fromLinear(v * v))
+		}
+	}
+
+	// src RGB -> XYZ -> dst RGB; the matrices are stored column-major
+	// (rXYZ, gXYZ, bXYZ) as they appear in the profile
+	srcM := columnMajorToRows(src.toXYZ)
+	dstInv := invert3x3(columnMajorToRows(dst.toXYZ))
+	t.matrix = multiply3x3(dstInv, srcM)
+
+	return t
+}
+
+// apply converts img into a 16-bit image in the destination space. The
+// source is read at full precision, so 16-bit input survives the round trip.
+func (t *colorTransform) apply(img image.Image) *image.NRGBA64 {
+	src := newRGBBuffer(img)
+	out := image.NewNRGBA64(src.rect)
+	m := t.matrix
+
+	parallelFor(src.h, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			row := out.Pix[y*out.Stride:]
+			for x := 0; x < src.w; x++ {
+				i := y*src.w + x
+				r := lookupCurve(t.toLinear[0], float64(src.pix[i*3]))
+				g := lookupCurve(t.toLinear[1], float64(src.pix[i*3+1]))
+				b := lookupCurve(t.toLinear[2], float64(src.pix[i*3+2]))
+
+				lr := m[0]*r + m[1]*g + m[2]*b
+				lg := m[3]*r + m[4]*g + m[5]*b
+				lb := m[6]*r + m[7]*g + m[8]*b
+
+				p := row[x*8:]
+				putUint16(p, toUint16(lookupCurve(t.fromLinear[0], math.Sqrt(math.Max(0, lr)))))
+				putUint16(p[2:], toUint16(lookupCurve(t.fromLinear[1], math.Sqrt(math.Max(0, lg)))))
+				putUint16(p[4:], toUint16(lookupCurve(t.fromLinear[2], math.Sqrt(math.Max(0, lb)))))
+				putUint16(p[6:], uint16(src.alpha[i])*0x101)
+			}
+		}
+	})
+
+	return out
+}
+
+// lookupCurve evaluates a sampled curve at v in 0..1, interpolating
+// between samples
+func lookupCurve(curve []float64, v float64) float64 {
+	pos := clamp01(v) * float64(len(curve)-1)
+	i := int(pos)
+	if i >= len(curve)-1 {
+		return curve[len(curve)-1]
+	}
+	f := pos - float64(i)
+	return curve[i] + (curve[i+1]-curve[i])*f
+}
+
+// workingProfile is the space filter math runs in for a tagged source: the
+// source primaries, so wide-gamut colors aren't clipped, encoded with the
+// sRGB transfer curve like untagged and sRGB images. Every source is thus
+// filtered on the same encoding, which is also what CSS filters, tone
+// curves and LUTs are defined against; only the conversion into and out of
+// it goes through linear light.
+func workingProfile(src *colorProfile) *colorProfile {
+	return &colorProfile{
+		Description:  src.Description + " (working)",
+		ColorSpace:   src.ColorSpace,
+		toXYZ:        src.toXYZ,
+		trc:          srgbProfile.trc,
+		matrixShaper: true,
+	}
+}
+
+// embedICCProfile adds an ICC profile to an encoded JPEG or PNG. Other formats
+// get their profile from the encoder input (see encodeWithTool).
+func embedICCProfile(encoded []byte, format string, icc []byte) []byte {
+	if len(icc) == 0 {
+		return encoded
+	}
+	switch format {
+	case "jpeg":
+		return embedJPEGICC(encoded, icc)
+	case "png":
+		return embedPNGICC(encoded, icc)
+	}
+	return encoded
+}
+
+func embedJPEGICC(encoded, icc []byte) []byte {
+	const maxChunk = 65519 // 65535 - 2 (length) - 14 (ICC_PROFILE header)
+	chunks := (len(icc) + maxChunk - 1) / maxChunk
+
+	var out bytes.Buffer
+	out.Write(encoded[:2]) // SOI
+	for i := 0; i < chunks; i++ {
+		start := i * maxChunk
+		end := start + maxChunk
+		if end > len(icc) {
+			end = len(icc)
+		}
+		out.Write([]byte{0xFF, 0xE2})
+		binary.Write(&out, binary.BigEndian, uint16(2+14+end-start))
+		out.WriteString("ICC_PROFILE\x00")
+		out.Write([]byte{byte(i + 1), byte(chunks)})
+		out.Write(icc[start:end])
+	}
+	out.Write(encoded[2:])
+	return out.Bytes()
+}
+
+func embedPNGICC(encoded, icc []byte) []byte {
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(icc)
+	zw.Close()
+
+	body := append([]byte("ICC Profile\x00\x00"), compressed.Bytes()...)
+
+	var chunk bytes.Buffer
+	binary.Write(&chunk, binary.BigEndian, uint32(len(body)))
+	chunk.WriteString("iCCP")
+	chunk.Write(body)
+	crc := crc32.NewIEEE()
+	crc.Write([]byte("iCCP"))
+	crc.Write(body)
+	binary.Write(&chunk, binary.BigEndian, crc.Sum32())
+
+	// Insert right after the IHDR chunk (8-byte signature + 25-byte IHDR)
+	const ihdrEnd = 8 + 25
+	if len(encoded) < ihdrEnd {
+		return encoded
+	}
+	out := make([]byte, 0, len(encoded)+chunk.Len())
+	out = append(out, encoded[:ihdrEnd]...)
+	out = append(out, chunk.Bytes()...)
+	return append(out, encoded[ihdrEnd:]...)
+}
+
+func putUint16(b []byte, v uint16) {
+	b[0] = uint8(v >> 8)
+	b[1] = uint8(v)
+}
+
+func toUint16(v float64) uint16 {
+	return uint16(math.Round(clamp01(v) * 65535))
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+func columnMajorToRows(m [9]float64) [9]float64 {
+	return [9]float64{m[0], m[3], m[6], m[1], m[4], m[7], m[2], m[5], m[8]}
+}
+
+func multiply3x3(a, b [9]float64) [9]float64 {
+	var out [9]float64
+	for r := 0; r < 3; r++ {
+		for c := 0; c < 3; c++ {
+			out[r*3+c] = a[r*3]*b[c] + a[r*3+1]*b[3+c] + a[r*3+2]*b[6+c]
+		}
+	}
+	return out
+}
+
+func invert3x3(m [9]float64) [9]float64 {
+	det := m[0]*(m[4]*m[8]-m[5]*m[7]) - m[1]*(m[3]*m[8]-m[5]*m[6]) + m[2]*(m[3]*m[7]-m[4]*m[6])
+	if det == 0 {
+		return [9]float64{1, 0, 0, 0, 1, 0, 0, 0, 1}
+	}
+	inv := 1 / det
+	return [9]float64{
+		(m[4]*m[8] - m[5]*m[7]) * inv,
+		(m[2]*m[7] - m[1]*m[8]) * inv,
+		(m[1]*m[5] - m[2]*m[4]) * inv,
+		(m[5]*m[6] - m[3]*m[8]) * inv,
+		(m[0]*m[8] - m[2]*m[6]) * inv,
+		(m[2]*m[3] - m[0]*m[5]) * inv,
+		(m[3]*m[7] - m[4]*m[6]) * inv,
+		(m[1]*m[6] - m[0]*m[7]) * inv,
+		(m[0]*m[4] - m[1]*m[3]) * inv,
+	}
+}
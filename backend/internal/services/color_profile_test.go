@@ -0,0 +1,70 @@
+package services
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func testProfile(space string, trc toneCurve) *colorProfile {
+	return &colorProfile{
+		ColorSpace:   space,
+		toXYZ:        knownPrimaries[space],
+		trc:          [3]toneCurve{trc, trc, trc},
+		matrixShaper: true,
+	}
+}
+
+func grayRamp() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 256, 1))
+	for x := 0; x < 256; x++ {
+		img.SetNRGBA(x, 0, color.NRGBA{uint8(x), uint8(x), uint8(x), 255})
+	}
+	return img
+}
+
+// The working copy of any source encodes light the way an untagged image
+// does, so filters act the same whatever the tag
+func TestWorkingSpaceEncoding(t *testing.T) {
+	srgb := srgbCurve()
+	for _, source := range []*colorProfile{
+		testProfile(ColorSpaceDisplayP3, srgb),
+		testProfile(ColorSpaceAdobeRGB, toneCurve{gamma: 563.0 / 256}),
+		testProfile(ColorSpaceProPhoto, toneCurve{gamma: 1.8}),
+	} {
+		t.Run(source.ColorSpace, func(t *testing.T) {
+			working := newColorTransform(source, workingProfile(source)).apply(grayRamp())
+			for x := 0; x < 256; x++ {
+				light := source.trc[0].toLinear(float64(x) / 255)
+				want := srgb.fromLinear(light)
+				got := float64(working.NRGBA64At(x, 0).G) / 65535
+				if math.Abs(got-want) > 1.0/1024 {
+					t.Fatalf("gray %d: working value %.4f, want %.4f", x, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWorkingSpaceRoundTrip(t *testing.T) {
+	source := testProfile(ColorSpaceAdobeRGB, toneCurve{gamma: 563.0 / 256})
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x * 4), uint8(y * 4), uint8((x + y) * 2), 255})
+		}
+	}
+
+	working := workingProfile(source)
+	back := newColorTransform(working, source).apply(newColorTransform(source, working).apply(img))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			want := img.NRGBAAt(x, y)
+			got := color.NRGBAModel.Convert(back.At(x, y)).(color.NRGBA)
+			if !colorsClose(got, want, 1) {
+				t.Fatalf("(%d,%d): got %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"math"
+
+	"mediaVault-backend/internal/models"
+)
+
+// colorOp is one CSS filter function as an affine color transform: rows of
+// [r g b offset] plus an alpha multiplier. Browsers clamp after every
+// function, so ops are applied one at a time rather than pre-multiplied.
+type colorOp struct {
+	m     [12]float32
+	alpha float32
+}
+
+func (op colorOp) apply(r, g, b, a float32) (float32, float32, float32, float32) {
+	m := op.m
+	return clampUnit(m[0]*r + m[1]*g + m[2]*b + m[3]),
+		clampUnit(m[4]*r + m[5]*g + m[6]*b + m[7]),
+		clampUnit(m[8]*r + m[9]*g + m[10]*b + m[11]),
+		clampUnit(a * op.alpha)
+}
+
+// cssColorOps converts config into the color matrices defined by the Filter
+// Effects spec. A config doesn't record an order, so the functions always
+// run as brightness, contrast, saturate, sepia, grayscale, invert, opacity,
+// hue-rotate; the result matches a CSS filter string listing them that way.
+// Blur is handled separately as it isn't a per-pixel op, and runs first.
+func cssColorOps(config models.FilterConfig) []colorOp {
+	var ops []colorOp
+
+	if v := config.Brightness; v != nil && *v != 1 {
+		b := float32(math.Max(0, *v))
+		ops = append(ops, matrixOp(b, 0, 0, 0, 0, b, 0, 0, 0, 0, b, 0))
+	}
+	if v := config.Contrast; v != nil && *v != 1 {
+		c := float32(math.Max(0, *v))
+		o := 0.5 - 0.5*c
+		ops = append(ops, matrixOp(c, 0, 0, o, 0, c, 0, o, 0, 0, c, o))
+	}
+	if v := config.Saturation; v != nil && *v != 1 {
+		s := float32(math.Max(0, *v))
+		ops = append(ops, matrixOp(
+			0.213+0.787*s, 0.715-0.715*s, 0.072-0.072*s, 0,
+			0.213-0.213*s, 0.715+0.285*s, 0.072-0.072*s, 0,
+			0.213-0.213*s, 0.715-0.715*s, 0.072+0.928*s, 0,
+		))
+	}
+	if v := config.Sepia; v != nil && *v > 0 {
+		s := 1 - float32(math.Min(1, *v))
+		ops = append(ops, matrixOp(
+			0.393+0.607*s, 0.769-0.769*s, 0.189-0.189*s, 0,
+			0.349-0.349*s, 0.686+0.314*s, 0.168-0.168*s, 0,
+			0.272-0.272*s, 0.534-0.534*s, 0.131+0.869*s, 0,
+		))
+	}
+	if v := config.Grayscale; v != nil && *v > 0 {
+		g := 1 - float32(math.Min(1, *v))
+		ops = append(ops, matrixOp(
+			0.2126+0.7874*g, 0.7152-0.7152*g, 0.0722-0.0722*g, 0,
+			0.2126-0.2126*g, 0.7152+0.2848*g, 0.0722-0.0722*g, 0,
+			0.2126-0.2126*g, 0.7152-0.7152*g, 0.0722+0.9278*g, 0,
+		))
+	}
+	if v := config.Invert; v != nil && *v > 0 {
+		i := float32(math.Min(1, *v))
+		k := 1 - 2*i
+		ops = append(ops, matrixOp(k, 0, 0, i, 0, k, 0, i, 0, 0, k, i))
+	}
+	if v := config.Opacity; v != nil && *v < 1 {
+		op := matrixOp(1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0)
+		op.alpha = float32(math.Max(0, *v))
+		ops = append(ops, op)
+	}
+	if v := config.Hue; v != nil && math.Mod(*v, 360) != 0 {
+		rad := *v * math.Pi / 180
+		cos, sin := float32(math.Cos(rad)), float32(math.Sin(rad))
+		ops = append(ops, matrixOp(
+			0.213+0.787*cos-0.213*sin, 0.715-0.715*cos-0.715*sin, 0.072-0.072*cos+0.928*sin, 0,
+			0.213-0.213*cos+0.143*sin, 0.715+0.285*cos+0.140*sin, 0.072-0.072*cos-0.283*sin, 0,
+			0.213-0.213*cos-0.787*sin, 0.715-0.715*cos+0.715*sin, 0.072+0.928*cos+0.072*sin, 0,
+		))
+	}
+
+	return ops
+}
+
+func matrixOp(m ...float32) colorOp {
+	op := colorOp{alpha: 1}
+	copy(op.m[:], m)
+	return op
+}
+
+// cssBlurSigma converts a CSS blur() radius into a gaussian standard
+// deviation in image pixels. CSS defines the radius as the standard deviation
+// in CSS pixels; previews are assumed to be about 1024px wide, so the radius
+// is scaled to the image's real size the same way effect sizes are.
+func cssBlurSigma(blur float64, w, h int) float64 {
+	if blur <= 0 {
+		return 0
+	}
+	return blur * effectScale(w, h)
+}
+
+// cssBlur blurs buf the way browsers do: on premultiplied color, so the
+// color of transparent pixels doesn't bleed into visible ones, with alpha
+// blurred along. Edges are extended rather than faded to transparent, since
+// most outputs have no alpha channel. Opaque buffers are blurred as they are.
+func cssBlur(buf *rgbBuffer, sigma float64) {
+	opaque := true
+	for _, a := range buf.alpha {
+		if a != 255 {
+			opaque = false
+			break
+		}
+	}
+	if opaque {
+		gaussianBlur(buf.pix, buf.w, buf.h, 3, sigma)
+		return
+	}
+
+	data := make([]float32, len(buf.alpha)*4)
+	parallelFor(buf.h, func(y0, y1 int) {
+		for i := y0 * buf.w; i < y1*buf.w; i++ {
+			a := float32(buf.alpha[i]) / 255
+			data[i*4] = buf.pix[i*3] * a
+			data[i*4+1] = buf.pix[i*3+1] * a
+			data[i*4+2] = buf.pix[i*3+2] * a
+			data[i*4+3] = a
+		}
+	})
+	gaussianBlur(data, buf.w, buf.h, 4, sigma)
+	parallelFor(buf.h, func(y0, y1 int) {
+		for i := y0 * buf.w; i < y1*buf.w; i++ {
+			a := data[i*4+3]
+			buf.alpha[i] = toByte(a)
+			if a <= 0 {
+				buf.pix[i*3], buf.pix[i*3+1], buf.pix[i*3+2] = 0, 0, 0
+				continue
+			}
+			buf.pix[i*3] = min(data[i*4]/a, 1)
+			buf.pix[i*3+1] = min(data[i*4+1]/a, 1)
+			buf.pix[i*3+2] = min(data[i*4+2]/a, 1)
+		}
+	})
+}
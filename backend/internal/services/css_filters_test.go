@@ -0,0 +1,216 @@
+package services
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"mediaVault-backend/internal/models"
+)
+
+// Reference matrices are the feColorMatrix values from the Filter Effects
+// spec (https://www.w3.org/TR/filter-effects-1/#feColorMatrixElement),
+// evaluated by hand; pixel references are what browsers render for the same
+// CSS filter on an sRGB color.
+
+func TestCSSMatrices(t *testing.T) {
+	tests := []struct {
+		name   string
+		config models.FilterConfig
+		want   [9]float32
+	}{
+		{"hue-rotate(90deg)", models.FilterConfig{Hue: floatPtr(90)}, [9]float32{
+			0, 0, 1,
+			0.356, 0.855, -0.211,
+			-0.574, 1.430, 0.144,
+		}},
+		{"hue-rotate(180deg)", models.FilterConfig{Hue: floatPtr(180)}, [9]float32{
+			-0.574, 1.430, 0.144,
+			0.426, 0.430, 0.144,
+			0.426, 1.430, -0.856,
+		}},
+		{"hue-rotate(270deg)", models.FilterConfig{Hue: floatPtr(270)}, [9]float32{
+			0.426, 1.430, -0.856,
+			0.070, 0.575, 0.355,
+			1, 0, 0,
+		}},
+		{"saturate(0)", models.FilterConfig{Saturation: floatPtr(0)}, [9]float32{
+			0.213, 0.715, 0.072,
+			0.213, 0.715, 0.072,
+			0.213, 0.715, 0.072,
+		}},
+		{"saturate(2)", models.FilterConfig{Saturation: floatPtr(2)}, [9]float32{
+			1.787, -0.715, -0.072,
+			-0.213, 1.285, -0.072,
+			-0.213, -0.715, 1.928,
+		}},
+		{"sepia(0.5)", models.FilterConfig{Sepia: floatPtr(0.5)}, [9]float32{
+			0.6965, 0.3845, 0.0945,
+			0.1745, 0.843, 0.084,
+			0.136, 0.267, 0.5655,
+		}},
+		{"sepia(1)", models.FilterConfig{Sepia: floatPtr(1)}, [9]float32{
+			0.393, 0.769, 0.189,
+			0.349, 0.686, 0.168,
+			0.272, 0.534, 0.131,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops := cssColorOps(tt.config)
+			if len(ops) != 1 {
+				t.Fatalf("got %d ops, want 1", len(ops))
+			}
+			m := ops[0].m
+			for row := 0; row < 3; row++ {
+				for col := 0; col < 3; col++ {
+					got, want := m[row*4+col], tt.want[row*3+col]
+					if math.Abs(float64(got-want)) > 1e-4 {
+						t.Errorf("m[%d][%d] = %.4f, want %.4f", row, col, got, want)
+					}
+				}
+				if m[row*4+3] != 0 {
+					t.Errorf("row %d has offset %v", row, m[row*4+3])
+				}
+			}
+		})
+	}
+}
+
+func TestCSSIdentityFilters(t *testing.T) {
+	for _, config := range []models.FilterConfig{
+		{Hue: floatPtr(0)},
+		{Hue: floatPtr(360)},
+		{Saturation: floatPtr(1)},
+		{Sepia: floatPtr(0)},
+	} {
+		if ops := cssColorOps(config); len(ops) != 0 {
+			t.Errorf("%+v: got %d ops, want none", config, len(ops))
+		}
+	}
+}
+
+func TestCSSFilterPixels(t *testing.T) {
+	red := color.NRGBA{255, 0, 0, 255}
+	tests := []struct {
+		name   string
+		config models.FilterConfig
+		in     color.NRGBA
+		want   color.NRGBA
+	}{
+		{"hue-rotate(0deg)", models.FilterConfig{Hue: floatPtr(0)}, red, red},
+		{"hue-rotate(90deg)", models.FilterConfig{Hue: floatPtr(90)}, red, color.NRGBA{0, 91, 0, 255}},
+		{"hue-rotate(180deg)", models.FilterConfig{Hue: floatPtr(180)}, red, color.NRGBA{0, 109, 109, 255}},
+		{"hue-rotate(270deg)", models.FilterConfig{Hue: floatPtr(270)}, red, color.NRGBA{109, 18, 255, 255}},
+		{"saturate(0)", models.FilterConfig{Saturation: floatPtr(0)}, red, color.NRGBA{54, 54, 54, 255}},
+		{"sepia(1) white", models.FilterConfig{Sepia: floatPtr(1)}, color.NRGBA{255, 255, 255, 255}, color.NRGBA{255, 255, 239, 255}},
+		{"sepia(1) gray", models.FilterConfig{Sepia: floatPtr(1)}, color.NRGBA{128, 128, 128, 255}, color.NRGBA{173, 154, 120, 255}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+			img.SetNRGBA(0, 0, tt.in)
+			out, err := runPipeline(t.Context(), img, buildPipeline(tt.config, 1, 1, &renderAssets{}))
+			if err != nil {
+				t.Fatalf("runPipeline: %v", err)
+			}
+			got := color.NRGBAModel.Convert(out.At(0, 0)).(color.NRGBA)
+			if !colorsClose(got, tt.want, 1) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSSBlurSigma(t *testing.T) {
+	tests := []struct {
+		blur float64
+		w, h int
+		want float64
+	}{
+		{0, 1024, 768, 0},
+		{-2, 1024, 768, 0},
+		{4, 1024, 768, 4},
+		{4, 512, 512, 4}, // small images aren't blurred less
+		{4, 768, 1024, 4},
+		{4, 4096, 3072, 16},
+		{2.5, 2048, 1536, 5},
+	}
+	for _, tt := range tests {
+		if got := cssBlurSigma(tt.blur, tt.w, tt.h); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("cssBlurSigma(%v, %d, %d) = %v, want %v", tt.blur, tt.w, tt.h, got, tt.want)
+		}
+	}
+}
+
+// A gaussian blur of a step edge follows the normal CDF across it, which is
+// what browsers render for blur() on a hard edge
+func TestCSSBlurStepEdge(t *testing.T) {
+	const w, h, edge = 256, 4, 128
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8(0)
+			if x >= edge {
+				v = 255
+			}
+			img.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+	}
+
+	// 1.5 uses the exact kernel, the others the box approximation
+	for _, blur := range []float64{1.5, 4, 10} {
+		out, err := runPipeline(t.Context(), img, buildPipeline(models.FilterConfig{Blur: floatPtr(blur)}, w, h, &renderAssets{}))
+		if err != nil {
+			t.Fatalf("runPipeline: %v", err)
+		}
+		for x := edge - int(4*blur); x < edge+int(4*blur); x++ {
+			got := float64(color.NRGBAModel.Convert(out.At(x, h/2)).(color.NRGBA).R) / 255
+			want := 0.5 * math.Erfc(-(float64(x)+0.5-edge)/(blur*math.Sqrt2))
+			if math.Abs(got-want) > 0.015 {
+				t.Errorf("blur(%vpx) at %+d: got %.3f, want %.3f", blur, x-edge, got, want)
+			}
+		}
+	}
+}
+
+func colorsClose(a, b color.NRGBA, tolerance int) bool {
+	diff := func(x, y uint8) bool {
+		d := int(x) - int(y)
+		return d >= -tolerance && d <= tolerance
+	}
+	return diff(a.R, b.R) && diff(a.G, b.G) && diff(a.B, b.B) && diff(a.A, b.A)
+}
+
+// blur() works on premultiplied color: the hidden color of transparent
+// pixels must not tint the visible ones next to them
+func TestCSSBlurPremultiplied(t *testing.T) {
+	const w, h, edge = 64, 4, 32
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if x < edge {
+				img.SetNRGBA(x, y, color.NRGBA{255, 0, 0, 0})
+			} else {
+				img.SetNRGBA(x, y, color.NRGBA{0, 0, 255, 255})
+			}
+		}
+	}
+
+	out, err := runPipeline(t.Context(), img, buildPipeline(models.FilterConfig{Blur: floatPtr(3)}, w, h, &renderAssets{}))
+	if err != nil {
+		t.Fatalf("runPipeline: %v", err)
+	}
+	for x := edge - 6; x < edge+6; x++ {
+		c := color.NRGBAModel.Convert(out.At(x, h/2)).(color.NRGBA)
+		if c.A > 0 && c.R > 1 {
+			t.Errorf("x=%d: transparent red bled into %v", x, c)
+		}
+	}
+	if a := color.NRGBAModel.Convert(out.At(edge, h/2)).(color.NRGBA).A; a == 0 || a == 255 {
+		t.Errorf("alpha at the edge is %d, want it blurred", a)
+	}
+}
@@ -13,6 +13,9 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// mediaCollection holds MediaFile documents
+const mediaCollection = "media_files"
+
 type DatabaseService struct {
 	client     *mongo.Client
 	database   *mongo.Database
@@ -34,7 +37,7 @@ func NewDatabaseService(mongoURI, dbName string) (*DatabaseService, error) {
 	}
 
 	database := client.Database(dbName)
-	collection := database.Collection("media_files")
+	collection := database.Collection(mediaCollection)
 
 	// Create indexes
 	indexModel := mongo.IndexModel{
@@ -132,6 +135,9 @@ func (ds *DatabaseService) UpdateMediaFile(ctx context.Context, id string, updat
 	if updates.Tags != nil {
 		updateDoc["tags"] = updates.Tags
 	}
+	if updates.Public != nil {
+		updateDoc["public"] = *updates.Public
+	}
 
 	_, err = ds.collection.UpdateOne(
 		ctx,
@@ -145,6 +151,50 @@ func (ds *DatabaseService) UpdateMediaFile(ctx context.Context, id string, updat
 	return ds.GetMediaFileByID(ctx, id)
 }
 
+// UpdateMediaRenditions persists changes to the stored original (size,
+// orientation) and its derived variants
+func (ds *DatabaseService) UpdateMediaRenditions(ctx context.Context, media *models.MediaFile) error {
+	media.UpdatedAt = time.Now()
+
+	_, err := ds.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": media.ID},
+		bson.M{"$set": bson.M{
+			"size":           media.Size,
+			"orientation":    media.Orientation,
+			"colorSpace":     media.ColorSpace,
+			"variants":       media.Variants,
+			"contentVersion": media.ContentVersion,
+			"updatedAt":      media.UpdatedAt,
+		}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update media file: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateMediaEdits persists the edit stack and the variants that go with it
+func (ds *DatabaseService) UpdateMediaEdits(ctx context.Context, media *models.MediaFile) error {
+	media.UpdatedAt = time.Now()
+
+	update := bson.M{"$set": bson.M{
+		"variants":  media.Variants,
+		"updatedAt": media.UpdatedAt,
+	}}
+	if media.Edits != nil {
+		update["$set"].(bson.M)["edits"] = media.Edits
+	} else {
+		update["$unset"] = bson.M{"edits": ""}
+	}
+
+	if _, err := ds.collection.UpdateOne(ctx, bson.M{"_id": media.ID}, update); err != nil {
+		return fmt.Errorf("failed to update media edits: %w", err)
+	}
+	return nil
+}
+
 func (ds *DatabaseService) DeleteMediaFile(ctx context.Context, id string) error {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"mediaVault-backend/internal/models"
+)
+
+// Deliver renders an image the way it leaves the vault: its edit stack
+// applied, then the owner's default watermark stamped on top. SVGs are
+// delivered as their PNG raster and watermarked like any other image; only
+// one that couldn't be rasterized comes back as markup, unwatermarked.
+func (s *EditService) Deliver(ctx context.Context, media *models.MediaFile) (*RenderedMedia, error) {
+	rendered, err := s.Render(ctx, media)
+	if err != nil {
+		return nil, err
+	}
+	if rendered.Format == "svg" {
+		return rendered, nil
+	}
+
+	watermark, err := s.filterSvc.GetDefaultWatermark(ctx, media.UserID)
+	if err != nil || watermark == nil {
+		return rendered, err
+	}
+
+	// Edited renders are already upright
+	orientation := media.WorkingOrientation()
+	if media.Edits != nil && len(media.Edits.Steps) > 0 {
+		orientation = orientationNormal
+	}
+	config := models.FilterConfig{Effects: []models.Effect{{Type: "watermark", Params: watermark}}}
+	data, format, err := s.filterSvc.processImage(ctx, rendered.Data, rendered.Format, orientation, config, models.OutputOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to watermark %s: %w", media.ID.Hex(), err)
+	}
+	return &RenderedMedia{Data: data, Format: format, MimeType: MimeTypeForFormat(format)}, nil
+}
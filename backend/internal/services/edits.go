@@ -0,0 +1,360 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"mediaVault-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// EditService persists non-destructive edit stacks and renders them. The
+// original object is never touched, so reverting is always possible.
+type EditService struct {
+	dbSvc     *DatabaseService
+	minioSvc  *MinioService
+	filterSvc *FilterService
+}
+
+func NewEditService(dbSvc *DatabaseService, minioSvc *MinioService, filterSvc *FilterService) *EditService {
+	return &EditService{
+		dbSvc:     dbSvc,
+		minioSvc:  minioSvc,
+		filterSvc: filterSvc,
+	}
+}
+
+// RenderedMedia is an encoded image ready to serve
+type RenderedMedia struct {
+	Data     []byte
+	Format   string
+	MimeType string
+	// Cached reports whether the render came from the stored edited variant
+	Cached bool
+}
+
+// ValidateEditStack checks every step's type and parameters
+func ValidateEditStack(steps []models.EditStep) error {
+	for i, step := range steps {
+		switch step.Type {
+		case models.EditStepFilter:
+			if step.FilterID == nil && step.Config == nil {
+				return fmt.Errorf("steps[%d]: filter steps need a filterId or a config", i)
+			}
+			if step.Config != nil {
+				if err := ValidateFilterConfig(*step.Config); err != nil {
+					return fmt.Errorf("steps[%d]: %w", i, err)
+				}
+			}
+		case models.EditStepCrop:
+			if err := validateCropRect(step.Crop); err != nil {
+				return fmt.Errorf("steps[%d]: %w", i, err)
+			}
+		case models.EditStepRotate:
+			if step.Degrees%90 != 0 {
+				return fmt.Errorf("steps[%d]: degrees must be a multiple of 90", i)
+			}
+		default:
+			return fmt.Errorf("steps[%d]: unknown step type %q", i, step.Type)
+		}
+	}
+	return nil
+}
+
+// SaveEdits replaces the edit stack of media. An empty stack reverts to the
+// original. The cached render is dropped and rebuilt on the next request.
+func (s *EditService) SaveEdits(ctx context.Context, media *models.MediaFile, steps []models.EditStep) error {
+	if len(steps) == 0 {
+		return s.RevertEdits(ctx, media)
+	}
+	if err := ValidateEditStack(steps); err != nil {
+		return err
+	}
+	// Fail now rather than at render time if a preset doesn't exist
+	if _, err := s.resolveSteps(ctx, media.UserID, steps); err != nil {
+		return err
+	}
+
+	media.Edits = &models.EditStack{Steps: steps, UpdatedAt: time.Now()}
+	s.dropEditedVariant(media)
+	return s.dbSvc.UpdateMediaEdits(ctx, media)
+}
+
+// InvalidateRenders drops cached filter results of media after its stored
+// content changed or it was deleted
+func (s *EditService) InvalidateRenders(mediaID primitive.ObjectID) {
+	s.filterSvc.InvalidateMediaRenders(mediaID)
+}
+
+// RevertEdits discards the edit stack and its cached render
+func (s *EditService) RevertEdits(ctx context.Context, media *models.MediaFile) error {
+	media.Edits = nil
+	s.dropEditedVariant(media)
+	return s.dbSvc.UpdateMediaEdits(ctx, media)
+}
+
+// Render returns media with its edit stack applied, from the cached variant
+// when it is still current. Without edits it returns the display rendition
+// of the original.
+func (s *EditService) Render(ctx context.Context, media *models.MediaFile) (*RenderedMedia, error) {
+	if media.Edits == nil || len(media.Edits.Steps) == 0 {
+		data, err := s.readObject(media.WorkingFileName())
+		if err != nil {
+			return nil, err
+		}
+		return &RenderedMedia{Data: data, Format: formatFromFileName(media.WorkingFileName()), MimeType: media.WorkingMimeType()}, nil
+	}
+
+	steps, err := s.resolveSteps(ctx, media.UserID, media.Edits.Steps)
+	if err != nil {
+		return nil, err
+	}
+	key, err := renderKey(media, steps)
+	if err != nil {
+		return nil, err
+	}
+
+	if variant, ok := media.Variants[models.VariantEdited]; ok && media.Edits.RenderKey == key {
+		data, err := s.readObject(variant.FileName)
+		if err == nil {
+			return &RenderedMedia{Data: data, Format: formatFromFileName(variant.FileName), MimeType: variant.MimeType, Cached: true}, nil
+		}
+		log.Printf("Cached edit render %s unreadable, rendering again: %v", variant.FileName, err)
+	}
+
+	original, err := s.readObject(media.WorkingFileName())
+	if err != nil {
+		return nil, err
+	}
+	var configs []models.FilterConfig
+	for _, step := range steps {
+		if step.Config != nil {
+			configs = append(configs, *step.Config)
+		}
+	}
+	assets, err := s.filterSvc.resolveAssets(ctx, configs...)
+	if err != nil {
+		return nil, err
+	}
+
+	var bounds image.Rectangle
+	encoded, format, err := s.filterSvc.renderImage(ctx, original, media.OriginalFormat, media.WorkingOrientation(), models.OutputOptions{},
+		func(img image.Image) (image.Image, error) {
+			for _, step := range steps {
+				next, err := applyEditStep(ctx, img, step, assets)
+				if err != nil {
+					return nil, err
+				}
+				img = next
+			}
+			bounds = img.Bounds()
+			return img, nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render edits: %w", err)
+	}
+
+	s.dropEditedVariant(media)
+	variant, err := storeVariant(s.minioSvc, media, models.VariantEdited, bounds, encoded, format)
+	if err != nil {
+		return nil, err
+	}
+	media.SetVariant(models.VariantEdited, *variant)
+	media.Edits.RenderKey = key
+	if err := s.dbSvc.UpdateMediaEdits(ctx, media); err != nil {
+		return nil, err
+	}
+
+	return &RenderedMedia{Data: encoded, Format: format, MimeType: variant.MimeType}, nil
+}
+
+// ExportEdited renders the edit stack and saves the result as a new,
+// independent media item
+func (s *EditService) ExportEdited(ctx context.Context, media *models.MediaFile, req models.ExportEditsRequest) (*models.MediaFile, error) {
+	if media.Edits == nil || len(media.Edits.Steps) == 0 {
+		return nil, fmt.Errorf("media has no edits to export")
+	}
+
+	rendered, err := s.Render(ctx, media)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := models.CreateMediaRequest{
+		Title:       req.Title,
+		Description: req.Description,
+		Category:    req.Category,
+		Tags:        req.Tags,
+	}
+	if metadata.Title == "" {
+		metadata.Title = media.Title + " (edited)"
+	}
+	if metadata.Description == nil {
+		metadata.Description = media.Description
+	}
+	if metadata.Category == nil {
+		metadata.Category = media.Category
+	}
+	if metadata.Tags == nil {
+		metadata.Tags = media.Tags
+	}
+
+	return s.saveDerived(ctx, media, rendered, metadata, "edited")
+}
+
+// saveDerived stores an image rendered from media as a new media item named
+// after the original with suffix
+func (s *EditService) saveDerived(ctx context.Context, media *models.MediaFile, rendered *RenderedMedia, metadata models.CreateMediaRequest, suffix string) (*models.MediaFile, error) {
+	base := strings.TrimSuffix(media.OriginalName, filepath.Ext(media.OriginalName))
+	originalName := fmt.Sprintf("%s-%s.%s", base, suffix, rendered.Format)
+
+	derived, err := s.minioSvc.UploadContent(rendered.Data, originalName, rendered.MimeType, metadata, media.UserID)
+	if err != nil {
+		return nil, err
+	}
+	derived.OriginalFormat = rendered.Format
+	derived.ColorSpace = colorSpaceOf(profileFromData(rendered.Data))
+	derived.DerivedFrom = &media.ID
+
+	if err := s.dbSvc.CreateMediaFile(ctx, derived); err != nil {
+		_ = s.minioSvc.DeleteFile(derived.FileName)
+		return nil, err
+	}
+	return derived, nil
+}
+
+// SaveResult stores a processed rendition of one of the user's media items
+// as a new media item titled after label, with its URL filled in
+func (s *EditService) SaveResult(ctx context.Context, mediaID, userID primitive.ObjectID, data []byte, label string) (*models.MediaFile, error) {
+	media, err := s.dbSvc.GetMediaFileByID(ctx, mediaID.Hex())
+	if err != nil || media.UserID != userID {
+		return nil, fmt.Errorf("media not found")
+	}
+	format := detectImageFormat(data, "")
+	if format == "" {
+		return nil, fmt.Errorf("result is not a recognized image")
+	}
+
+	saved, err := s.saveFiltered(ctx, media, &RenderedMedia{Data: data, Format: format, MimeType: MimeTypeForFormat(format)}, label)
+	if err != nil {
+		return nil, err
+	}
+	if saved.URL, err = s.minioSvc.GetFileURL(saved.FileName); err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+// saveFiltered stores a filter result as a new media item that keeps the
+// source's metadata, titled after label
+func (s *EditService) saveFiltered(ctx context.Context, media *models.MediaFile, rendered *RenderedMedia, label string) (*models.MediaFile, error) {
+	metadata := models.CreateMediaRequest{
+		Title:       fmt.Sprintf("%s (%s)", media.Title, label),
+		Description: media.Description,
+		Category:    media.Category,
+		Tags:        media.Tags,
+	}
+	return s.saveDerived(ctx, media, rendered, metadata, "filtered")
+}
+
+// resolveSteps returns a copy of steps where every filter step carries the
+// full config to render: its preset layered with the step's own config.
+// Presets must be ones userID may apply.
+func (s *EditService) resolveSteps(ctx context.Context, userID primitive.ObjectID, steps []models.EditStep) ([]models.EditStep, error) {
+	resolved := make([]models.EditStep, len(steps))
+	for i, step := range steps {
+		resolved[i] = step
+		if step.Type != models.EditStepFilter {
+			continue
+		}
+
+		var config models.FilterConfig
+		if step.FilterID != nil {
+			preset, err := s.filterSvc.getAccessiblePreset(ctx, *step.FilterID, userID)
+			if err != nil {
+				return nil, fmt.Errorf("steps[%d]: failed to get filter preset: %w", i, err)
+			}
+			config = mergeConfigs(preset.Config, step.Config)
+		} else {
+			config = mergeConfigs(*step.Config)
+		}
+		resolved[i].Config = &config
+	}
+	return resolved, nil
+}
+
+// applyEditStep runs one resolved step on an upright working image
+func applyEditStep(ctx context.Context, img image.Image, step models.EditStep, assets *renderAssets) (image.Image, error) {
+	switch step.Type {
+	case models.EditStepFilter:
+		bounds := img.Bounds()
+		return runPipeline(ctx, img, buildPipeline(*step.Config, bounds.Dx(), bounds.Dy(), assets))
+	case models.EditStepCrop:
+		return applyGeometry(ctx, img, &models.GeometryConfig{Crop: step.Crop})
+	case models.EditStepRotate:
+		degrees := step.Degrees
+		return applyGeometry(ctx, img, &models.GeometryConfig{Rotate: &degrees})
+	}
+	return img, nil
+}
+
+func applyGeometry(ctx context.Context, img image.Image, geometry *models.GeometryConfig) (image.Image, error) {
+	bounds := img.Bounds()
+	stages, _, _ := geometryStages(geometry, bounds.Dx(), bounds.Dy())
+	return runPipeline(ctx, img, stages)
+}
+
+// renderKey hashes everything a render depends on: the stored original and
+// the fully resolved steps, so edits to a referenced preset invalidate it too
+func renderKey(media *models.MediaFile, steps []models.EditStep) (string, error) {
+	payload, err := json.Marshal(struct {
+		FileName    string            `json:"fileName"`
+		Size        int64             `json:"size"`
+		Orientation int               `json:"orientation"`
+		Steps       []models.EditStep `json:"steps"`
+	}{media.WorkingFileName(), media.Size, media.WorkingOrientation(), steps})
+	if err != nil {
+		return "", fmt.Errorf("failed to hash edit stack: %w", err)
+	}
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (s *EditService) dropEditedVariant(media *models.MediaFile) {
+	variant, ok := media.Variants[models.VariantEdited]
+	if !ok {
+		return
+	}
+	if err := s.minioSvc.DeleteFile(variant.FileName); err != nil {
+		log.Printf("Failed to delete edited render %s: %v", variant.FileName, err)
+	}
+	delete(media.Variants, models.VariantEdited)
+}
+
+func formatFromFileName(fileName string) string {
+	return normalizeFormat(strings.TrimPrefix(filepath.Ext(fileName), "."))
+}
+
+func (s *EditService) readObject(fileName string) ([]byte, error) {
+	reader, err := s.minioSvc.GetFileContent(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", fileName, err)
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", fileName, err)
+	}
+	return data, nil
+}
@@ -1,15 +1,12 @@
 package services
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"image"
-	"image/color"
-	"image/jpeg"
-	"image/png"
 	"io"
-	"math"
+	"log"
 	"strings"
 	"time"
 
@@ -18,13 +15,21 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ErrMediaNotFound is returned for media that doesn't exist or belongs to
+// another user
+var ErrMediaNotFound = errors.New("media not found")
+
 type FilterService struct {
-	db        *mongo.Database
-	minioSvc  *MinioService
-	presets   map[string]*models.FilterPreset
-	analytics *FilterAnalyticsService
+	db          *mongo.Database
+	minioSvc    *MinioService
+	presets     map[string]*models.FilterPreset
+	analytics   *FilterAnalyticsService
+	renderCache *renderCache
+	// thumbnailQueue holds presets waiting for new thumbnails
+	thumbnailQueue chan primitive.ObjectID
 }
 
 func NewFilterService(db *mongo.Database, minioSvc *MinioService) *FilterService {
@@ -33,9 +38,12 @@ func NewFilterService(db *mongo.Database, minioSvc *MinioService) *FilterService
 		minioSvc: minioSvc,
 		presets:  make(map[string]*models.FilterPreset),
 	}
+	fs.renderCache = newRenderCache(minioSvc)
 
-	// Initialize default presets
-	fs.initializeDefaultPresets()
+	// Built-in presets come from the embedded catalog
+	fs.loadBuiltinPresets()
+	fs.ensureGalleryIndexes()
+	fs.startThumbnailWorker()
 
 	// Initialize analytics service
 	fs.analytics = NewFilterAnalyticsService(db)
@@ -43,406 +51,300 @@ func NewFilterService(db *mongo.Database, minioSvc *MinioService) *FilterService
 	return fs
 }
 
-func (fs *FilterService) initializeDefaultPresets() {
-	defaultPresets := []*models.FilterPreset{
-		// Artistic Filters
-		{
-			ID:          primitive.NewObjectID(),
-			Name:        "Watercolor",
-			Category:    models.FilterCategoryArtistic,
-			Type:        string(models.ArtisticWatercolor),
-			Description: "Soft, flowing watercolor painting effect",
-			Config: models.FilterConfig{
-				Brightness: floatPtr(1.1),
-				Saturation: floatPtr(0.8),
-				Blur:       floatPtr(0.5),
-				Effects: []models.Effect{
-					{Type: "edge_preserve", Params: map[string]interface{}{"strength": 0.3}},
-					{Type: "texture_overlay", Params: map[string]interface{}{"texture": "watercolor", "opacity": 0.4}},
-				},
-			},
-			IsCustom:  false,
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		},
-		{
-			ID:          primitive.NewObjectID(),
-			Name:        "Oil Painting",
-			Category:    models.FilterCategoryArtistic,
-			Type:        string(models.ArtisticOilPainting),
-			Description: "Rich, textured oil painting effect",
-			Config: models.FilterConfig{
-				Brightness: floatPtr(0.95),
-				Contrast:   floatPtr(1.2),
-				Saturation: floatPtr(1.3),
-				Effects: []models.Effect{
-					{Type: "brush_strokes", Params: map[string]interface{}{"size": 3, "strength": 0.7}},
-					{Type: "impasto", Params: map[string]interface{}{"depth": 0.5}},
-				},
-			},
-			IsCustom:  false,
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		},
-		{
-			ID:          primitive.NewObjectID(),
-			Name:        "Cyberpunk",
-			Category:    models.FilterCategoryArtistic,
-			Type:        string(models.ArtisticCyberpunk),
-			Description: "Neon-lit futuristic cyberpunk aesthetic",
-			Config: models.FilterConfig{
-				Contrast:   floatPtr(1.4),
-				Saturation: floatPtr(1.5),
-				Hue:        floatPtr(30),
-				Effects: []models.Effect{
-					{Type: "neon_glow", Params: map[string]interface{}{"color": "#00ff41", "intensity": 0.8}},
-					{Type: "chromatic_aberration", Params: map[string]interface{}{"strength": 0.3}},
-					{Type: "scanlines", Params: map[string]interface{}{"density": 0.2, "opacity": 0.1}},
-				},
-			},
-			IsCustom:  false,
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		},
-		{
-			ID:          primitive.NewObjectID(),
-			Name:        "Anime Style",
-			Category:    models.FilterCategoryArtistic,
-			Type:        string(models.ArtisticAnime),
-			Description: "Clean, vibrant anime-style illustration",
-			Config: models.FilterConfig{
-				Brightness: floatPtr(1.05),
-				Contrast:   floatPtr(1.3),
-				Saturation: floatPtr(1.4),
-				Effects: []models.Effect{
-					{Type: "cell_shading", Params: map[string]interface{}{"levels": 4, "smoothing": 0.2}},
-					{Type: "edge_enhance", Params: map[string]interface{}{"strength": 0.8}},
-				},
-			},
-			IsCustom:  false,
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		},
-
-		// Mood Filters
-		{
-			ID:          primitive.NewObjectID(),
-			Name:        "Happy",
-			Category:    models.FilterCategoryMood,
-			Type:        string(models.MoodHappy),
-			Description: "Bright and cheerful mood enhancement",
-			Config: models.FilterConfig{
-				Brightness: floatPtr(1.15),
-				Contrast:   floatPtr(1.1),
-				Saturation: floatPtr(1.2),
-				Hue:        floatPtr(10), // Slight warm shift
-				Effects: []models.Effect{
-					{Type: "warm_tint", Params: map[string]interface{}{"intensity": 0.3}},
-					{Type: "highlight_boost", Params: map[string]interface{}{"amount": 0.2}},
-				},
-			},
-			IsCustom:  false,
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		},
-		{
-			ID:          primitive.NewObjectID(),
-			Name:        "Dramatic",
-			Category:    models.FilterCategoryMood,
-			Type:        string(models.MoodDramatic),
-			Description: "High contrast dramatic effect",
-			Config: models.FilterConfig{
-				Brightness: floatPtr(0.9),
-				Contrast:   floatPtr(1.5),
-				Saturation: floatPtr(0.8),
-				Effects: []models.Effect{
-					{Type: "vignette", Params: map[string]interface{}{"intensity": 0.6, "radius": 0.7}},
-					{Type: "shadow_lift", Params: map[string]interface{}{"amount": -0.2}},
-				},
-			},
-			IsCustom:  false,
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		},
-		{
-			ID:          primitive.NewObjectID(),
-			Name:        "Cozy",
-			Category:    models.FilterCategoryMood,
-			Type:        string(models.MoodCozy),
-			Description: "Warm, comfortable, homely feeling",
-			Config: models.FilterConfig{
-				Brightness: floatPtr(1.05),
-				Contrast:   floatPtr(0.95),
-				Saturation: floatPtr(1.1),
-				Hue:        floatPtr(15), // Warm orange shift
-				Effects: []models.Effect{
-					{Type: "warm_filter", Params: map[string]interface{}{"temperature": 3200}},
-					{Type: "soft_glow", Params: map[string]interface{}{"radius": 2, "intensity": 0.3}},
-				},
-			},
-			IsCustom:  false,
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		},
+// loadBuiltinPresets serves the catalog presets from memory and makes sure
+// filter_presets holds their current versions
+func (fs *FilterService) loadBuiltinPresets() {
+	presets, err := BuiltinPresets()
+	if err != nil {
+		log.Printf("Failed to load built-in presets: %v", err)
+		return
 	}
-
-	for _, preset := range defaultPresets {
+	for _, preset := range presets {
 		fs.presets[preset.ID.Hex()] = preset
 	}
-}
 
-// ApplyFilter applies a filter to an image and returns the processed image data
-func (fs *FilterService) ApplyFilter(ctx context.Context, mediaID, filterID primitive.ObjectID, userID primitive.ObjectID, customConfig *models.FilterConfig) ([]byte, string, error) {
-	// Get the original image from MinIO
-	media, err := fs.getMediaFile(ctx, mediaID)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	written, err := SyncPresetCatalog(ctx, fs.db)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to get media file: %w", err)
+		log.Printf("Failed to sync built-in presets: %v", err)
+		return
 	}
-
-	// Check if it's an image
-	if !strings.HasPrefix(media.MimeType, "image/") {
-		return nil, "", fmt.Errorf("filter can only be applied to images")
+	if written > 0 {
+		log.Printf("Synced %d built-in presets", written)
 	}
+}
 
-	// Get filter preset
-	filter, err := fs.getFilterPreset(ctx, filterID)
-	if err != nil {
-		return nil, "", fmt.Errorf("failed to get filter preset: %w", err)
-	}
+// FilterResult is a rendered filter application
+type FilterResult struct {
+	Data   []byte
+	Format string
+	// Config is the effective config after layering the preset, the user's
+	// saved tweaks and the request override
+	Config     models.FilterConfig
+	FilterName string
+	// Cache is the render cache tier the result came from, or "miss"
+	Cache string
+}
 
-	// Download image from MinIO
-	reader, err := fs.minioSvc.GetFileContent(media.FileName)
-	if err != nil {
-		return nil, "", fmt.Errorf("failed to download image: %w", err)
+// ApplyFilter applies a filter to an image and returns the processed image data
+// along with the format it was encoded in and the config that was rendered
+func (fs *FilterService) ApplyFilter(ctx context.Context, mediaID, filterID primitive.ObjectID, userID primitive.ObjectID, customConfig *models.FilterConfig, output models.OutputOptions) (*FilterResult, error) {
+	if err := ValidateOutputOptions(output); err != nil {
+		return nil, err
 	}
-	defer reader.Close()
 
-	imageData, err := io.ReadAll(reader)
+	media, filter, config, err := fs.prepareFilter(ctx, mediaID, filterID, userID, customConfig)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to read image data: %w", err)
+		return nil, err
 	}
 
-	// Apply filter processing
-	processedImage, outputFormat, err := fs.processImage(imageData, filter.Config, customConfig)
+	processedImage, outputFormat, cache, err := fs.cachedRender(media, filterID, config, output, 0, func() ([]byte, string, error) {
+		// Download image from MinIO, using the developed rendition for HEIC/RAW
+		reader, err := fs.minioSvc.GetFileContent(media.WorkingFileName())
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to download image: %w", err)
+		}
+		defer reader.Close()
+
+		imageData, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read image data: %w", err)
+		}
+
+		// Apply filter processing
+		processedImage, outputFormat, err := fs.processImage(ctx, imageData, media.OriginalFormat, media.WorkingOrientation(), config, output)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to process image: %w", err)
+		}
+		return processedImage, outputFormat, nil
+	})
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to process image: %w", err)
+		return nil, err
 	}
 
 	// Record filter application
-	go fs.recordFilterApplication(context.Background(), mediaID, userID, filterID, customConfig)
+	go fs.recordFilterApplication(context.Background(), mediaID, userID, filter, customConfig)
 
-	return processedImage, outputFormat, nil
+	return &FilterResult{Data: processedImage, Format: outputFormat, Config: config, FilterName: filter.Name, Cache: cache}, nil
 }
 
-func (fs *FilterService) processImage(imageData []byte, filterConfig models.FilterConfig, customConfig *models.FilterConfig) ([]byte, string, error) {
-	// Decode image
-	reader := bytes.NewReader(imageData)
-	img, format, err := image.Decode(reader)
+// cachedRender returns a filter result from the render cache, or renders
+// and caches it. It also reports which cache tier answered.
+func (fs *FilterService) cachedRender(media *models.MediaFile, filterID primitive.ObjectID, config models.FilterConfig, output models.OutputOptions, maxDim int, render func() ([]byte, string, error)) ([]byte, string, string, error) {
+	key, err := fs.renderCache.key(media, filterID, config, output, maxDim)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to decode image: %w", err)
+		// Rendering still works without the cache
+		log.Printf("Render cache unavailable for %s: %v", media.ID.Hex(), err)
+		data, format, err := render()
+		return data, format, RenderCacheMiss, err
 	}
 
-	// Apply custom config if provided
-	config := filterConfig
-	if customConfig != nil {
-		config = mergeConfigs(filterConfig, *customConfig)
+	if cached, tier := fs.renderCache.get(key); cached != nil {
+		return cached.data, cached.format, tier, nil
 	}
-
-	// Apply CSS-like filters
-	processedImg := fs.applyCSSFilters(img, config)
-
-	// Apply advanced effects
-	for _, effect := range config.Effects {
-		processedImg = fs.applyEffect(processedImg, effect)
-	}
-
-	// Encode processed image
-	var buf bytes.Buffer
-	switch format {
-	case "jpeg", "jpg":
-		err = jpeg.Encode(&buf, processedImg, &jpeg.Options{Quality: 90})
-	case "png":
-		err = png.Encode(&buf, processedImg)
-	default:
-		// Default to JPEG
-		err = jpeg.Encode(&buf, processedImg, &jpeg.Options{Quality: 90})
-		format = "jpeg"
-	}
-
+	data, format, err := render()
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to encode processed image: %w", err)
+		return nil, "", RenderCacheMiss, err
 	}
+	fs.renderCache.put(key, data, format)
+	return data, format, RenderCacheMiss, nil
+}
 
-	return buf.Bytes(), format, nil
+// RenderCacheStats reports hit and miss counts of the render cache
+func (fs *FilterService) RenderCacheStats() RenderCacheStats {
+	return fs.renderCache.stats()
 }
 
-func (fs *FilterService) applyCSSFilters(img image.Image, config models.FilterConfig) image.Image {
-	bounds := img.Bounds()
-	processedImg := image.NewRGBA(bounds)
+// InvalidateMediaRenders drops cached filter results of a media item whose
+// content changed or which was deleted
+func (fs *FilterService) InvalidateMediaRenders(mediaID primitive.ObjectID) {
+	fs.renderCache.invalidateMedia(mediaID)
+}
 
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			r, g, b, a := img.At(x, y).RGBA()
+// InvalidatePresetRenders drops cached filter results of an edited preset
+func (fs *FilterService) InvalidatePresetRenders(filterID primitive.ObjectID) {
+	fs.renderCache.invalidateFilter(filterID)
+}
 
-			// Convert to 0-1 range
-			rf, gf, bf, af := float64(r)/65535, float64(g)/65535, float64(b)/65535, float64(a)/65535
+// prepareFilter loads the media and preset of a filter application and
+// layers the effective config. Media of other users is ErrMediaNotFound.
+func (fs *FilterService) prepareFilter(ctx context.Context, mediaID, filterID, userID primitive.ObjectID, customConfig *models.FilterConfig) (*models.MediaFile, *models.FilterPreset, models.FilterConfig, error) {
+	// Get the original image from MinIO
+	media, err := fs.getMediaFile(ctx, mediaID)
+	if errors.Is(err, mongo.ErrNoDocuments) || (err == nil && media.UserID != userID) {
+		return nil, nil, models.FilterConfig{}, ErrMediaNotFound
+	}
+	if err != nil {
+		return nil, nil, models.FilterConfig{}, fmt.Errorf("failed to get media file: %w", err)
+	}
 
-			// Apply brightness
-			if config.Brightness != nil {
-				brightness := *config.Brightness
-				rf *= brightness
-				gf *= brightness
-				bf *= brightness
-			}
+	// Check if it's an image
+	if !strings.HasPrefix(media.MimeType, "image/") {
+		return nil, nil, models.FilterConfig{}, fmt.Errorf("filter can only be applied to images")
+	}
 
-			// Apply contrast
-			if config.Contrast != nil {
-				contrast := *config.Contrast
-				rf = (rf-0.5)*contrast + 0.5
-				gf = (gf-0.5)*contrast + 0.5
-				bf = (bf-0.5)*contrast + 0.5
-			}
+	// Get filter preset
+	filter, err := fs.getAccessiblePreset(ctx, filterID, userID)
+	if err != nil {
+		return nil, nil, models.FilterConfig{}, err
+	}
 
-			// Apply saturation
-			if config.Saturation != nil {
-				saturation := *config.Saturation
-				// Convert to HSL and adjust saturation
-				rf, gf, bf = adjustSaturation(rf, gf, bf, saturation)
-			}
+	tweaks, err := fs.GetPresetTweaks(ctx, userID, filterID)
+	if err != nil {
+		return nil, nil, models.FilterConfig{}, err
+	}
+	return media, filter, mergeConfigs(filter.Config, tweaks, customConfig), nil
+}
 
-			// Apply sepia
-			if config.Sepia != nil {
-				sepia := *config.Sepia
-				newR := rf*(1-sepia) + (rf*0.393+gf*0.769+bf*0.189)*sepia
-				newG := gf*(1-sepia) + (rf*0.349+gf*0.686+bf*0.168)*sepia
-				newB := bf*(1-sepia) + (rf*0.272+gf*0.534+bf*0.131)*sepia
-				rf, gf, bf = newR, newG, newB
-			}
+func (fs *FilterService) processImage(ctx context.Context, imageData []byte, formatHint string, orientation int, config models.FilterConfig, output models.OutputOptions) ([]byte, string, error) {
+	assets, err := fs.resolveAssets(ctx, config)
+	if err != nil {
+		return nil, "", err
+	}
 
-			// Apply grayscale
-			if config.Grayscale != nil {
-				gray := *config.Grayscale
-				luminance := 0.299*rf + 0.587*gf + 0.114*bf
-				rf = rf*(1-gray) + luminance*gray
-				gf = gf*(1-gray) + luminance*gray
-				bf = bf*(1-gray) + luminance*gray
-			}
+	return fs.renderImage(ctx, imageData, formatHint, orientation, output, func(img image.Image) (image.Image, error) {
+		// CSS-style adjustments and effects run as one buffer pipeline
+		bounds := img.Bounds()
+		return runPipeline(ctx, img, buildPipeline(config, bounds.Dx(), bounds.Dy(), assets))
+	})
+}
 
-			// Apply opacity
-			if config.Opacity != nil {
-				af *= *config.Opacity
+// resolveAssets loads the LUTs and mask images configs reference
+func (fs *FilterService) resolveAssets(ctx context.Context, configs ...models.FilterConfig) (*renderAssets, error) {
+	assets := &renderAssets{luts: map[string]*lut3D{}, masks: map[string]*grayMask{}, logos: map[string]image.Image{}}
+	for _, config := range configs {
+		for _, effect := range config.Effects {
+			switch effect.Type {
+			case "lut":
+				ref := paramString(effect.Params, "lut", "")
+				if _, ok := assets.luts[ref]; ok {
+					continue
+				}
+				l, err := fs.loadLUT(ctx, ref)
+				if err != nil {
+					return nil, err
+				}
+				assets.luts[ref] = l
+			case "watermark":
+				ref := paramString(effect.Params, "logo", "")
+				if _, ok := assets.logos[ref]; ok || ref == "" {
+					continue
+				}
+				logo, err := fs.loadLogo(ctx, ref)
+				if err != nil {
+					return nil, err
+				}
+				assets.logos[ref] = logo
 			}
+		}
 
-			// Apply invert
-			if config.Invert != nil {
-				invert := *config.Invert
-				rf = rf*(1-invert) + (1-rf)*invert
-				gf = gf*(1-invert) + (1-gf)*invert
-				bf = bf*(1-invert) + (1-bf)*invert
+		if mask := config.Mask; mask != nil && mask.Type == models.MaskImage && mask.MaskID != nil {
+			m, err := fs.loadMask(ctx, *mask.MaskID)
+			if err != nil {
+				return nil, err
 			}
-
-			// Clamp values
-			rf = math.Max(0, math.Min(1, rf))
-			gf = math.Max(0, math.Min(1, gf))
-			bf = math.Max(0, math.Min(1, bf))
-			af = math.Max(0, math.Min(1, af))
-
-			// Convert back to uint8
-			processedImg.Set(x, y, color.RGBA{
-				R: uint8(rf * 255),
-				G: uint8(gf * 255),
-				B: uint8(bf * 255),
-				A: uint8(af * 255),
-			})
+			assets.masks[mask.MaskID.Hex()] = m
 		}
 	}
-
-	return processedImg
+	return assets, nil
 }
 
-func (fs *FilterService) applyEffect(img image.Image, effect models.Effect) image.Image {
-	switch effect.Type {
-	case "edge_preserve":
-		return fs.applyEdgePreserve(img, effect.Params)
-	case "brush_strokes":
-		return fs.applyBrushStrokes(img, effect.Params)
-	case "neon_glow":
-		return fs.applyNeonGlow(img, effect.Params)
-	case "vignette":
-		return fs.applyVignette(img, effect.Params)
-	case "warm_filter":
-		return fs.applyWarmFilter(img, effect.Params)
-	case "cell_shading":
-		return fs.applyCellShading(img, effect.Params)
-	default:
-		return img // Return original if effect not implemented
+// renderImage decodes an original, runs transform on it in the working color
+// space and encodes the result
+func (fs *FilterService) renderImage(ctx context.Context, imageData []byte, formatHint string, orientation int, output models.OutputOptions, transform func(image.Image) (image.Image, error)) ([]byte, string, error) {
+	// Decode image
+	decoded, err := decodeImage(ctx, imageData, formatHint, orientation)
+	if err != nil {
+		return nil, "", err
 	}
+	return fs.renderDecoded(ctx, decoded, output, transform)
 }
 
-// Placeholder effect implementations - these would need proper image processing algorithms
-func (fs *FilterService) applyEdgePreserve(img image.Image, params map[string]interface{}) image.Image {
-	// Implement edge-preserving smoothing
-	return img
-}
-
-func (fs *FilterService) applyBrushStrokes(img image.Image, params map[string]interface{}) image.Image {
-	// Implement brush stroke effect
-	return img
-}
-
-func (fs *FilterService) applyNeonGlow(img image.Image, params map[string]interface{}) image.Image {
-	// Implement neon glow effect
-	return img
-}
+// renderDecoded runs transform on an already decoded image and encodes the
+// result. decoded is left untouched, so it can be shared.
+func (fs *FilterService) renderDecoded(ctx context.Context, decoded *decodedImage, output models.OutputOptions, transform func(image.Image) (image.Image, error)) ([]byte, string, error) {
+	// Wide-gamut sources are filtered in their own primaries, on the same
+	// sRGB-encoded values untagged and sRGB images are filtered on
+	img := decoded.Image
+	source := decoded.Profile
+	if source.needsConversion() {
+		img = newColorTransform(source, workingProfile(source)).apply(img)
+	}
 
-func (fs *FilterService) applyVignette(img image.Image, params map[string]interface{}) image.Image {
-	// Implement vignette effect
-	bounds := img.Bounds()
-	processedImg := image.NewRGBA(bounds)
+	processedImg, err := transform(img)
+	if err != nil {
+		return nil, "", err
+	}
 
-	centerX := float64(bounds.Dx()) / 2
-	centerY := float64(bounds.Dy()) / 2
-	maxRadius := math.Sqrt(centerX*centerX + centerY*centerY)
+	processedImg, icc := fs.convertOutputColorSpace(processedImg, source, output.ColorSpace)
 
-	intensity := 0.6
-	if val, ok := params["intensity"].(float64); ok {
-		intensity = val
+	// Encode processed image, keeping the source format unless told otherwise
+	encoded, outputFormat, err := encodeImage(ctx, processedImg, decoded.Format, output, icc)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode processed image: %w", err)
 	}
 
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			r, g, b, a := img.At(x, y).RGBA()
-
-			// Calculate distance from center
-			dx := float64(x) - centerX
-			dy := float64(y) - centerY
-			distance := math.Sqrt(dx*dx + dy*dy)
+	return encoded, outputFormat, nil
+}
 
-			// Calculate vignette factor
-			factor := 1.0 - (distance/maxRadius)*intensity
-			factor = math.Max(0, math.Min(1, factor))
+// convertOutputColorSpace maps the working image to the requested output
+// space and returns the ICC profile to embed, if any
+func (fs *FilterService) convertOutputColorSpace(img image.Image, source *colorProfile, colorSpace string) (image.Image, []byte) {
+	if source == nil {
+		return img, nil
+	}
 
-			// Apply vignette
-			processedImg.Set(x, y, color.RGBA{
-				R: uint8(float64(r>>8) * factor),
-				G: uint8(float64(g>>8) * factor),
-				B: uint8(float64(b>>8) * factor),
-				A: uint8(a >> 8),
-			})
+	if !source.needsConversion() {
+		// sRGB needs no tag; other profiles we can't transform are passed through
+		if source.ColorSpace == ColorSpaceSRGB || colorSpace == models.OutputColorSpaceSRGB {
+			return img, nil
 		}
+		return img, source.Data
 	}
 
-	return processedImg
-}
-
-func (fs *FilterService) applyWarmFilter(img image.Image, params map[string]interface{}) image.Image {
-	// Implement warm color temperature filter
-	return img
+	working := workingProfile(source)
+	if colorSpace == models.OutputColorSpaceSRGB {
+		return newColorTransform(working, srgbProfile).apply(img), nil
+	}
+	return newColorTransform(working, source).apply(img), source.Data
 }
 
-func (fs *FilterService) applyCellShading(img image.Image, params map[string]interface{}) image.Image {
-	// Implement cel shading effect
-	return img
+// ValidateFilterConfig rejects configs that reference unknown effect types
+// or textures, so a typo fails at creation instead of silently doing nothing
+func ValidateFilterConfig(config models.FilterConfig) error {
+	if err := validateEffectsMode(config.EffectsMode); err != nil {
+		return err
+	}
+	if err := validateTone(config); err != nil {
+		return err
+	}
+	if err := validateGeometry(config.Geometry); err != nil {
+		return err
+	}
+	if err := validateMask(config.Mask); err != nil {
+		return err
+	}
+	for i, effect := range config.Effects {
+		if _, ok := effectRegistry[effect.Type]; !ok {
+			return fmt.Errorf("effects[%d]: unknown effect type %q", i, effect.Type)
+		}
+		switch effect.Type {
+		case "texture_overlay":
+			if _, err := loadTexture(paramString(effect.Params, "texture", "watercolor")); err != nil {
+				return fmt.Errorf("effects[%d]: %w", i, err)
+			}
+		case "lut":
+			if err := validateLUTParams(effect.Params); err != nil {
+				return fmt.Errorf("effects[%d]: %w", i, err)
+			}
+		case "watermark":
+			if err := validateWatermarkParams(effect.Params); err != nil {
+				return fmt.Errorf("effects[%d]: %w", i, err)
+			}
+		}
+	}
+	return nil
 }
 
 // Helper functions
@@ -450,33 +352,8 @@ func floatPtr(f float64) *float64 {
 	return &f
 }
 
-func adjustSaturation(r, g, b, saturation float64) (float64, float64, float64) {
-	// Simple saturation adjustment using luminance
-	luminance := 0.299*r + 0.587*g + 0.114*b
-	return r*(1-saturation) + luminance*saturation,
-		g*(1-saturation) + luminance*saturation,
-		b*(1-saturation) + luminance*saturation
-}
-
-func mergeConfigs(base, custom models.FilterConfig) models.FilterConfig {
-	merged := base
-
-	if custom.Brightness != nil {
-		merged.Brightness = custom.Brightness
-	}
-	if custom.Contrast != nil {
-		merged.Contrast = custom.Contrast
-	}
-	if custom.Saturation != nil {
-		merged.Saturation = custom.Saturation
-	}
-	// ... merge other fields
-
-	return merged
-}
-
 func (fs *FilterService) getMediaFile(ctx context.Context, mediaID primitive.ObjectID) (*models.MediaFile, error) {
-	collection := fs.db.Collection("media")
+	collection := fs.db.Collection(mediaCollection)
 	var media models.MediaFile
 	err := collection.FindOne(ctx, bson.M{"_id": mediaID}).Decode(&media)
 	return &media, err
@@ -489,27 +366,85 @@ func (fs *FilterService) getFilterPreset(ctx context.Context, filterID primitive
 	}
 
 	// Then check database for custom presets
-	collection := fs.db.Collection("filter_presets")
+	collection := fs.db.Collection(presetCollection)
 	var preset models.FilterPreset
 	err := collection.FindOne(ctx, bson.M{"_id": filterID}).Decode(&preset)
 	return &preset, err
 }
 
-func (fs *FilterService) recordFilterApplication(ctx context.Context, mediaID, userID, filterID primitive.ObjectID, customConfig *models.FilterConfig) {
+func (fs *FilterService) recordFilterApplication(ctx context.Context, mediaID, userID primitive.ObjectID, preset *models.FilterPreset, customConfig *models.FilterConfig) {
 	application := models.FilterApplication{
-		ID:           primitive.NewObjectID(),
-		MediaID:      mediaID,
-		UserID:       userID,
-		FilterID:     filterID,
-		CustomConfig: customConfig,
-		AppliedAt:    time.Now(),
+		ID:            primitive.NewObjectID(),
+		MediaID:       mediaID,
+		UserID:        userID,
+		FilterID:      preset.ID,
+		CustomConfig:  customConfig,
+		PresetVersion: preset.Version,
+		AppliedAt:     time.Now(),
 	}
 
 	collection := fs.db.Collection("filter_applications")
 	collection.InsertOne(ctx, application)
 
 	// Update user preferences
-	fs.updateUserPreferences(ctx, userID, filterID)
+	fs.updateUserPreferences(ctx, userID, preset.ID)
+}
+
+// GetPresetTweaks returns the user's saved adjustments for a preset, or nil
+// if there are none
+func (fs *FilterService) GetPresetTweaks(ctx context.Context, userID, filterID primitive.ObjectID) (*models.FilterConfig, error) {
+	var prefs models.UserFilterPreference
+	opts := options.FindOne().SetProjection(bson.M{"presetTweaks." + filterID.Hex(): 1})
+	err := fs.db.Collection("user_filter_preferences").FindOne(ctx, bson.M{"userId": userID}, opts).Decode(&prefs)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load preset tweaks: %w", err)
+	}
+
+	tweaks, ok := prefs.PresetTweaks[filterID.Hex()]
+	if !ok {
+		return nil, nil
+	}
+	return &tweaks, nil
+}
+
+// SavePresetTweaks stores the user's adjustments for a preset, applied on top
+// of it every time they use it
+func (fs *FilterService) SavePresetTweaks(ctx context.Context, userID, filterID primitive.ObjectID, tweaks models.FilterConfig) error {
+	if _, err := fs.getAccessiblePreset(ctx, filterID, userID); err != nil {
+		return err
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"presetTweaks." + filterID.Hex(): tweaks,
+			"updatedAt":                      time.Now(),
+		},
+		"$setOnInsert": bson.M{
+			"userId":         userID,
+			"frequentlyUsed": []primitive.ObjectID{},
+			"customPresets":  []primitive.ObjectID{},
+			"styleProfile":   models.StyleProfile{},
+			"usageCount":     map[string]int{},
+			"createdAt":      time.Now(),
+		},
+	}
+	_, err := fs.db.Collection("user_filter_preferences").UpdateOne(ctx, bson.M{"userId": userID}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save preset tweaks: %w", err)
+	}
+	return nil
+}
+
+// DeletePresetTweaks discards the user's saved adjustments for a preset
+func (fs *FilterService) DeletePresetTweaks(ctx context.Context, userID, filterID primitive.ObjectID) error {
+	update := bson.M{"$unset": bson.M{"presetTweaks." + filterID.Hex(): ""}}
+	if _, err := fs.db.Collection("user_filter_preferences").UpdateOne(ctx, bson.M{"userId": userID}, update); err != nil {
+		return fmt.Errorf("failed to delete preset tweaks: %w", err)
+	}
+	return nil
 }
 
 func (fs *FilterService) updateUserPreferences(ctx context.Context, userID, filterID primitive.ObjectID) {
@@ -382,8 +382,8 @@ func (fas *FilterAnalyticsService) getRecentActivity(ctx context.Context, userID
 
 	recentActivity := []models.RecentFilterApplication{}
 	for _, app := range applications {
-		// Get filter and media details
-		filter, err := fas.getFilterPreset(ctx, app.FilterID)
+		// Get filter and media details, with the preset as it was applied
+		filter, err := presetAtVersion(ctx, fas.db, app.FilterID, app.PresetVersion)
 		if err != nil {
 			continue
 		}
@@ -411,7 +411,7 @@ func (fas *FilterAnalyticsService) getFilterPreset(ctx context.Context, filterID
 }
 
 func (fas *FilterAnalyticsService) getMediaFile(ctx context.Context, mediaID primitive.ObjectID) (*models.MediaFile, error) {
-	collection := fas.db.Collection("media")
+	collection := fas.db.Collection(mediaCollection)
 	var media models.MediaFile
 	err := collection.FindOne(ctx, bson.M{"_id": mediaID}).Decode(&media)
 	return &media, err
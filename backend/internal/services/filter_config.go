@@ -0,0 +1,251 @@
+package services
+
+import (
+	"fmt"
+
+	"mediaVault-backend/internal/models"
+)
+
+// mergeConfigs stacks config layers from bottom to top, e.g. preset, the
+// user's saved tweaks, then a per-request override. Every CSS field set in a
+// higher layer replaces the value underneath; effects combine according to
+// the higher layer's EffectsMode. Nil layers are skipped and the inputs are
+// never modified, since the bottom layer is usually a shared preset.
+func mergeConfigs(base models.FilterConfig, layers ...*models.FilterConfig) models.FilterConfig {
+	merged := base
+	merged.Effects = cloneEffects(base.Effects)
+	merged.EffectsMode = ""
+
+	for _, layer := range layers {
+		if layer == nil {
+			continue
+		}
+		for _, field := range []struct {
+			dst **float64
+			src *float64
+		}{
+			{&merged.Brightness, layer.Brightness},
+			{&merged.Contrast, layer.Contrast},
+			{&merged.Saturation, layer.Saturation},
+			{&merged.Hue, layer.Hue},
+			{&merged.Sepia, layer.Sepia},
+			{&merged.Grayscale, layer.Grayscale},
+			{&merged.Blur, layer.Blur},
+			{&merged.Opacity, layer.Opacity},
+			{&merged.Invert, layer.Invert},
+		} {
+			if field.src != nil {
+				v := *field.src
+				*field.dst = &v
+			}
+		}
+		merged.Levels = mergeLevels(merged.Levels, layer.Levels)
+		merged.Curves = mergeCurves(merged.Curves, layer.Curves)
+		merged.HSL = mergeHSL(merged.HSL, layer.HSL)
+		merged.Geometry = mergeGeometry(merged.Geometry, layer.Geometry)
+		if layer.Mask != nil {
+			// Masks are replaced whole; a "none" mask clears one from below
+			mask := *layer.Mask
+			merged.Mask = &mask
+			if mask.Type == models.MaskNone {
+				merged.Mask = nil
+			}
+		}
+		merged.Effects = mergeEffects(merged.Effects, layer.Effects, layer.EffectsMode)
+	}
+
+	return merged
+}
+
+// mergeLevels overrides levels field by field
+func mergeLevels(base, overlay *models.LevelsConfig) *models.LevelsConfig {
+	if overlay == nil {
+		return base
+	}
+	merged := models.LevelsConfig{}
+	if base != nil {
+		merged = *base
+	}
+	if overlay.InputBlack != nil {
+		merged.InputBlack = overlay.InputBlack
+	}
+	if overlay.InputWhite != nil {
+		merged.InputWhite = overlay.InputWhite
+	}
+	if overlay.Gamma != nil {
+		merged.Gamma = overlay.Gamma
+	}
+	if overlay.OutputBlack != nil {
+		merged.OutputBlack = overlay.OutputBlack
+	}
+	if overlay.OutputWhite != nil {
+		merged.OutputWhite = overlay.OutputWhite
+	}
+	return &merged
+}
+
+// mergeCurves replaces each curve the overlay sets; an empty curve resets
+// that channel to linear
+func mergeCurves(base, overlay *models.ToneCurves) *models.ToneCurves {
+	if overlay == nil {
+		return base
+	}
+	merged := models.ToneCurves{}
+	if base != nil {
+		merged = *base
+	}
+	if overlay.RGB != nil {
+		merged.RGB = overlay.RGB
+	}
+	if overlay.Red != nil {
+		merged.Red = overlay.Red
+	}
+	if overlay.Green != nil {
+		merged.Green = overlay.Green
+	}
+	if overlay.Blue != nil {
+		merged.Blue = overlay.Blue
+	}
+	return &merged
+}
+
+// mergeHSL overrides each band's hue, saturation and luminance separately
+func mergeHSL(base, overlay map[string]models.HSLAdjustment) map[string]models.HSLAdjustment {
+	if len(overlay) == 0 {
+		return base
+	}
+	merged := make(map[string]models.HSLAdjustment, len(base)+len(overlay))
+	for band, adj := range base {
+		merged[band] = adj
+	}
+	for band, adj := range overlay {
+		m := merged[band]
+		if adj.Hue != nil {
+			m.Hue = adj.Hue
+		}
+		if adj.Saturation != nil {
+			m.Saturation = adj.Saturation
+		}
+		if adj.Luminance != nil {
+			m.Luminance = adj.Luminance
+		}
+		merged[band] = m
+	}
+	return merged
+}
+
+// mergeGeometry overrides geometry field by field, so e.g. a request can
+// rotate an image a preset crops to a square
+func mergeGeometry(base, overlay *models.GeometryConfig) *models.GeometryConfig {
+	if overlay == nil {
+		return base
+	}
+	merged := models.GeometryConfig{}
+	if base != nil {
+		merged = *base
+	}
+	if overlay.Rotate != nil {
+		merged.Rotate = overlay.Rotate
+	}
+	if overlay.FlipH != nil {
+		merged.FlipH = overlay.FlipH
+	}
+	if overlay.FlipV != nil {
+		merged.FlipV = overlay.FlipV
+	}
+	if overlay.Straighten != nil {
+		merged.Straighten = overlay.Straighten
+	}
+	if overlay.Crop != nil {
+		merged.Crop = overlay.Crop
+	}
+	if overlay.Aspect != "" {
+		merged.Aspect = overlay.Aspect
+	}
+	if overlay.FocalX != nil {
+		merged.FocalX = overlay.FocalX
+	}
+	if overlay.FocalY != nil {
+		merged.FocalY = overlay.FocalY
+	}
+	return &merged
+}
+
+// mergeEffects combines an effect list with the one from the layer above.
+// A nil overlay leaves the effects untouched, except in replace mode where
+// an explicitly empty list clears them.
+func mergeEffects(base, overlay []models.Effect, mode string) []models.Effect {
+	switch mode {
+	case models.EffectsMergeReplace:
+		if overlay == nil {
+			return base
+		}
+		return cloneEffects(withoutRemoved(overlay))
+	case models.EffectsMergeAppend:
+		return append(base, cloneEffects(withoutRemoved(overlay))...)
+	}
+
+	for _, effect := range overlay {
+		i := indexOfEffect(base, effect.Type)
+		switch {
+		case effect.Remove:
+			for ; i >= 0; i = indexOfEffect(base, effect.Type) {
+				base = append(base[:i], base[i+1:]...)
+			}
+		case i >= 0:
+			for key, value := range effect.Params {
+				if base[i].Params == nil {
+					base[i].Params = make(map[string]interface{})
+				}
+				base[i].Params[key] = value
+			}
+		default:
+			base = append(base, cloneEffects([]models.Effect{effect})...)
+		}
+	}
+	return base
+}
+
+func indexOfEffect(effects []models.Effect, effectType string) int {
+	for i, effect := range effects {
+		if effect.Type == effectType {
+			return i
+		}
+	}
+	return -1
+}
+
+func withoutRemoved(effects []models.Effect) []models.Effect {
+	var kept []models.Effect
+	for _, effect := range effects {
+		if !effect.Remove {
+			kept = append(kept, effect)
+		}
+	}
+	return kept
+}
+
+// cloneEffects copies effects and their param maps so merged configs can be
+// modified freely
+func cloneEffects(effects []models.Effect) []models.Effect {
+	if effects == nil {
+		return nil
+	}
+	out := make([]models.Effect, len(effects))
+	for i, effect := range effects {
+		out[i] = models.Effect{Type: effect.Type, Params: make(map[string]interface{}, len(effect.Params))}
+		for key, value := range effect.Params {
+			out[i].Params[key] = value
+		}
+	}
+	return out
+}
+
+func validateEffectsMode(mode string) error {
+	switch mode {
+	case "", models.EffectsMergeByType, models.EffectsMergeAppend, models.EffectsMergeReplace:
+		return nil
+	}
+	return fmt.Errorf("unknown effectsMode %q (use %s, %s or %s)", mode,
+		models.EffectsMergeByType, models.EffectsMergeAppend, models.EffectsMergeReplace)
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"mediaVault-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func effect(effectType string, params map[string]interface{}) models.Effect {
+	return models.Effect{Type: effectType, Params: params}
+}
+
+func effectTypes(effects []models.Effect) []string {
+	types := []string{}
+	for _, e := range effects {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+func TestMergeConfigsEffects(t *testing.T) {
+	base := models.FilterConfig{Effects: []models.Effect{
+		effect("vignette", map[string]interface{}{"intensity": 0.5, "radius": 0.8}),
+		effect("film_grain", map[string]interface{}{"amount": 0.2}),
+	}}
+
+	tests := []struct {
+		name   string
+		layer  models.FilterConfig
+		want   []string
+		params map[string]interface{} // expected params of the first effect
+	}{
+		{
+			name:   "byType overrides params",
+			layer:  models.FilterConfig{Effects: []models.Effect{effect("vignette", map[string]interface{}{"intensity": 0.9})}},
+			want:   []string{"vignette", "film_grain"},
+			params: map[string]interface{}{"intensity": 0.9, "radius": 0.8},
+		},
+		{
+			name:  "byType adds new types",
+			layer: models.FilterConfig{Effects: []models.Effect{effect("warm_filter", nil)}},
+			want:  []string{"vignette", "film_grain", "warm_filter"},
+		},
+		{
+			name:  "byType removes",
+			layer: models.FilterConfig{Effects: []models.Effect{{Type: "vignette", Remove: true}}},
+			want:  []string{"film_grain"},
+		},
+		{
+			name: "append",
+			layer: models.FilterConfig{EffectsMode: models.EffectsMergeAppend, Effects: []models.Effect{
+				effect("vignette", map[string]interface{}{"intensity": 0.1}),
+			}},
+			want:   []string{"vignette", "film_grain", "vignette"},
+			params: map[string]interface{}{"intensity": 0.5, "radius": 0.8},
+		},
+		{
+			name:  "replace",
+			layer: models.FilterConfig{EffectsMode: models.EffectsMergeReplace, Effects: []models.Effect{effect("warm_filter", nil)}},
+			want:  []string{"warm_filter"},
+		},
+		{
+			name:  "replace with nil keeps",
+			layer: models.FilterConfig{EffectsMode: models.EffectsMergeReplace},
+			want:  []string{"vignette", "film_grain"},
+		},
+		{
+			name:  "replace with empty clears",
+			layer: models.FilterConfig{EffectsMode: models.EffectsMergeReplace, Effects: []models.Effect{}},
+			want:  []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged := mergeConfigs(base, &tt.layer)
+			if got := effectTypes(merged.Effects); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("effects = %v, want %v", got, tt.want)
+			}
+			if tt.params != nil && !reflect.DeepEqual(merged.Effects[0].Params, tt.params) {
+				t.Errorf("params = %v, want %v", merged.Effects[0].Params, tt.params)
+			}
+		})
+	}
+
+	// The shared base layer is never modified
+	if got := base.Effects[0].Params["intensity"]; got != 0.5 || len(base.Effects) != 2 {
+		t.Errorf("base was modified: %+v", base.Effects)
+	}
+}
+
+func TestMergeConfigsLayers(t *testing.T) {
+	preset := models.FilterConfig{
+		Brightness: floatPtr(1.2),
+		Contrast:   floatPtr(1.1),
+		Levels:     &models.LevelsConfig{InputBlack: floatPtr(10), Gamma: floatPtr(1.2)},
+		Curves:     &models.ToneCurves{RGB: []models.CurvePoint{{X: 0, Y: 20}, {X: 255, Y: 255}}, Red: []models.CurvePoint{{X: 128, Y: 140}}},
+		HSL:        map[string]models.HSLAdjustment{models.HSLReds: {Hue: floatPtr(10), Saturation: floatPtr(20)}},
+		Mask:       &models.MaskConfig{Type: models.MaskEllipse},
+	}
+	tweaks := &models.FilterConfig{
+		Contrast: floatPtr(0.9),
+		Levels:   &models.LevelsConfig{Gamma: floatPtr(0.8)},
+		Curves:   &models.ToneCurves{Red: []models.CurvePoint{}},
+		HSL:      map[string]models.HSLAdjustment{models.HSLReds: {Saturation: floatPtr(-30)}, models.HSLBlues: {Luminance: floatPtr(5)}},
+	}
+	request := &models.FilterConfig{
+		Brightness: floatPtr(1),
+		Mask:       &models.MaskConfig{Type: models.MaskNone},
+	}
+
+	merged := mergeConfigs(preset, tweaks, nil, request)
+
+	if *merged.Brightness != 1 || *merged.Contrast != 0.9 {
+		t.Errorf("brightness %v, contrast %v; want 1 and 0.9", *merged.Brightness, *merged.Contrast)
+	}
+	if l := merged.Levels; *l.InputBlack != 10 || *l.Gamma != 0.8 || l.InputWhite != nil {
+		t.Errorf("levels = %+v", l)
+	}
+	if c := merged.Curves; len(c.RGB) != 2 || c.Red == nil || len(c.Red) != 0 {
+		t.Errorf("curves = %+v, want RGB kept and red reset", c)
+	}
+	reds := merged.HSL[models.HSLReds]
+	if *reds.Hue != 10 || *reds.Saturation != -30 || merged.HSL[models.HSLBlues].Luminance == nil {
+		t.Errorf("hsl = %+v", merged.HSL)
+	}
+	if merged.Mask != nil {
+		t.Errorf("mask = %+v, want cleared", merged.Mask)
+	}
+
+	// Lower layers are left as they were
+	if *preset.Contrast != 1.1 || *preset.Levels.Gamma != 1.2 || len(preset.Curves.Red) != 1 || *preset.HSL[models.HSLReds].Saturation != 20 {
+		t.Errorf("preset was modified: %+v", preset)
+	}
+}
+
+// Saved tweaks go through BSON; an empty replace list must still clear the
+// preset's effects afterwards
+func TestEffectsBSONRoundTrip(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		effects []models.Effect
+		wantNil bool
+	}{
+		{"nil", nil, true},
+		{"empty", []models.Effect{}, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := bson.Marshal(models.FilterConfig{EffectsMode: models.EffectsMergeReplace, Effects: tt.effects})
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			var decoded models.FilterConfig
+			if err := bson.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if (decoded.Effects == nil) != tt.wantNil {
+				t.Fatalf("effects = %#v after round trip", decoded.Effects)
+			}
+
+			base := models.FilterConfig{Effects: []models.Effect{effect("vignette", nil)}}
+			merged := mergeConfigs(base, &decoded)
+			if cleared := len(merged.Effects) == 0; cleared == tt.wantNil {
+				t.Errorf("effects after merge = %v", effectTypes(merged.Effects))
+			}
+		})
+	}
+}
@@ -0,0 +1,845 @@
+package services
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// applyEdgePreserve smooths flat regions while keeping edges sharp, using the
+// recursive domain transform filter (Gastal & Oliveira 2011).
+// Params: strength (0-1).
+func applyEdgePreserve(buf *rgbBuffer, params map[string]interface{}) {
+	strength := clampParam(paramFloat(params, "strength", 0.5), 0, 1)
+	if strength == 0 {
+		return
+	}
+
+	scale := effectScale(buf.w, buf.h)
+	domainTransform(buf, (5+45*strength)*scale, 0.1+0.4*strength, 3)
+}
+
+// domainTransform runs the recursive edge-aware filter in place. sigmaS is
+// the spatial extent in pixels, sigmaR the range (color difference) extent.
+func domainTransform(buf *rgbBuffer, sigmaS, sigmaR float64, iterations int) {
+	w, h := buf.w, buf.h
+	ratio := float32(sigmaS / sigmaR)
+
+	// Horizontal and vertical derivatives of the domain transform
+	dH := make([]float32, w*h)
+	dV := make([]float32, w*h)
+	parallelFor(h, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			for x := 0; x < w; x++ {
+				i := y*w + x
+				if x > 0 {
+					dH[i] = 1 + ratio*channelDistance(buf.pix, i, i-1)
+				}
+				if y > 0 {
+					dV[i] = 1 + ratio*channelDistance(buf.pix, i, i-w)
+				}
+			}
+		}
+	})
+
+	for it := 0; it < iterations; it++ {
+		sigmaH := sigmaS * math.Sqrt(3) * math.Pow(2, float64(iterations-it-1)) / math.Sqrt(math.Pow(4, float64(iterations))-1)
+		a := math.Exp(-math.Sqrt(2) / sigmaH)
+
+		weights := func(d []float32) []float32 {
+			v := make([]float32, len(d))
+			parallelFor(len(d), func(start, end int) {
+				for i := start; i < end; i++ {
+					v[i] = float32(math.Pow(a, float64(d[i])))
+				}
+			})
+			return v
+		}
+		wH, wV := weights(dH), weights(dV)
+
+		// Rows are independent in the horizontal pass and columns in the
+		// vertical one
+		parallelFor(h, func(y0, y1 int) {
+			for y := y0; y < y1; y++ {
+				for x := 1; x < w; x++ {
+					recursiveStep(buf.pix, y*w+x, y*w+x-1, wH[y*w+x])
+				}
+				for x := w - 2; x >= 0; x-- {
+					recursiveStep(buf.pix, y*w+x, y*w+x+1, wH[y*w+x+1])
+				}
+			}
+		})
+		parallelFor(w, func(x0, x1 int) {
+			for x := x0; x < x1; x++ {
+				for y := 1; y < h; y++ {
+					recursiveStep(buf.pix, y*w+x, (y-1)*w+x, wV[y*w+x])
+				}
+				for y := h - 2; y >= 0; y-- {
+					recursiveStep(buf.pix, y*w+x, (y+1)*w+x, wV[(y+1)*w+x])
+				}
+			}
+		})
+	}
+}
+
+func recursiveStep(pix []float32, i, prev int, weight float32) {
+	for c := 0; c < 3; c++ {
+		pix[i*3+c] += weight * (pix[prev*3+c] - pix[i*3+c])
+	}
+}
+
+func channelDistance(pix []float32, i, j int) float32 {
+	var d float32
+	for c := 0; c < 3; c++ {
+		diff := pix[i*3+c] - pix[j*3+c]
+		if diff < 0 {
+			diff = -diff
+		}
+		d += diff
+	}
+	return d
+}
+
+// applyBrushStrokes paints the image with a Kuwahara filter: each pixel takes
+// the mean color of the least varied of its four surrounding quadrants.
+// Params: size (brush radius in pixels at 1MP), strength (0-1 blend).
+func applyBrushStrokes(buf *rgbBuffer, params map[string]interface{}) {
+	strength := clampParam(paramFloat(params, "strength", 0.7), 0, 1)
+	size := clampParam(paramFloat(params, "size", 3), 1, 20)
+	if strength == 0 {
+		return
+	}
+
+	w, h := buf.w, buf.h
+	radius := int(math.Round(size * effectScale(w, h)))
+
+	// Summed-area tables of each channel and of squared luminance make every
+	// quadrant mean and variance O(1). They are built per tile, with a
+	// radius-sized margin, so they take a few MB per worker rather than
+	// several times the buffer; tiles of at least 4x the radius keep the
+	// margin's extra work small.
+	tile := max(64, 4*radius)
+	tilesX, tilesY := (w+tile-1)/tile, (h+tile-1)/tile
+	out := make([]float32, len(buf.pix))
+	parallelFor(tilesX*tilesY, func(t0, t1 int) {
+		var sums []float64 // interleaved r, g, b, lum² per entry
+		for t := t0; t < t1; t++ {
+			tx0, ty0 := (t%tilesX)*tile, (t/tilesX)*tile
+			tx1, ty1 := min(tx0+tile, w), min(ty0+tile, h)
+
+			// The table covers every quadrant of the tile's pixels
+			ox, oy := max(tx0-radius, 0), max(ty0-radius, 0)
+			sw, sh := min(tx1+radius, w)-ox, min(ty1+radius, h)-oy
+			stride := (sw + 1) * 4
+			if cap(sums) < stride*(sh+1) {
+				sums = make([]float64, stride*(sh+1))
+			}
+			sums = sums[:stride*(sh+1)]
+			clear(sums[:stride])
+			for y := 0; y < sh; y++ {
+				var row [4]float64
+				above, cur := sums[y*stride:], sums[(y+1)*stride:]
+				clear(cur[:4])
+				for x := 0; x < sw; x++ {
+					i := (oy+y)*w + ox + x
+					r, g, b := float64(buf.pix[i*3]), float64(buf.pix[i*3+1]), float64(buf.pix[i*3+2])
+					lum := 0.299*r + 0.587*g + 0.114*b
+					row[0] += r
+					row[1] += g
+					row[2] += b
+					row[3] += lum * lum
+					for k := 0; k < 4; k++ {
+						cur[(x+1)*4+k] = above[(x+1)*4+k] + row[k]
+					}
+				}
+			}
+			// area sums channel k over [x0, x1) x [y0, y1) in image coordinates
+			area := func(k, x0, y0, x1, y1 int) float64 {
+				x0, x1, y0, y1 = (x0-ox)*4+k, (x1-ox)*4+k, y0-oy, y1-oy
+				return sums[y1*stride+x1] - sums[y0*stride+x1] - sums[y1*stride+x0] + sums[y0*stride+x0]
+			}
+
+			for y := ty0; y < ty1; y++ {
+				for x := tx0; x < tx1; x++ {
+					bestVariance := math.MaxFloat64
+					var best [3]float64
+
+					for _, q := range [4][2]int{{-1, -1}, {0, -1}, {-1, 0}, {0, 0}} {
+						x0 := max(x+q[0]*radius, 0)
+						y0 := max(y+q[1]*radius, 0)
+						x1 := min(x+(q[0]+1)*radius, w-1) + 1
+						y1 := min(y+(q[1]+1)*radius, h-1) + 1
+						n := float64((x1 - x0) * (y1 - y0))
+
+						r := area(0, x0, y0, x1, y1) / n
+						g := area(1, x0, y0, x1, y1) / n
+						b := area(2, x0, y0, x1, y1) / n
+						lum := 0.299*r + 0.587*g + 0.114*b
+						variance := area(3, x0, y0, x1, y1)/n - lum*lum
+
+						if variance < bestVariance {
+							bestVariance = variance
+							best = [3]float64{r, g, b}
+						}
+					}
+
+					i := (y*w + x) * 3
+					for c := 0; c < 3; c++ {
+						out[i+c] = buf.pix[i+c] + float32(strength)*(float32(best[c])-buf.pix[i+c])
+					}
+				}
+			}
+		}
+	})
+	buf.pix = out
+}
+
+// applyNeonGlow makes highlights bloom in a neon color: bright areas are
+// thresholded, tinted, blurred and screened back over the image.
+// Params: color (hex), intensity (0-1), threshold (0-1, default 0.6).
+func applyNeonGlow(buf *rgbBuffer, params map[string]interface{}) {
+	intensity := clampParam(paramFloat(params, "intensity", 0.8), 0, 1)
+	threshold := clampParam(paramFloat(params, "threshold", 0.6), 0, 0.99)
+	glowColor := parseHexColor(paramString(params, "color", "#00ff41"), [3]float32{0, 1, 0.25})
+	if intensity == 0 {
+		return
+	}
+
+	lum := buf.luminance()
+	glow := make([]float32, len(buf.pix))
+	parallelFor(len(lum), func(start, end int) {
+		for i := start; i < end; i++ {
+			mask := clampUnit((lum[i] - float32(threshold)) / (1 - float32(threshold)))
+			for c := 0; c < 3; c++ {
+				// Mix the highlight's own color with the neon color so it still reads
+				glow[i*3+c] = mask * (0.35*buf.pix[i*3+c] + 0.65*glowColor[c])
+			}
+		}
+	})
+	gaussianBlur(glow, buf.w, buf.h, 3, (4+12*intensity)*effectScale(buf.w, buf.h))
+
+	amount := float32(intensity) * 1.5
+	parallelFor(len(buf.pix), func(start, end int) {
+		for i := start; i < end; i++ {
+			g := clampUnit(glow[i] * amount)
+			buf.pix[i] = 1 - (1-buf.pix[i])*(1-g)
+		}
+	})
+}
+
+// warmFilterOp shifts white balance as if lit by a light source of the
+// given color temperature, relative to 6500K daylight. Lower temperatures
+// warm the image, higher ones cool it; overall brightness is preserved.
+// Params: temperature (Kelvin, 1000-40000), strength (0-1, default 1).
+func warmFilterOp(params map[string]interface{}, w, h int) pixelFunc {
+	temperature := clampParam(paramFloat(params, "temperature", 3200), 1000, 40000)
+	strength := clampParam(paramFloat(params, "strength", 1), 0, 1)
+
+	target := kelvinToRGB(temperature)
+	reference := kelvinToRGB(6500)
+	var gains [3]float64
+	for c := range gains {
+		gains[c] = 1 + strength*(target[c]/reference[c]-1)
+	}
+	norm := 0.299*gains[0] + 0.587*gains[1] + 0.114*gains[2]
+	if strength == 0 {
+		return nil
+	}
+
+	gr, gg, gb := float32(gains[0]/norm), float32(gains[1]/norm), float32(gains[2]/norm)
+	return func(x, y int, px *[4]float32) {
+		px[0] = clampUnit(px[0] * gr)
+		px[1] = clampUnit(px[1] * gg)
+		px[2] = clampUnit(px[2] * gb)
+	}
+}
+
+// kelvinToRGB approximates the color of a black body at the given
+// temperature (Tanner Helland's fit to the CIE data), in 0..1
+func kelvinToRGB(kelvin float64) [3]float64 {
+	t := kelvin / 100
+	var r, g, b float64
+
+	if t <= 66 {
+		r = 255
+		g = 99.4708025861*math.Log(t) - 161.1195681661
+	} else {
+		r = 329.698727446 * math.Pow(t-60, -0.1332047592)
+		g = 288.1221695283 * math.Pow(t-60, -0.0755148492)
+	}
+
+	switch {
+	case t >= 66:
+		b = 255
+	case t <= 19:
+		b = 0
+	default:
+		b = 138.5177312231*math.Log(t-10) - 305.0447927307
+	}
+
+	return [3]float64{
+		math.Max(1, math.Min(255, r)) / 255,
+		math.Max(1, math.Min(255, g)) / 255,
+		math.Max(1, math.Min(255, b)) / 255,
+	}
+}
+
+// applyCellShading flattens the image into a few tone bands and draws dark
+// outlines along strong edges, like hand-inked cel animation.
+// Params: levels (2-16), smoothing (0-1), edgeThreshold (0-1, default 0.25).
+func applyCellShading(buf *rgbBuffer, params map[string]interface{}) {
+	levels := int(clampParam(paramFloat(params, "levels", 4), 2, 16))
+	smoothing := clampParam(paramFloat(params, "smoothing", 0.2), 0, 1)
+	edgeThreshold := float32(clampParam(paramFloat(params, "edgeThreshold", 0.25), 0.01, 1))
+
+	scale := effectScale(buf.w, buf.h)
+
+	// Smooth texture away first so bands and outlines follow real shapes
+	if smoothing > 0 {
+		domainTransform(buf, (5+35*smoothing)*scale, 0.1+0.3*smoothing, 2)
+	}
+
+	lum := buf.luminance()
+	gaussianBlur(lum, buf.w, buf.h, 1, 0.6*scale)
+	edges := sobelMagnitude(lum, buf.w, buf.h)
+
+	bands := float32(levels)
+	parallelFor(len(lum), func(start, end int) {
+		for i := start; i < end; i++ {
+			// Quantize brightness to band centers and keep the hue by scaling
+			// all channels together
+			l := luma(buf.pix[i*3], buf.pix[i*3+1], buf.pix[i*3+2])
+			band := float32(math.Min(math.Floor(float64(l*bands)), float64(levels-1)))
+			banded := (band + 0.5) / bands
+			gain := float32(1)
+			if l > 0.001 {
+				gain = banded / l
+			}
+
+			// Soft ink line: fade to black over the threshold band
+			ink := 1 - clampUnit((edges[i]-edgeThreshold)/edgeThreshold)
+			for c := 0; c < 3; c++ {
+				buf.pix[i*3+c] = clampUnit(buf.pix[i*3+c]*gain) * ink
+			}
+		}
+	})
+}
+
+// paramFloat reads a numeric effect parameter. Presets built in Go use ints
+// and floats, while values decoded from BSON or JSON arrive as other numeric types.
+func paramFloat(params map[string]interface{}, key string, def float64) float64 {
+	switch v := params[key].(type) {
+	case float64:
+		return v
+	case float32:
+		return float64(v)
+	case int:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return def
+}
+
+func paramString(params map[string]interface{}, key, def string) string {
+	if v, ok := params[key].(string); ok && v != "" {
+		return v
+	}
+	return def
+}
+
+func paramBool(params map[string]interface{}, key string, def bool) bool {
+	switch v := params[key].(type) {
+	case bool:
+		return v
+	case string:
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return def
+}
+
+func clampParam(v, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(hi, v))
+}
+
+// parseHexColor parses #rgb or #rrggbb into 0..1 channels
+func parseHexColor(hex string, def [3]float32) [3]float32 {
+	hex = strings.TrimPrefix(strings.TrimSpace(hex), "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 {
+		return def
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return def
+	}
+	return [3]float32{
+		float32(v>>16&0xff) / 255,
+		float32(v>>8&0xff) / 255,
+		float32(v&0xff) / 255,
+	}
+}
+
+// textureOverlayOp overlays a tileable paper or canvas texture.
+// Params: texture (watercolor, canvas, paper), opacity (0-1).
+func textureOverlayOp(params map[string]interface{}, w, h int) pixelFunc {
+	opacity := float32(clampParam(paramFloat(params, "opacity", 0.4), 0, 1))
+	tex, err := loadTexture(paramString(params, "texture", "watercolor"))
+	if err != nil || opacity == 0 {
+		return nil
+	}
+
+	scale := effectScale(w, h)
+	return func(x, y int, px *[4]float32) {
+		t := tex.at(x, y, scale)
+		for c := 0; c < 3; c++ {
+			px[c] += opacity * (overlayBlend(px[c], t) - px[c])
+		}
+	}
+}
+
+// applyImpasto fakes thick paint by lighting the image as a height map from
+// the top left, with a canvas weave showing through.
+// Params: depth (0-1).
+func applyImpasto(buf *rgbBuffer, params map[string]interface{}) {
+	depth := float32(clampParam(paramFloat(params, "depth", 0.5), 0, 1))
+	if depth == 0 {
+		return
+	}
+
+	w, h := buf.w, buf.h
+	scale := effectScale(w, h)
+	canvas, _ := loadTexture("canvas")
+
+	height := buf.luminance()
+	gaussianBlur(height, w, h, 1, 1.2*scale)
+
+	at := func(x, y int) float32 {
+		return height[min(max(y, 0), h-1)*w+min(max(x, 0), w-1)]
+	}
+	parallelFor(h, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			for x := 0; x < w; x++ {
+				// Directional derivative towards the light
+				relief := (at(x-1, y-1) - at(x+1, y+1)) * 4
+				if canvas != nil {
+					relief += (canvas.at(x, y, scale) - 0.5) * 0.3
+				}
+				shade := 1 + depth*relief
+				i := (y*w + x) * 3
+				for c := 0; c < 3; c++ {
+					buf.pix[i+c] = clampUnit(buf.pix[i+c] * shade)
+				}
+			}
+		}
+	})
+}
+
+// applyChromaticAberration splits color channels radially like a cheap lens:
+// red is pushed outwards and blue pulled inwards, growing towards the edges.
+// Params: strength (0-1).
+func applyChromaticAberration(buf *rgbBuffer, params map[string]interface{}) {
+	strength := clampParam(paramFloat(params, "strength", 0.3), 0, 1)
+	if strength == 0 {
+		return
+	}
+
+	src := buf.clone()
+	w, h := buf.w, buf.h
+	cx, cy := float64(w-1)/2, float64(h-1)/2
+	// Maximum shift at the corners, as a fraction of the image size
+	shift := strength * 0.012
+
+	parallelFor(h, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			for x := 0; x < w; x++ {
+				dx, dy := float64(x)-cx, float64(y)-cy
+				i := (y*w + x) * 3
+				buf.pix[i] = src.sample(cx+dx*(1+shift), cy+dy*(1+shift), 0)
+				buf.pix[i+2] = src.sample(cx+dx*(1-shift), cy+dy*(1-shift), 2)
+			}
+		}
+	})
+}
+
+// scanlinesOp darkens alternating rows like a CRT display.
+// Params: density (0-1, higher means finer lines), opacity (0-1).
+func scanlinesOp(params map[string]interface{}, w, h int) pixelFunc {
+	density := clampParam(paramFloat(params, "density", 0.2), 0.01, 1)
+	opacity := clampParam(paramFloat(params, "opacity", 0.1), 0, 1)
+	if opacity == 0 {
+		return nil
+	}
+
+	period := math.Max(2, (2+(1-density)*6)*effectScale(w, h))
+	factors := make([]float32, h)
+	for y := range factors {
+		factors[y] = float32(1 - opacity*(0.5+0.5*math.Cos(2*math.Pi*float64(y)/period)))
+	}
+	return func(x, y int, px *[4]float32) {
+		px[0] *= factors[y]
+		px[1] *= factors[y]
+		px[2] *= factors[y]
+	}
+}
+
+// applyEdgeEnhance sharpens fine detail with an unsharp mask.
+// Params: strength (0-2).
+func applyEdgeEnhance(buf *rgbBuffer, params map[string]interface{}) {
+	strength := clampParam(paramFloat(params, "strength", 0.8), 0, 2)
+	unsharpMask(buf, strength, 1)
+}
+
+// applyClarity boosts midtone local contrast with a wide unsharp mask.
+// Params: strength (0-1).
+func applyClarity(buf *rgbBuffer, params map[string]interface{}) {
+	strength := clampParam(paramFloat(params, "strength", 0.3), 0, 1)
+	unsharpMask(buf, strength*0.8, 12)
+}
+
+// unsharpMask adds amount times the difference from a gaussian blur of the
+// given radius (in pixels at 1MP)
+func unsharpMask(buf *rgbBuffer, amount, radius float64) {
+	if amount == 0 {
+		return
+	}
+
+	blurred := append([]float32(nil), buf.pix...)
+	gaussianBlur(blurred, buf.w, buf.h, 3, radius*effectScale(buf.w, buf.h))
+
+	parallelFor(len(buf.pix), func(start, end int) {
+		for i := start; i < end; i++ {
+			buf.pix[i] = clampUnit(buf.pix[i] + float32(amount)*(buf.pix[i]-blurred[i]))
+		}
+	})
+}
+
+// warmTintOp pushes the image towards amber. Params: intensity (0-1).
+func warmTintOp(params map[string]interface{}, w, h int) pixelFunc {
+	intensity := clampParam(paramFloat(params, "intensity", 0.3), 0, 1)
+	return tintOp([3]float64{0.12, 0.04, -0.12}, intensity, nil)
+}
+
+// coolToneOp pushes the image towards blue. Params: intensity (0-1).
+func coolToneOp(params map[string]interface{}, w, h int) pixelFunc {
+	intensity := clampParam(paramFloat(params, "intensity", 0.2), 0, 1)
+	return tintOp([3]float64{-0.1, 0.01, 0.12}, intensity, nil)
+}
+
+// warmHighlightsOp warms only the brighter tones. Params: amount (0-1).
+func warmHighlightsOp(params map[string]interface{}, w, h int) pixelFunc {
+	amount := clampParam(paramFloat(params, "amount", 0.3), 0, 1)
+	return tintOp([3]float64{0.15, 0.06, -0.1}, amount, func(l float32) float32 {
+		return smoothstep(0.45, 0.9, l)
+	})
+}
+
+// tintOp scales channels by 1+shift*intensity, optionally weighted per pixel
+// by a function of luminance
+func tintOp(shift [3]float64, intensity float64, weight func(lum float32) float32) pixelFunc {
+	if intensity == 0 {
+		return nil
+	}
+
+	return func(x, y int, px *[4]float32) {
+		k := float32(intensity)
+		if weight != nil {
+			k *= weight(luma(px[0], px[1], px[2]))
+		}
+		for c := 0; c < 3; c++ {
+			px[c] = clampUnit(px[c] * (1 + float32(shift[c])*k))
+		}
+	}
+}
+
+// highlightBoostOp brightens the upper tones towards white.
+// Params: amount (-1 to 1).
+func highlightBoostOp(params map[string]interface{}, w, h int) pixelFunc {
+	amount := float32(clampParam(paramFloat(params, "amount", 0.2), -1, 1))
+	return toneRangeOp(amount, func(l float32) float32 {
+		return smoothstep(0.5, 1, l)
+	})
+}
+
+// shadowLiftOp opens up (positive) or deepens (negative) the shadows.
+// Params: amount (-1 to 1).
+func shadowLiftOp(params map[string]interface{}, w, h int) pixelFunc {
+	amount := float32(clampParam(paramFloat(params, "amount", 0.2), -1, 1))
+	return toneRangeOp(amount, func(l float32) float32 {
+		return 1 - smoothstep(0, 0.5, l)
+	})
+}
+
+// toneRangeOp moves the tones selected by weight towards white (amount > 0)
+// or black (amount < 0)
+func toneRangeOp(amount float32, weight func(lum float32) float32) pixelFunc {
+	if amount == 0 {
+		return nil
+	}
+
+	return func(x, y int, px *[4]float32) {
+		k := amount * weight(luma(px[0], px[1], px[2]))
+		for c := 0; c < 3; c++ {
+			if k > 0 {
+				px[c] += k * (1 - px[c])
+			} else {
+				px[c] += k * px[c]
+			}
+		}
+	}
+}
+
+// applySoftGlow screens a blurred copy over the image.
+// Params: radius (pixels at 1MP), intensity (0-1).
+func applySoftGlow(buf *rgbBuffer, params map[string]interface{}) {
+	radius := clampParam(paramFloat(params, "radius", 2), 0.5, 50)
+	intensity := clampParam(paramFloat(params, "intensity", 0.3), 0, 1)
+	glow(buf, radius*3, intensity)
+}
+
+// applyDreamyGlow is a wider, hazier soft glow.
+// Params: radius (pixels at 1MP), opacity (0-1).
+func applyDreamyGlow(buf *rgbBuffer, params map[string]interface{}) {
+	radius := clampParam(paramFloat(params, "radius", 3), 0.5, 50)
+	opacity := clampParam(paramFloat(params, "opacity", 0.2), 0, 1)
+	glow(buf, radius*6, opacity)
+}
+
+func glow(buf *rgbBuffer, sigma, amount float64) {
+	if amount == 0 {
+		return
+	}
+
+	blurred := append([]float32(nil), buf.pix...)
+	gaussianBlur(blurred, buf.w, buf.h, 3, sigma*effectScale(buf.w, buf.h))
+
+	parallelFor(len(buf.pix), func(start, end int) {
+		for i := start; i < end; i++ {
+			v := buf.pix[i]
+			screen := 1 - (1-v)*(1-blurred[i])
+			buf.pix[i] = v + float32(amount)*(screen-v)
+		}
+	})
+}
+
+// applySoftFocus blends in a blurred copy for a diffused lens look.
+// Params: radius (pixels at 1MP), amount (0-1).
+func applySoftFocus(buf *rgbBuffer, params map[string]interface{}) {
+	radius := clampParam(paramFloat(params, "radius", 1), 0.5, 50)
+	amount := float32(clampParam(paramFloat(params, "amount", 0.2), 0, 1))
+	if amount == 0 {
+		return
+	}
+
+	blurred := append([]float32(nil), buf.pix...)
+	gaussianBlur(blurred, buf.w, buf.h, 3, radius*2*effectScale(buf.w, buf.h))
+	parallelFor(len(buf.pix), func(start, end int) {
+		for i := start; i < end; i++ {
+			buf.pix[i] += amount * (blurred[i] - buf.pix[i])
+		}
+	})
+}
+
+// applyEdgeDetection renders a pencil line drawing: dark strokes on white
+// wherever the luminance gradient exceeds the threshold.
+// Params: threshold (0-1).
+func applyEdgeDetection(buf *rgbBuffer, params map[string]interface{}) {
+	threshold := float32(clampParam(paramFloat(params, "threshold", 0.1), 0.01, 1))
+
+	lum := buf.luminance()
+	gaussianBlur(lum, buf.w, buf.h, 1, 0.8*effectScale(buf.w, buf.h))
+	edges := sobelMagnitude(lum, buf.w, buf.h)
+
+	parallelFor(len(edges), func(start, end int) {
+		for i := start; i < end; i++ {
+			v := 1 - clampUnit((edges[i]-threshold)/(threshold*4))
+			buf.pix[i*3], buf.pix[i*3+1], buf.pix[i*3+2] = v, v, v
+		}
+	})
+}
+
+// pencilTextureOp multiplies in drawing paper grain.
+// Params: grain (0-1).
+func pencilTextureOp(params map[string]interface{}, w, h int) pixelFunc {
+	grain := float32(clampParam(paramFloat(params, "grain", 0.3), 0, 1))
+	paper, err := loadTexture("paper")
+	if err != nil || grain == 0 {
+		return nil
+	}
+
+	scale := effectScale(w, h)
+	return func(x, y int, px *[4]float32) {
+		factor := 1 - grain*(1-paper.at(x, y, scale))
+		for c := 0; c < 3; c++ {
+			px[c] = clampUnit(px[c] * factor)
+		}
+	}
+}
+
+// filmGrainOp adds deterministic luminance noise, strongest in midtones.
+// Params: amount (0-1).
+func filmGrainOp(params map[string]interface{}, w, h int) pixelFunc {
+	amount := float32(clampParam(paramFloat(params, "amount", 0.3), 0, 1))
+	if amount == 0 {
+		return nil
+	}
+
+	return func(x, y int, px *[4]float32) {
+		lum := luma(px[0], px[1], px[2])
+		noise := (hashNoise(x, y) - 0.5) * 0.25 * amount * (1 - 2*float32(math.Abs(float64(lum-0.5))))
+		for c := 0; c < 3; c++ {
+			px[c] = clampUnit(px[c] + noise)
+		}
+	}
+}
+
+// highContrastOp blends towards a smoothstep S-curve.
+// Params: strength (0-1).
+func highContrastOp(params map[string]interface{}, w, h int) pixelFunc {
+	strength := float32(clampParam(paramFloat(params, "strength", 0.8), 0, 1))
+	if strength == 0 {
+		return nil
+	}
+
+	return func(x, y int, px *[4]float32) {
+		for c := 0; c < 3; c++ {
+			px[c] += strength * (smoothstep(0, 1, px[c]) - px[c])
+		}
+	}
+}
+
+// vibranceOp raises saturation, most in muted colors, leaving already
+// saturated ones mostly alone. Params: amount (-1 to 1).
+func vibranceOp(params map[string]interface{}, w, h int) pixelFunc {
+	amount := float32(clampParam(paramFloat(params, "amount", 0.4), -1, 1))
+	if amount == 0 {
+		return nil
+	}
+
+	return func(x, y int, px *[4]float32) {
+		r, g, b := px[0], px[1], px[2]
+		sat := max(r, g, b) - min(r, g, b)
+		lum := luma(r, g, b)
+		k := 1 + amount*(1-sat)
+		for c := 0; c < 3; c++ {
+			px[c] = clampUnit(lum + (px[c]-lum)*k)
+		}
+	}
+}
+
+// darkCornersOp darkens only the corners with a smooth falloff.
+// Params: intensity (0-1).
+func darkCornersOp(params map[string]interface{}, w, h int) pixelFunc {
+	intensity := float32(clampParam(paramFloat(params, "intensity", 0.5), 0, 1))
+	if intensity == 0 {
+		return nil
+	}
+
+	return radialOp(w, h, func(d float32) float32 {
+		return 1 - intensity*smoothstep(0.6, 1, d)
+	})
+}
+
+// vignetteOp darkens towards the edges. Params: intensity (0-1), radius
+// (0-1, how far in from the corners the falloff reaches; 1 starts at the center).
+func vignetteOp(params map[string]interface{}, w, h int) pixelFunc {
+	intensity := float32(clampParam(paramFloat(params, "intensity", 0.6), 0, 1))
+	radius := float32(clampParam(paramFloat(params, "radius", 1), 0.01, 1))
+	if intensity == 0 {
+		return nil
+	}
+
+	return radialOp(w, h, func(d float32) float32 {
+		return 1 - intensity*clampUnit((d-(1-radius))/radius)
+	})
+}
+
+// radialOp scales each pixel by factor(d), where d is the distance from the
+// image center normalized so the corners are at 1
+func radialOp(w, h int, factor func(d float32) float32) pixelFunc {
+	cx, cy := float64(w)/2, float64(h)/2
+	maxRadius := math.Hypot(cx, cy)
+	return func(x, y int, px *[4]float32) {
+		f := factor(float32(math.Hypot(float64(x)-cx, float64(y)-cy) / maxRadius))
+		px[0] *= f
+		px[1] *= f
+		px[2] *= f
+	}
+}
+
+// desaturateHighlightsOp pulls color out of the brightest tones, like
+// film shoulder roll-off. Params: amount (0-1).
+func desaturateHighlightsOp(params map[string]interface{}, w, h int) pixelFunc {
+	amount := float32(clampParam(paramFloat(params, "amount", 0.3), 0, 1))
+	if amount == 0 {
+		return nil
+	}
+
+	return func(x, y int, px *[4]float32) {
+		lum := luma(px[0], px[1], px[2])
+		k := amount * smoothstep(0.6, 1, lum)
+		for c := 0; c < 3; c++ {
+			px[c] += k * (lum - px[c])
+		}
+	}
+}
+
+// softLightOp soft-light blends the image with itself for gentle contrast.
+// Params: intensity (0-1).
+func softLightOp(params map[string]interface{}, w, h int) pixelFunc {
+	intensity := float32(clampParam(paramFloat(params, "intensity", 0.4), 0, 1))
+	if intensity == 0 {
+		return nil
+	}
+
+	return func(x, y int, px *[4]float32) {
+		for c := 0; c < 3; c++ {
+			px[c] += intensity * (softLightBlend(px[c], px[c]) - px[c])
+		}
+	}
+}
+
+func smoothstep(edge0, edge1, v float32) float32 {
+	t := clampUnit((v - edge0) / (edge1 - edge0))
+	return t * t * (3 - 2*t)
+}
+
+func overlayBlend(base, blend float32) float32 {
+	if base < 0.5 {
+		return 2 * base * blend
+	}
+	return 1 - 2*(1-base)*(1-blend)
+}
+
+// softLightBlend is the W3C compositing soft-light formula
+func softLightBlend(base, blend float32) float32 {
+	if blend <= 0.5 {
+		return base - (1-2*blend)*base*(1-base)
+	}
+	var d float32
+	if base <= 0.25 {
+		d = ((16*base-12)*base + 4) * base
+	} else {
+		d = float32(math.Sqrt(float64(base)))
+	}
+	return base + (2*blend-1)*(d-base)
+}
+
+// hashNoise returns stable pseudo-random noise in 0..1 for a pixel, so the
+// same image always renders the same grain
+func hashNoise(x, y int) float32 {
+	h := uint32(x)*374761393 + uint32(y)*668265263
+	h = (h ^ (h >> 13)) * 1274126177
+	h ^= h >> 16
+	return float32(h&0xffff) / 0xffff
+}
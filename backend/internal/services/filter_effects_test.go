@@ -0,0 +1,192 @@
+package services
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"mediaVault-backend/internal/models"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden images in testdata")
+
+const (
+	// goldenTolerance is the per-channel difference (0-255) allowed between a
+	// render and its golden image, for float differences across platforms
+	goldenTolerance = 3
+	// goldenMaxOutliers is the share of pixels that may exceed the tolerance,
+	// for quantizing effects where a rounding difference flips a band
+	goldenMaxOutliers = 0.005
+)
+
+// effectTestImage is a small fixed input with gradients, hard edges, a
+// highlight and fine texture, so every effect has something to act on
+func effectTestImage() *image.NRGBA {
+	const w, h = 96, 64
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r := float64(x) / (w - 1)
+			g := float64(y) / (h - 1)
+			b := 1 - r*0.7
+
+			// Deterministic texture
+			n := math.Sin(float64(x*12+y*7)) * 0.06
+			r, g, b = r+n, g+n, b+n
+
+			// Dark block with a hard edge
+			if x >= 8 && x < 36 && y >= 30 && y < 56 {
+				r, g, b = 0.12, 0.1, 0.18
+			}
+			// Bright disk for glows
+			if dx, dy := float64(x-66), float64(y-22); dx*dx+dy*dy < 14*14 {
+				r, g, b = 0.98, 0.95, 0.85
+			}
+
+			img.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(math.Round(clamp01(r) * 255)),
+				G: uint8(math.Round(clamp01(g) * 255)),
+				B: uint8(math.Round(clamp01(b) * 255)),
+				A: 255,
+			})
+		}
+	}
+	return img
+}
+
+func TestEffectGoldens(t *testing.T) {
+	tests := []struct {
+		name   string
+		effect models.Effect
+	}{
+		{"edge_preserve", models.Effect{Type: "edge_preserve", Params: map[string]interface{}{"strength": 0.6}}},
+		{"brush_strokes", models.Effect{Type: "brush_strokes", Params: map[string]interface{}{"size": 3, "strength": 1}}},
+		{"neon_glow", models.Effect{Type: "neon_glow", Params: map[string]interface{}{"color": "#ff00ff", "intensity": 0.8}}},
+		{"warm_filter", models.Effect{Type: "warm_filter", Params: map[string]interface{}{"temperature": 3200}}},
+		{"cell_shading", models.Effect{Type: "cell_shading", Params: map[string]interface{}{"levels": 4}}},
+	}
+
+	input := effectTestImage()
+	bounds := input.Bounds()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := models.FilterConfig{Effects: []models.Effect{tt.effect}}
+			out, err := runPipeline(t.Context(), input, buildPipeline(config, bounds.Dx(), bounds.Dy(), &renderAssets{}))
+			if err != nil {
+				t.Fatalf("runPipeline: %v", err)
+			}
+			got := newRGBBuffer(out).toNRGBA()
+			if bytes.Equal(got.Pix, input.Pix) {
+				t.Fatalf("effect left the image unchanged")
+			}
+
+			path := filepath.Join("testdata", "effects", tt.name+".png")
+			if *updateGolden {
+				writeGolden(t, path, got)
+				return
+			}
+			compareGolden(t, path, got)
+		})
+	}
+}
+
+func writeGolden(t *testing.T, path string, img image.Image) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encode golden: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("create testdata: %v", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("write golden: %v", err)
+	}
+}
+
+func compareGolden(t *testing.T, path string, got *image.NRGBA) {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open golden (run with -update to create it): %v", err)
+	}
+	defer f.Close()
+	decoded, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("decode golden: %v", err)
+	}
+	want := newRGBBuffer(decoded).toNRGBA()
+	if want.Rect != got.Rect {
+		t.Fatalf("size %v, golden is %v", got.Rect, want.Rect)
+	}
+
+	outliers, worst := 0, 0
+	for i := 0; i < len(got.Pix); i += 4 {
+		diff := 0
+		for c := 0; c < 4; c++ {
+			d := int(got.Pix[i+c]) - int(want.Pix[i+c])
+			if d < 0 {
+				d = -d
+			}
+			diff = max(diff, d)
+		}
+		worst = max(worst, diff)
+		if diff > goldenTolerance {
+			outliers++
+		}
+	}
+	pixels := len(got.Pix) / 4
+	if float64(outliers) > goldenMaxOutliers*float64(pixels) {
+		t.Errorf("%d of %d pixels differ from %s by more than %d (worst %d)", outliers, pixels, path, goldenTolerance, worst)
+	}
+}
+
+// The tiled summed-area tables must give the same result as computing each
+// quadrant directly, including windows that cross tile edges
+func TestBrushStrokesTiles(t *testing.T) {
+	buf := newRGBBuffer(effectTestImage())
+	want := buf.clone()
+	applyBrushStrokes(buf, map[string]interface{}{"size": 20, "strength": 1})
+
+	const radius = 20 // size at effectScale 1
+	w, h := want.w, want.h
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			bestVariance := math.MaxFloat64
+			var best [3]float64
+			for _, q := range [4][2]int{{-1, -1}, {0, -1}, {-1, 0}, {0, 0}} {
+				x0, y0 := max(x+q[0]*radius, 0), max(y+q[1]*radius, 0)
+				x1, y1 := min(x+(q[0]+1)*radius, w-1)+1, min(y+(q[1]+1)*radius, h-1)+1
+				var sum [3]float64
+				var lumSq float64
+				for yy := y0; yy < y1; yy++ {
+					for xx := x0; xx < x1; xx++ {
+						i := (yy*w + xx) * 3
+						r, g, b := float64(want.pix[i]), float64(want.pix[i+1]), float64(want.pix[i+2])
+						sum[0], sum[1], sum[2] = sum[0]+r, sum[1]+g, sum[2]+b
+						lum := 0.299*r + 0.587*g + 0.114*b
+						lumSq += lum * lum
+					}
+				}
+				n := float64((x1 - x0) * (y1 - y0))
+				mean := [3]float64{sum[0] / n, sum[1] / n, sum[2] / n}
+				lum := 0.299*mean[0] + 0.587*mean[1] + 0.114*mean[2]
+				if variance := lumSq/n - lum*lum; variance < bestVariance {
+					bestVariance, best = variance, mean
+				}
+			}
+			for c := 0; c < 3; c++ {
+				got := buf.pix[(y*w+x)*3+c]
+				if math.Abs(float64(got)-best[c]) > 1e-4 {
+					t.Fatalf("(%d,%d) channel %d: got %v, want %v", x, y, c, got, best[c])
+				}
+			}
+		}
+	}
+}
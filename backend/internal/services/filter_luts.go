@@ -0,0 +1,110 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"mediaVault-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const lutCollection = "filter_luts"
+
+// UploadLUT validates a .cube file, stores it in the bucket and records it
+// for the user. Parse failures wrap ErrInvalidLUT.
+func (fs *FilterService) UploadLUT(ctx context.Context, userID primitive.ObjectID, name string, data []byte) (*models.LUT, error) {
+	parsed, err := parseCubeLUT(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidLUT, err)
+	}
+
+	lut := &models.LUT{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Name:      strings.TrimSuffix(name, path.Ext(name)),
+		Title:     parsed.title,
+		Size:      parsed.size,
+		FileSize:  int64(len(data)),
+		CreatedAt: time.Now(),
+	}
+	lut.FileName = "luts/" + lut.ID.Hex() + ".cube"
+
+	if err := fs.minioSvc.UploadBytes(lut.FileName, data, "text/plain"); err != nil {
+		return nil, err
+	}
+	if _, err := fs.db.Collection(lutCollection).InsertOne(ctx, lut); err != nil {
+		_ = fs.minioSvc.DeleteFile(lut.FileName)
+		return nil, fmt.Errorf("failed to save LUT: %w", err)
+	}
+
+	uploadedLUTs.put(lut.ID.Hex(), parsed)
+	return lut, nil
+}
+
+// ListLUTs returns the built-in LUTs and the ones the user uploaded
+func (fs *FilterService) ListLUTs(ctx context.Context, userID primitive.ObjectID) ([]models.BuiltinLUT, []models.LUT, error) {
+	var builtin []models.BuiltinLUT
+	for _, name := range BuiltinLUTs() {
+		l, err := loadBuiltinLUT(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		builtin = append(builtin, models.BuiltinLUT{Name: name, Title: l.title, Size: l.size})
+	}
+
+	opts := options.Find().SetSort(bson.M{"createdAt": -1})
+	cursor, err := fs.db.Collection(lutCollection).Find(ctx, bson.M{"userId": userID}, opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list LUTs: %w", err)
+	}
+	uploaded := []models.LUT{}
+	if err := cursor.All(ctx, &uploaded); err != nil {
+		return nil, nil, fmt.Errorf("failed to list LUTs: %w", err)
+	}
+	return builtin, uploaded, nil
+}
+
+// loadLUT returns a built-in LUT by name or an uploaded one by ID, from the
+// parsed cache or else the bucket
+func (fs *FilterService) loadLUT(ctx context.Context, ref string) (*lut3D, error) {
+	if isBuiltinLUT(ref) {
+		return loadBuiltinLUT(ref)
+	}
+	return fs.loadUploadedLUT(ctx, ref)
+}
+
+func (fs *FilterService) loadUploadedLUT(ctx context.Context, ref string) (*lut3D, error) {
+	if l, ok := uploadedLUTs.get(ref); ok {
+		return l, nil
+	}
+
+	id, err := primitive.ObjectIDFromHex(ref)
+	if err != nil {
+		return nil, fmt.Errorf("unknown LUT %q", ref)
+	}
+	var lut models.LUT
+	if err := fs.db.Collection(lutCollection).FindOne(ctx, bson.M{"_id": id}).Decode(&lut); err != nil {
+		return nil, fmt.Errorf("failed to get LUT %s: %w", ref, err)
+	}
+
+	reader, err := fs.minioSvc.GetFileContent(lut.FileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download LUT %s: %w", ref, err)
+	}
+	defer reader.Close()
+
+	l, err := parseCubeLUT(io.LimitReader(reader, MaxLUTFileSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse LUT %s: %w", ref, err)
+	}
+	uploadedLUTs.put(ref, l)
+	return l, nil
+}
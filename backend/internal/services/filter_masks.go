@@ -0,0 +1,123 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"mediaVault-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	maskCollection = "filter_masks"
+	// MaxMaskFileSize bounds mask uploads
+	MaxMaskFileSize  = 20 << 20
+	maxMaskDimension = 8192
+	// maskCacheSize is how many masks stay decoded in memory
+	maskCacheSize = 16
+)
+
+// ErrInvalidMask is returned for uploads that can't be used as a mask
+var ErrInvalidMask = errors.New("invalid mask")
+
+var uploadedMasks = newLRUCache[*grayMask](maskCacheSize)
+
+// UploadMask converts an uploaded image to grayscale, stores it as a PNG and
+// records it for the user. Decode failures wrap ErrInvalidMask.
+func (fs *FilterService) UploadMask(ctx context.Context, userID primitive.ObjectID, name string, data []byte) (*models.FilterMask, error) {
+	decoded, err := decodeImage(ctx, data, path.Ext(name), 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMask, err)
+	}
+	bounds := decoded.Image.Bounds()
+	if bounds.Dx() > maxMaskDimension || bounds.Dy() > maxMaskDimension {
+		return nil, fmt.Errorf("%w: masks are limited to %dx%d pixels", ErrInvalidMask, maxMaskDimension, maxMaskDimension)
+	}
+
+	gray, ok := decoded.Image.(*image.Gray)
+	if !ok || gray.Rect.Min != (image.Point{}) {
+		gray = image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(gray, gray.Rect, decoded.Image, bounds.Min, draw.Src)
+	}
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, gray); err != nil {
+		return nil, fmt.Errorf("failed to encode mask: %w", err)
+	}
+
+	mask := &models.FilterMask{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Name:      strings.TrimSuffix(name, path.Ext(name)),
+		Width:     bounds.Dx(),
+		Height:    bounds.Dy(),
+		CreatedAt: time.Now(),
+	}
+	mask.FileName = "masks/" + mask.ID.Hex() + ".png"
+
+	if err := fs.minioSvc.UploadBytes(mask.FileName, encoded.Bytes(), "image/png"); err != nil {
+		return nil, err
+	}
+	if _, err := fs.db.Collection(maskCollection).InsertOne(ctx, mask); err != nil {
+		_ = fs.minioSvc.DeleteFile(mask.FileName)
+		return nil, fmt.Errorf("failed to save mask: %w", err)
+	}
+
+	uploadedMasks.put(mask.ID.Hex(), newGrayMask(gray))
+	return mask, nil
+}
+
+// ListMasks returns the masks the user uploaded, newest first
+func (fs *FilterService) ListMasks(ctx context.Context, userID primitive.ObjectID) ([]models.FilterMask, error) {
+	opts := options.Find().SetSort(bson.M{"createdAt": -1})
+	cursor, err := fs.db.Collection(maskCollection).Find(ctx, bson.M{"userId": userID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list masks: %w", err)
+	}
+	masks := []models.FilterMask{}
+	if err := cursor.All(ctx, &masks); err != nil {
+		return nil, fmt.Errorf("failed to list masks: %w", err)
+	}
+	return masks, nil
+}
+
+func (fs *FilterService) loadMask(ctx context.Context, id primitive.ObjectID) (*grayMask, error) {
+	if m, ok := uploadedMasks.get(id.Hex()); ok {
+		return m, nil
+	}
+
+	var mask models.FilterMask
+	if err := fs.db.Collection(maskCollection).FindOne(ctx, bson.M{"_id": id}).Decode(&mask); err != nil {
+		return nil, fmt.Errorf("failed to get mask %s: %w", id.Hex(), err)
+	}
+
+	reader, err := fs.minioSvc.GetFileContent(mask.FileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download mask %s: %w", id.Hex(), err)
+	}
+	defer reader.Close()
+
+	img, err := png.Decode(io.LimitReader(reader, MaxMaskFileSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode mask %s: %w", id.Hex(), err)
+	}
+	gray, ok := img.(*image.Gray)
+	if !ok {
+		return nil, fmt.Errorf("mask %s is not grayscale", id.Hex())
+	}
+
+	m := newGrayMask(gray)
+	uploadedMasks.put(id.Hex(), m)
+	return m, nil
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"image"
+
+	"mediaVault-backend/internal/models"
+)
+
+// effectDef implements one effect type. Per-pixel effects provide pixel,
+// which builds an op for the given image size (nil when the params make it a
+// no-op); effects that need neighbouring pixels provide buffer and modify the
+// whole buffer in place. LUT effects provide lut and get the table their
+// params reference; overlay effects draw assets onto the buffer. Both kinds
+// of asset are resolved ahead of rendering.
+type effectDef struct {
+	pixel   func(params map[string]interface{}, w, h int) pixelFunc
+	buffer  func(buf *rgbBuffer, params map[string]interface{})
+	lut     func(l *lut3D, params map[string]interface{}) pixelFunc
+	overlay func(buf *rgbBuffer, params map[string]interface{}, assets *renderAssets)
+}
+
+// effectRegistry maps every supported effect type to its implementation
+var effectRegistry = map[string]effectDef{
+	"edge_preserve":         {buffer: applyEdgePreserve},
+	"brush_strokes":         {buffer: applyBrushStrokes},
+	"neon_glow":             {buffer: applyNeonGlow},
+	"vignette":              {pixel: vignetteOp},
+	"warm_filter":           {pixel: warmFilterOp},
+	"cell_shading":          {buffer: applyCellShading},
+	"texture_overlay":       {pixel: textureOverlayOp},
+	"impasto":               {buffer: applyImpasto},
+	"chromatic_aberration":  {buffer: applyChromaticAberration},
+	"scanlines":             {pixel: scanlinesOp},
+	"edge_enhance":          {buffer: applyEdgeEnhance},
+	"warm_tint":             {pixel: warmTintOp},
+	"highlight_boost":       {pixel: highlightBoostOp},
+	"shadow_lift":           {pixel: shadowLiftOp},
+	"soft_glow":             {buffer: applySoftGlow},
+	"edge_detection":        {buffer: applyEdgeDetection},
+	"pencil_texture":        {pixel: pencilTextureOp},
+	"film_grain":            {pixel: filmGrainOp},
+	"high_contrast":         {pixel: highContrastOp},
+	"vibrance":              {pixel: vibranceOp},
+	"clarity":               {buffer: applyClarity},
+	"soft_focus":            {buffer: applySoftFocus},
+	"cool_tone":             {pixel: coolToneOp},
+	"dark_corners":          {pixel: darkCornersOp},
+	"desaturate_highlights": {pixel: desaturateHighlightsOp},
+	"soft_light":            {pixel: softLightOp},
+	"warm_highlights":       {pixel: warmHighlightsOp},
+	"dreamy_glow":           {buffer: applyDreamyGlow},
+	"lut":                   {lut: lutOp},
+	"watermark":             {overlay: applyWatermark},
+}
+
+// pipelineStage is a per-pixel op, a whole-buffer pass, or a geometric
+// operation that produces a new buffer
+type pipelineStage struct {
+	pixel    pixelFunc
+	buffer   func(buf *rgbBuffer)
+	geometry func(buf *rgbBuffer) *rgbBuffer
+}
+
+// buildPipeline turns a config into the ordered stages that render it:
+// geometry, the CSS blur, then the CSS color functions and tone adjustments,
+// then each effect in order, blended through the mask if there is one. w
+// and h are the input size; assets holds the LUTs and mask images the
+// config references.
+func buildPipeline(config models.FilterConfig, w, h int, assets *renderAssets) []pipelineStage {
+	// Crop first so nothing is spent on pixels that are thrown away; the
+	// remaining stages are sized for the geometry's output
+	geometry, w, h := geometryStages(config.Geometry, w, h)
+	var stages []pipelineStage
+
+	if config.Blur != nil {
+		if sigma := cssBlurSigma(*config.Blur, w, h); sigma > 0 {
+			stages = append(stages, pipelineStage{buffer: func(buf *rgbBuffer) {
+				cssBlur(buf, sigma)
+			}})
+		}
+	}
+
+	// The CSS functions and the tone adjustments share one pixel op
+	ops, tone := cssColorOps(config), toneOp(config)
+	if len(ops) > 0 || tone != nil {
+		stages = append(stages, pipelineStage{pixel: func(x, y int, px *[4]float32) {
+			for _, op := range ops {
+				px[0], px[1], px[2], px[3] = op.apply(px[0], px[1], px[2], px[3])
+			}
+			if tone != nil {
+				tone(px)
+			}
+		}})
+	}
+
+	for _, effect := range config.Effects {
+		def, ok := effectRegistry[effect.Type]
+		if !ok {
+			// Stored presets are validated on creation; skip anything stale
+			continue
+		}
+		if def.lut != nil {
+			l, ok := assets.luts[paramString(effect.Params, "lut", "")]
+			if !ok {
+				continue
+			}
+			if op := def.lut(l, effect.Params); op != nil {
+				stages = append(stages, pipelineStage{pixel: op})
+			}
+			continue
+		}
+		if def.pixel != nil {
+			if op := def.pixel(effect.Params, w, h); op != nil {
+				stages = append(stages, pipelineStage{pixel: op})
+			}
+			continue
+		}
+		params := effect.Params
+		if def.overlay != nil {
+			stages = append(stages, pipelineStage{buffer: func(buf *rgbBuffer) {
+				def.overlay(buf, params, assets)
+			}})
+			continue
+		}
+		stages = append(stages, pipelineStage{buffer: func(buf *rgbBuffer) {
+			def.buffer(buf, params)
+		}})
+	}
+
+	return append(geometry, maskStages(config.Mask, w, h, assets, stages)...)
+}
+
+// renderAssets holds what configs reference outside themselves, loaded
+// before rendering: LUTs keyed by the lut param, masks and watermark logos
+// keyed by ID
+type renderAssets struct {
+	luts  map[string]*lut3D
+	masks map[string]*grayMask
+	logos map[string]image.Image
+}
+
+// runPipeline converts img to a float buffer once, runs the stages over it
+// and converts back once. Consecutive per-pixel stages are fused into a
+// single parallel pass. The context is checked between passes so abandoned
+// requests stop early. 16-bit input, such as the working copy of a
+// wide-gamut image, comes back at 16 bits.
+func runPipeline(ctx context.Context, img image.Image, stages []pipelineStage) (image.Image, error) {
+	if len(stages) == 0 {
+		return img, nil
+	}
+
+	buf := newRGBBuffer(img)
+	var fused []pixelFunc
+	flush := func() error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		buf.applyPixels(fused)
+		fused = fused[:0]
+		return nil
+	}
+
+	for _, stage := range stages {
+		if stage.pixel != nil {
+			fused = append(fused, stage.pixel)
+			continue
+		}
+		if err := flush(); err != nil {
+			return nil, err
+		}
+		if stage.geometry != nil {
+			buf = stage.geometry(buf)
+		} else {
+			stage.buffer(buf)
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	if _, ok := img.(*image.NRGBA64); ok {
+		return buf.toNRGBA64(), nil
+	}
+	return buf.toNRGBA(), nil
+}
@@ -0,0 +1,315 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"mediaVault-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const presetVersionCollection = "filter_preset_versions"
+
+var (
+	// ErrPresetNotFound is returned for presets that don't exist or that
+	// belong to another user
+	ErrPresetNotFound = errors.New("preset not found")
+	// ErrInvalidPreset is returned for preset definitions that can't be saved
+	ErrInvalidPreset = errors.New("invalid preset")
+	// ErrPresetConflict is returned when a preset changed while being edited
+	ErrPresetConflict = errors.New("preset was changed concurrently")
+)
+
+// getAccessiblePreset returns a preset the user may apply: a built-in, one
+// of their own or a public one
+func (fs *FilterService) getAccessiblePreset(ctx context.Context, filterID, userID primitive.ObjectID) (*models.FilterPreset, error) {
+	preset, err := fs.getFilterPreset(ctx, filterID)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrPresetNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get filter preset: %w", err)
+	}
+	if preset.IsCustom && preset.Visibility != models.PresetPublic && (preset.CreatedBy == nil || *preset.CreatedBy != userID) {
+		return nil, ErrPresetNotFound
+	}
+	return preset, nil
+}
+
+// ListCustomPresets returns the user's presets, most recently changed first
+func (fs *FilterService) ListCustomPresets(ctx context.Context, userID primitive.ObjectID) ([]models.FilterPreset, error) {
+	opts := options.Find().SetSort(bson.M{"updatedAt": -1})
+	cursor, err := fs.db.Collection(presetCollection).Find(ctx, bson.M{"isCustom": true, "createdBy": userID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list presets: %w", err)
+	}
+	presets := []models.FilterPreset{}
+	if err := cursor.All(ctx, &presets); err != nil {
+		return nil, fmt.Errorf("failed to list presets: %w", err)
+	}
+	return presets, nil
+}
+
+// GetCustomPreset returns one of the user's presets
+func (fs *FilterService) GetCustomPreset(ctx context.Context, userID, presetID primitive.ObjectID) (*models.FilterPreset, error) {
+	var preset models.FilterPreset
+	err := fs.db.Collection(presetCollection).FindOne(ctx, ownedPreset(userID, presetID)).Decode(&preset)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrPresetNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get preset: %w", err)
+	}
+	return &preset, nil
+}
+
+// CreateCustomPreset saves a new preset for the user at version 1. Invalid
+// configs wrap ErrInvalidPreset.
+func (fs *FilterService) CreateCustomPreset(ctx context.Context, userID primitive.ObjectID, req models.CreateFilterPresetRequest) (*models.FilterPreset, error) {
+	return fs.newCustomPreset(ctx, userID, req, nil, nil)
+}
+
+// newCustomPreset creates a preset, stored with thumbnail as its custom
+// thumbnail when one is given. The reference thumbnails are rendered in the
+// background.
+func (fs *FilterService) newCustomPreset(ctx context.Context, userID primitive.ObjectID, req models.CreateFilterPresetRequest, forkedFrom *primitive.ObjectID, thumbnail []byte) (*models.FilterPreset, error) {
+	if err := ValidateFilterConfig(req.Config); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPreset, err)
+	}
+
+	now := time.Now()
+	preset := &models.FilterPreset{
+		ID:          primitive.NewObjectID(),
+		Name:        req.Name,
+		Category:    req.Category,
+		Type:        req.Type,
+		Description: req.Description,
+		Config:      req.Config,
+		IsCustom:    true,
+		CreatedBy:   &userID,
+		Version:     1,
+		ForkedFrom:  forkedFrom,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	// Stored with the preset, so it's there before the render is queued
+	if thumbnail != nil {
+		name, err := fs.uploadPresetThumbnail(preset.ID, thumbnail)
+		if err != nil {
+			return nil, err
+		}
+		preset.Thumbnail = &name
+		preset.CustomThumbnail = true
+	}
+	if _, err := fs.db.Collection(presetCollection).InsertOne(ctx, preset); err != nil {
+		return nil, fmt.Errorf("failed to create preset: %w", err)
+	}
+	if err := fs.savePresetVersion(ctx, preset); err != nil {
+		return nil, err
+	}
+
+	update := bson.M{
+		"$addToSet": bson.M{"customPresets": preset.ID},
+		"$set":      bson.M{"updatedAt": now},
+		"$setOnInsert": bson.M{
+			"userId":         userID,
+			"frequentlyUsed": []primitive.ObjectID{},
+			"usageCount":     map[string]int{},
+			"createdAt":      now,
+		},
+	}
+	if _, err := fs.db.Collection("user_filter_preferences").UpdateOne(ctx, bson.M{"userId": userID}, update, options.Update().SetUpsert(true)); err != nil {
+		return nil, fmt.Errorf("failed to record preset: %w", err)
+	}
+
+	fs.queuePresetThumbnails(preset.ID)
+	return preset, nil
+}
+
+// UpdateCustomPreset replaces the definition of one of the user's presets
+// and bumps its version. Earlier versions stay in the history.
+func (fs *FilterService) UpdateCustomPreset(ctx context.Context, userID, presetID primitive.ObjectID, req models.CreateFilterPresetRequest) (*models.FilterPreset, error) {
+	if err := ValidateFilterConfig(req.Config); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPreset, err)
+	}
+	current, err := fs.GetCustomPreset(ctx, userID, presetID)
+	if err != nil {
+		return nil, err
+	}
+	// Presets from before versioning count as version 1
+	if current.Version == 0 {
+		current.Version = 1
+		if err := fs.savePresetVersion(ctx, current); err != nil {
+			return nil, err
+		}
+	}
+
+	update := bson.M{"$set": bson.M{
+		"name":        req.Name,
+		"category":    req.Category,
+		"type":        req.Type,
+		"description": req.Description,
+		"config":      req.Config,
+		"version":     current.Version + 1,
+		"updatedAt":   time.Now(),
+	}}
+	// A supplied thumbnail no longer shows a changed look
+	oldHash, _ := presetThumbnailHash(current.Config)
+	newHash, _ := presetThumbnailHash(req.Config)
+	if current.CustomThumbnail && oldHash != newHash {
+		update["$unset"] = bson.M{"customThumbnail": ""}
+	}
+
+	var updated models.FilterPreset
+	filter := ownedPreset(userID, presetID)
+	filter["updatedAt"] = current.UpdatedAt // fails if someone else saved in between
+	err = fs.db.Collection(presetCollection).FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrPresetConflict
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update preset: %w", err)
+	}
+	if err := fs.savePresetVersion(ctx, &updated); err != nil {
+		return nil, err
+	}
+
+	fs.InvalidatePresetRenders(presetID)
+	fs.queuePresetThumbnails(presetID)
+	return &updated, nil
+}
+
+// DeleteCustomPreset removes one of the user's presets along with their
+// tweaks for it and its ratings. Its version history is kept for past
+// applications.
+func (fs *FilterService) DeleteCustomPreset(ctx context.Context, userID, presetID primitive.ObjectID) error {
+	result, err := fs.db.Collection(presetCollection).DeleteOne(ctx, ownedPreset(userID, presetID))
+	if err != nil {
+		return fmt.Errorf("failed to delete preset: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrPresetNotFound
+	}
+
+	update := bson.M{
+		"$pull":  bson.M{"customPresets": presetID},
+		"$unset": bson.M{"presetTweaks." + presetID.Hex(): ""},
+		"$set":   bson.M{"updatedAt": time.Now()},
+	}
+	if _, err := fs.db.Collection("user_filter_preferences").UpdateOne(ctx, bson.M{"userId": userID}, update); err != nil {
+		return fmt.Errorf("failed to update filter preferences: %w", err)
+	}
+	if _, err := fs.db.Collection(presetRatingCollection).DeleteMany(ctx, bson.M{"presetId": presetID}); err != nil {
+		return fmt.Errorf("failed to delete preset ratings: %w", err)
+	}
+
+	fs.InvalidatePresetRenders(presetID)
+	fs.deletePresetThumbnails(presetID)
+	return nil
+}
+
+// DuplicatePreset copies a built-in or one of the user's presets into a new
+// custom preset
+func (fs *FilterService) DuplicatePreset(ctx context.Context, userID, sourceID primitive.ObjectID, name string) (*models.FilterPreset, error) {
+	source, err := fs.getAccessiblePreset(ctx, sourceID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = source.Name + " (copy)"
+	}
+
+	return fs.CreateCustomPreset(ctx, userID, models.CreateFilterPresetRequest{
+		Name:        name,
+		Category:    source.Category,
+		Type:        source.Type,
+		Description: source.Description,
+		Config:      mergeConfigs(source.Config),
+	})
+}
+
+// GetPresetVersions returns the version history of one of the user's
+// presets, newest first
+func (fs *FilterService) GetPresetVersions(ctx context.Context, userID, presetID primitive.ObjectID) ([]models.FilterPresetVersion, error) {
+	if _, err := fs.GetCustomPreset(ctx, userID, presetID); err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().SetSort(bson.M{"version": -1})
+	cursor, err := fs.db.Collection(presetVersionCollection).Find(ctx, bson.M{"presetId": presetID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list preset versions: %w", err)
+	}
+	versions := []models.FilterPresetVersion{}
+	if err := cursor.All(ctx, &versions); err != nil {
+		return nil, fmt.Errorf("failed to list preset versions: %w", err)
+	}
+	return versions, nil
+}
+
+func (fs *FilterService) savePresetVersion(ctx context.Context, preset *models.FilterPreset) error {
+	return savePresetVersion(ctx, fs.db, preset)
+}
+
+// savePresetVersion snapshots preset at its current version. Saving the same
+// version again keeps the first snapshot.
+func savePresetVersion(ctx context.Context, db *mongo.Database, preset *models.FilterPreset) error {
+	_, err := db.Collection(presetVersionCollection).UpdateOne(ctx,
+		bson.M{"presetId": preset.ID, "version": preset.Version},
+		bson.M{"$setOnInsert": models.FilterPresetVersion{
+			ID:          primitive.NewObjectID(),
+			PresetID:    preset.ID,
+			Version:     preset.Version,
+			Name:        preset.Name,
+			Category:    preset.Category,
+			Type:        preset.Type,
+			Description: preset.Description,
+			Config:      preset.Config,
+			CreatedAt:   time.Now(),
+		}},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save preset version: %w", err)
+	}
+	return nil
+}
+
+// presetAtVersion returns preset as it was at version, for reading past
+// applications. It falls back to the preset as it is now when there's no
+// snapshot, and works for deleted presets that have one.
+func presetAtVersion(ctx context.Context, db *mongo.Database, presetID primitive.ObjectID, version int) (*models.FilterPreset, error) {
+	var preset models.FilterPreset
+	err := db.Collection(presetCollection).FindOne(ctx, bson.M{"_id": presetID}).Decode(&preset)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+	found := err == nil
+	if version == 0 || (found && preset.Version == version) {
+		return &preset, err
+	}
+
+	var snapshot models.FilterPresetVersion
+	err = db.Collection(presetVersionCollection).FindOne(ctx, bson.M{"presetId": presetID, "version": version}).Decode(&snapshot)
+	if err == mongo.ErrNoDocuments && found {
+		return &preset, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		preset = models.FilterPreset{ID: presetID, IsCustom: true, CreatedAt: snapshot.CreatedAt}
+	}
+	preset.Name, preset.Category, preset.Type = snapshot.Name, snapshot.Category, snapshot.Type
+	preset.Description, preset.Config, preset.Version = snapshot.Description, snapshot.Config, snapshot.Version
+	return &preset, nil
+}
+
+func ownedPreset(userID, presetID primitive.ObjectID) bson.M {
+	return bson.M{"_id": presetID, "isCustom": true, "createdBy": userID}
+}
@@ -0,0 +1,205 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"sync"
+	"time"
+
+	"mediaVault-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	xdraw "golang.org/x/image/draw"
+)
+
+const (
+	// DefaultPreviewDim and MaxPreviewDim bound the long edge of previews
+	DefaultPreviewDim = 800
+	MinPreviewDim     = 64
+	MaxPreviewDim     = 2048
+	// PreviewTimeout is the latency budget of a preview render
+	PreviewTimeout = 2 * time.Second
+	// previewCacheMemory bounds the decoded size of the proxies kept in memory
+	previewCacheMemory = 256 << 20
+)
+
+var (
+	// previewProxies holds one proxy per original, the largest built so
+	// far; smaller previews are scaled down from it
+	previewProxies = newSizedLRUCache(previewCacheMemory, func(p *previewProxyImage) int64 { return decodedSize(p.Image) })
+
+	// proxyBuilds lets concurrent previews of one image share a single
+	// decode, which is the slow part
+	proxyBuildsMu sync.Mutex
+	proxyBuilds   = make(map[string]*proxyBuild)
+)
+
+// previewProxyImage is an original decoded and shrunk to fit maxDim
+type previewProxyImage struct {
+	*decodedImage
+	maxDim int
+}
+
+type proxyBuild struct {
+	done  chan struct{}
+	proxy *previewProxyImage
+	err   error
+}
+
+// ApplyFilterPreview renders a filter on a downscaled proxy of the original
+// whose long edge is at most maxDim. Proxies are cached, so slider tweaks
+// only pay for the pipeline. Previews aren't recorded as applications.
+func (fs *FilterService) ApplyFilterPreview(ctx context.Context, mediaID, filterID, userID primitive.ObjectID, customConfig *models.FilterConfig, output models.OutputOptions, maxDim int) (*FilterResult, error) {
+	if err := ValidateOutputOptions(output); err != nil {
+		return nil, err
+	}
+	if maxDim < MinPreviewDim || maxDim > MaxPreviewDim {
+		return nil, fmt.Errorf("maxDim must be between %d and %d", MinPreviewDim, MaxPreviewDim)
+	}
+
+	media, filter, config, err := fs.prepareFilter(ctx, mediaID, filterID, userID, customConfig)
+	if err != nil {
+		return nil, err
+	}
+	data, format, cache, err := fs.cachedRender(media, filterID, config, output, maxDim, func() ([]byte, string, error) {
+		proxy, err := fs.previewProxy(ctx, media, maxDim)
+		if err != nil {
+			return nil, "", err
+		}
+		assets, err := fs.resolveAssets(ctx, config)
+		if err != nil {
+			return nil, "", err
+		}
+
+		data, format, err := fs.renderDecoded(ctx, proxy, output, func(img image.Image) (image.Image, error) {
+			bounds := img.Bounds()
+			return runPipeline(ctx, img, buildPipeline(config, bounds.Dx(), bounds.Dy(), assets))
+		})
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to render preview: %w", err)
+		}
+		return data, format, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &FilterResult{Data: data, Format: format, Config: config, FilterName: filter.Name, Cache: cache}, nil
+}
+
+// previewProxy returns the original of media decoded and shrunk to fit
+// maxDim. A cached proxy at least that large is scaled down rather than
+// decoding the original again.
+func (fs *FilterService) previewProxy(ctx context.Context, media *models.MediaFile, maxDim int) (*decodedImage, error) {
+	source := fmt.Sprintf("%s:%s:%d:%d", media.ID.Hex(), media.WorkingFileName(), media.Size, media.WorkingOrientation())
+	if proxy, ok := previewProxies.get(source); ok && proxy.maxDim >= maxDim {
+		return fitDecoded(proxy.decodedImage, maxDim), nil
+	}
+
+	key := fmt.Sprintf("%s:%d", source, maxDim)
+	proxyBuildsMu.Lock()
+	build, running := proxyBuilds[key]
+	if !running {
+		build = &proxyBuild{done: make(chan struct{})}
+		proxyBuilds[key] = build
+
+		// Not tied to this request: others may be waiting on the result,
+		// and a finished proxy still serves the next slider tweak
+		go func() {
+			defer close(build.done)
+			decoded, err := fs.buildPreviewProxy(context.Background(), media, maxDim)
+			if err == nil {
+				// An original that already fit serves every preview size
+				covers := maxDim
+				if bounds := decoded.Image.Bounds(); max(bounds.Dx(), bounds.Dy()) < maxDim {
+					covers = MaxPreviewDim
+				}
+				build.proxy = &previewProxyImage{decodedImage: decoded, maxDim: covers}
+				if held, ok := previewProxies.get(source); !ok || held.maxDim < covers {
+					previewProxies.put(source, build.proxy)
+				}
+			}
+			build.err = err
+
+			proxyBuildsMu.Lock()
+			delete(proxyBuilds, key)
+			proxyBuildsMu.Unlock()
+		}()
+	}
+	proxyBuildsMu.Unlock()
+
+	select {
+	case <-build.done:
+		if build.err != nil {
+			return nil, build.err
+		}
+		return build.proxy.decodedImage, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (fs *FilterService) buildPreviewProxy(ctx context.Context, media *models.MediaFile, maxDim int) (*decodedImage, error) {
+	reader, err := fs.minioSvc.GetFileContent(media.WorkingFileName())
+	if err != nil {
+		return nil, fmt.Errorf("failed to download image: %w", err)
+	}
+	defer reader.Close()
+
+	imageData, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image data: %w", err)
+	}
+	decoded, err := decodeImage(ctx, imageData, media.OriginalFormat, media.WorkingOrientation())
+	if err != nil {
+		return nil, err
+	}
+	return fitDecoded(decoded, maxDim), nil
+}
+
+// fitDecoded shrinks decoded so its long edge is at most maxDim
+func fitDecoded(decoded *decodedImage, maxDim int) *decodedImage {
+	bounds := decoded.Image.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= maxDim && h <= maxDim {
+		return decoded
+	}
+	if w >= h {
+		w, h = maxDim, max(1, h*maxDim/w)
+	} else {
+		w, h = max(1, w*maxDim/h), maxDim
+	}
+	scaled := image.NewNRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(scaled, scaled.Rect, decoded.Image, bounds, xdraw.Src, nil)
+
+	proxy := *decoded
+	proxy.Image = scaled
+	return &proxy
+}
+
+// decodedSize estimates the memory held by a decoded image
+func decodedSize(img image.Image) int64 {
+	switch m := img.(type) {
+	case *image.NRGBA:
+		return int64(len(m.Pix))
+	case *image.RGBA:
+		return int64(len(m.Pix))
+	case *image.NRGBA64:
+		return int64(len(m.Pix))
+	case *image.RGBA64:
+		return int64(len(m.Pix))
+	case *image.Gray:
+		return int64(len(m.Pix))
+	case *image.Gray16:
+		return int64(len(m.Pix))
+	case *image.YCbCr:
+		return int64(len(m.Y) + len(m.Cb) + len(m.Cr))
+	case *image.CMYK:
+		return int64(len(m.Pix))
+	case *image.Paletted:
+		return int64(len(m.Pix))
+	}
+	bounds := img.Bounds()
+	return int64(bounds.Dx()) * int64(bounds.Dy()) * 4
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"testing"
+	"time"
+
+	"mediaVault-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func testPreviewMedia() *models.MediaFile {
+	return &models.MediaFile{ID: primitive.NewObjectID(), FileName: "test.png", Size: 1234}
+}
+
+func previewSource(media *models.MediaFile) string {
+	return fmt.Sprintf("%s:%s:%d:%d", media.ID.Hex(), media.WorkingFileName(), media.Size, media.WorkingOrientation())
+}
+
+// Smaller previews are scaled down from the held proxy without decoding
+func TestPreviewProxyReuse(t *testing.T) {
+	fs := &FilterService{}
+	media := testPreviewMedia()
+	held := &previewProxyImage{decodedImage: &decodedImage{Image: image.NewNRGBA(image.Rect(0, 0, 1024, 512))}, maxDim: 1024}
+	previewProxies.put(previewSource(media), held)
+
+	for _, tt := range []struct{ maxDim, w, h int }{{1024, 1024, 512}, {800, 800, 400}, {64, 64, 32}} {
+		proxy, err := fs.previewProxy(context.Background(), media, tt.maxDim)
+		if err != nil {
+			t.Fatalf("maxDim %d: %v", tt.maxDim, err)
+		}
+		if b := proxy.Image.Bounds(); b.Dx() != tt.w || b.Dy() != tt.h {
+			t.Errorf("maxDim %d: got %dx%d, want %dx%d", tt.maxDim, b.Dx(), b.Dy(), tt.w, tt.h)
+		}
+	}
+	if n, size := previewProxies.usage(); n == 0 || size < 1024*512*4 {
+		t.Errorf("usage = %d entries, %d bytes", n, size)
+	}
+}
+
+// Callers waiting on a shared build give up with their own context, and the
+// build still completes for the others
+func TestPreviewProxyWaitCancel(t *testing.T) {
+	fs := &FilterService{}
+	media := testPreviewMedia()
+	key := fmt.Sprintf("%s:%d", previewSource(media), 800)
+	build := &proxyBuild{done: make(chan struct{})}
+	proxyBuildsMu.Lock()
+	proxyBuilds[key] = build
+	proxyBuildsMu.Unlock()
+	defer func() {
+		proxyBuildsMu.Lock()
+		delete(proxyBuilds, key)
+		proxyBuildsMu.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := fs.previewProxy(ctx, media, 800); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+
+	waited := make(chan error, 1)
+	go func() {
+		_, err := fs.previewProxy(context.Background(), media, 800)
+		waited <- err
+	}()
+	build.proxy = &previewProxyImage{decodedImage: &decodedImage{Image: image.NewNRGBA(image.Rect(0, 0, 800, 600))}, maxDim: 800}
+	close(build.done)
+	if err := <-waited; err != nil {
+		t.Fatalf("waiting caller: %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"strings"
+	"time"
+
+	"mediaVault-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// logoCacheSize is how many watermark logos stay decoded in memory
+const logoCacheSize = 16
+
+// ErrInvalidWatermark is returned for watermark settings that can't be saved
+var ErrInvalidWatermark = errors.New("invalid watermark")
+
+var watermarkLogos = newLRUCache[image.Image](logoCacheSize)
+
+// GetDefaultWatermark returns the watermark params the user stamps on
+// delivered media, or nil if they haven't set one
+func (fs *FilterService) GetDefaultWatermark(ctx context.Context, userID primitive.ObjectID) (map[string]interface{}, error) {
+	var prefs models.UserFilterPreference
+	opts := options.FindOne().SetProjection(bson.M{"defaultWatermark": 1})
+	err := fs.db.Collection("user_filter_preferences").FindOne(ctx, bson.M{"userId": userID}, opts).Decode(&prefs)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load default watermark: %w", err)
+	}
+	return prefs.DefaultWatermark, nil
+}
+
+// SaveDefaultWatermark validates and stores the user's default watermark.
+// A logo must be an image the user owns. Rejected settings wrap
+// ErrInvalidWatermark.
+func (fs *FilterService) SaveDefaultWatermark(ctx context.Context, userID primitive.ObjectID, params map[string]interface{}) error {
+	if err := validateWatermarkParams(params); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidWatermark, err)
+	}
+	if ref := paramString(params, "logo", ""); ref != "" {
+		id, _ := primitive.ObjectIDFromHex(ref)
+		media, err := fs.getMediaFile(ctx, id)
+		if err != nil || media.UserID != userID {
+			return fmt.Errorf("%w: logo not found", ErrInvalidWatermark)
+		}
+		if !strings.HasPrefix(media.MimeType, "image/") || media.IsSVG() {
+			return fmt.Errorf("%w: logo must be a raster image", ErrInvalidWatermark)
+		}
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"defaultWatermark": params,
+			"updatedAt":        time.Now(),
+		},
+		"$setOnInsert": bson.M{
+			"userId":         userID,
+			"frequentlyUsed": []primitive.ObjectID{},
+			"customPresets":  []primitive.ObjectID{},
+			"styleProfile":   models.StyleProfile{},
+			"usageCount":     map[string]int{},
+			"createdAt":      time.Now(),
+		},
+	}
+	_, err := fs.db.Collection("user_filter_preferences").UpdateOne(ctx, bson.M{"userId": userID}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save default watermark: %w", err)
+	}
+	return nil
+}
+
+// DeleteDefaultWatermark stops watermarking the user's delivered media
+func (fs *FilterService) DeleteDefaultWatermark(ctx context.Context, userID primitive.ObjectID) error {
+	update := bson.M{"$unset": bson.M{"defaultWatermark": ""}}
+	if _, err := fs.db.Collection("user_filter_preferences").UpdateOne(ctx, bson.M{"userId": userID}, update); err != nil {
+		return fmt.Errorf("failed to delete default watermark: %w", err)
+	}
+	return nil
+}
+
+// loadLogo decodes the image a watermark's logo param references, shrunk to
+// maxLogoWidth
+func (fs *FilterService) loadLogo(ctx context.Context, ref string) (image.Image, error) {
+	if logo, ok := watermarkLogos.get(ref); ok {
+		return logo, nil
+	}
+
+	id, err := primitive.ObjectIDFromHex(ref)
+	if err != nil {
+		return nil, fmt.Errorf("invalid logo ID %q", ref)
+	}
+	media, err := fs.getMediaFile(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get logo %s: %w", ref, err)
+	}
+	if !strings.HasPrefix(media.MimeType, "image/") {
+		return nil, fmt.Errorf("logo %s is not an image", ref)
+	}
+
+	reader, err := fs.minioSvc.GetFileContent(media.WorkingFileName())
+	if err != nil {
+		return nil, fmt.Errorf("failed to download logo %s: %w", ref, err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read logo %s: %w", ref, err)
+	}
+
+	decoded, err := decodeImage(ctx, data, media.OriginalFormat, media.WorkingOrientation())
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode logo %s: %w", ref, err)
+	}
+	logo := decoded.Image
+	if logo.Bounds().Dx() > maxLogoWidth {
+		logo = scaleToWidth(logo, maxLogoWidth)
+	}
+
+	watermarkLogos.put(ref, logo)
+	return logo, nil
+}
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+
+	"mediaVault-backend/internal/models"
+)
+
+// maxStraighten bounds straightening; beyond 45° a quarter turn plus a
+// smaller correction loses far less of the image
+const maxStraighten = 45
+
+// geometryStages returns the pipeline stages for g together with the size of
+// the image they produce, so later stages can be sized up front
+func geometryStages(g *models.GeometryConfig, w, h int) ([]pipelineStage, int, int) {
+	if g == nil {
+		return nil, w, h
+	}
+	var stages []pipelineStage
+
+	if g.Rotate != nil {
+		if turns := ((*g.Rotate/90)%4 + 4) % 4; turns != 0 {
+			stages = append(stages, pipelineStage{geometry: func(buf *rgbBuffer) *rgbBuffer {
+				return rotateBuffer(buf, turns)
+			}})
+			if turns%2 == 1 {
+				w, h = h, w
+			}
+		}
+	}
+
+	flipH := g.FlipH != nil && *g.FlipH
+	flipV := g.FlipV != nil && *g.FlipV
+	if flipH || flipV {
+		stages = append(stages, pipelineStage{geometry: func(buf *rgbBuffer) *rgbBuffer {
+			return flipBuffer(buf, flipH, flipV)
+		}})
+	}
+
+	if g.Straighten != nil && *g.Straighten != 0 {
+		angle := clampParam(*g.Straighten, -maxStraighten, maxStraighten)
+		w, h = straightenedSize(w, h, angle)
+		stages = append(stages, pipelineStage{geometry: func(buf *rgbBuffer) *rgbBuffer {
+			return straightenBuffer(buf, angle)
+		}})
+	}
+
+	if g.Crop != nil {
+		region := cropRegion(w, h, *g.Crop)
+		w, h = region.Dx(), region.Dy()
+		stages = append(stages, pipelineStage{geometry: func(buf *rgbBuffer) *rgbBuffer {
+			return cropBuffer(buf, region)
+		}})
+	}
+
+	if ratio, ok := parseAspect(g.Aspect); ok {
+		focalX, focalY := 0.5, 0.5
+		if g.FocalX != nil {
+			focalX = clampParam(*g.FocalX, 0, 1)
+		}
+		if g.FocalY != nil {
+			focalY = clampParam(*g.FocalY, 0, 1)
+		}
+		region := aspectRegion(w, h, ratio, focalX, focalY)
+		w, h = region.Dx(), region.Dy()
+		stages = append(stages, pipelineStage{geometry: func(buf *rgbBuffer) *rgbBuffer {
+			return cropBuffer(buf, region)
+		}})
+	}
+
+	return stages, w, h
+}
+
+// validateGeometry rejects geometry that can't be rendered
+func validateGeometry(g *models.GeometryConfig) error {
+	if g == nil {
+		return nil
+	}
+	if g.Rotate != nil && *g.Rotate%90 != 0 {
+		return fmt.Errorf("geometry.rotate must be a multiple of 90")
+	}
+	if g.Straighten != nil && math.Abs(*g.Straighten) > maxStraighten {
+		return fmt.Errorf("geometry.straighten must be between -%d and %d degrees", maxStraighten, maxStraighten)
+	}
+	if g.Crop != nil {
+		if err := validateCropRect(g.Crop); err != nil {
+			return fmt.Errorf("geometry.%w", err)
+		}
+	}
+	if g.Aspect != "" {
+		if _, ok := parseAspect(g.Aspect); !ok {
+			return fmt.Errorf("geometry.aspect must look like \"16:9\", got %q", g.Aspect)
+		}
+	}
+	for name, v := range map[string]*float64{"focalX": g.FocalX, "focalY": g.FocalY} {
+		if v != nil && (*v < 0 || *v > 1) {
+			return fmt.Errorf("geometry.%s must be between 0 and 1", name)
+		}
+	}
+	return nil
+}
+
+// validateCropRect checks that a fractional crop lies inside the image
+func validateCropRect(crop *models.CropRect) error {
+	if crop == nil {
+		return fmt.Errorf("crop rectangle is required")
+	}
+	const epsilon = 1e-6
+	if crop.X < 0 || crop.Y < 0 || crop.Width <= 0 || crop.Height <= 0 ||
+		crop.X+crop.Width > 1+epsilon || crop.Y+crop.Height > 1+epsilon {
+		return fmt.Errorf("crop must be a non-empty rectangle within 0-1 of the image")
+	}
+	return nil
+}
+
+// parseAspect reads "W:H" into a width/height ratio
+func parseAspect(aspect string) (float64, bool) {
+	parts := strings.Split(strings.TrimSpace(aspect), ":")
+	if len(parts) != 2 {
+		return 0, false
+	}
+	w, errW := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	h, errH := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if errW != nil || errH != nil || w <= 0 || h <= 0 {
+		return 0, false
+	}
+	return w / h, true
+}
+
+// cropRegion converts a fractional crop into pixels, at least 1x1
+func cropRegion(w, h int, crop models.CropRect) image.Rectangle {
+	x0 := min(w-1, int(math.Round(crop.X*float64(w))))
+	y0 := min(h-1, int(math.Round(crop.Y*float64(h))))
+	x1 := min(w, max(x0+1, int(math.Round((crop.X+crop.Width)*float64(w)))))
+	y1 := min(h, max(y0+1, int(math.Round((crop.Y+crop.Height)*float64(h)))))
+	return image.Rect(x0, y0, x1, y1)
+}
+
+// aspectRegion is the largest region with the given width/height ratio,
+// centered on the focal point as far as the image edges allow
+func aspectRegion(w, h int, ratio, focalX, focalY float64) image.Rectangle {
+	cw, ch := w, h
+	if float64(w)/float64(h) > ratio {
+		cw = max(1, int(math.Round(float64(h)*ratio)))
+	} else {
+		ch = max(1, int(math.Round(float64(w)/ratio)))
+	}
+	x0 := int(math.Round(focalX*float64(w) - float64(cw)/2))
+	y0 := int(math.Round(focalY*float64(h) - float64(ch)/2))
+	x0 = min(max(x0, 0), w-cw)
+	y0 = min(max(y0, 0), h-ch)
+	return image.Rect(x0, y0, x0+cw, y0+ch)
+}
+
+// straightenedSize is the largest rectangle with the original proportions
+// that fits inside the image rotated by degrees
+func straightenedSize(w, h int, degrees float64) (int, int) {
+	rad := degrees * math.Pi / 180
+	c, s := math.Abs(math.Cos(rad)), math.Abs(math.Sin(rad))
+	fw, fh := float64(w), float64(h)
+	scale := math.Min(fw/(fw*c+fh*s), fh/(fw*s+fh*c))
+	return max(1, int(math.Floor(fw*scale))), max(1, int(math.Floor(fh*scale)))
+}
+
+// straightenBuffer rotates the content clockwise by degrees around the
+// center with bilinear sampling and crops away the empty corners
+func straightenBuffer(buf *rgbBuffer, degrees float64) *rgbBuffer {
+	w, h := straightenedSize(buf.w, buf.h, degrees)
+	out := newEmptyBuffer(w, h)
+
+	rad := degrees * math.Pi / 180
+	cos, sin := math.Cos(rad), math.Sin(rad)
+	cx, cy := float64(buf.w)/2, float64(buf.h)/2
+	ox, oy := float64(w)/2, float64(h)/2
+
+	parallelFor(h, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			for x := 0; x < w; x++ {
+				// Map the output pixel center back into the source
+				u, v := float64(x)+0.5-ox, float64(y)+0.5-oy
+				sx := u*cos + v*sin + cx - 0.5
+				sy := -u*sin + v*cos + cy - 0.5
+
+				i := y*w + x
+				for c := 0; c < 3; c++ {
+					out.pix[i*3+c] = buf.sample(sx, sy, c)
+				}
+				nx := min(max(int(math.Round(sx)), 0), buf.w-1)
+				ny := min(max(int(math.Round(sy)), 0), buf.h-1)
+				out.alpha[i] = buf.alpha[ny*buf.w+nx]
+			}
+		}
+	})
+	return out
+}
+
+// rotateBuffer turns the buffer clockwise by quarter turns (1-3)
+func rotateBuffer(buf *rgbBuffer, turns int) *rgbBuffer {
+	w, h := buf.w, buf.h
+	if turns%2 == 1 {
+		w, h = h, w
+	}
+	out := newEmptyBuffer(w, h)
+
+	parallelFor(buf.h, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			for x := 0; x < buf.w; x++ {
+				var dx, dy int
+				switch turns {
+				case 1:
+					dx, dy = buf.h-1-y, x
+				case 2:
+					dx, dy = buf.w-1-x, buf.h-1-y
+				default:
+					dx, dy = y, buf.w-1-x
+				}
+				src, dst := y*buf.w+x, dy*w+dx
+				copy(out.pix[dst*3:dst*3+3], buf.pix[src*3:src*3+3])
+				out.alpha[dst] = buf.alpha[src]
+			}
+		}
+	})
+	return out
+}
+
+// flipBuffer mirrors the buffer in place
+func flipBuffer(buf *rgbBuffer, horizontal, vertical bool) *rgbBuffer {
+	w, h := buf.w, buf.h
+	swap := func(a, b int) {
+		for c := 0; c < 3; c++ {
+			buf.pix[a*3+c], buf.pix[b*3+c] = buf.pix[b*3+c], buf.pix[a*3+c]
+		}
+		buf.alpha[a], buf.alpha[b] = buf.alpha[b], buf.alpha[a]
+	}
+
+	if horizontal {
+		parallelFor(h, func(y0, y1 int) {
+			for y := y0; y < y1; y++ {
+				for l, r := y*w, y*w+w-1; l < r; l, r = l+1, r-1 {
+					swap(l, r)
+				}
+			}
+		})
+	}
+	if vertical {
+		parallelFor(w, func(x0, x1 int) {
+			for x := x0; x < x1; x++ {
+				for t, b := x, (h-1)*w+x; t < b; t, b = t+w, b-w {
+					swap(t, b)
+				}
+			}
+		})
+	}
+	return buf
+}
+
+// cropBuffer copies region out of the buffer
+func cropBuffer(buf *rgbBuffer, region image.Rectangle) *rgbBuffer {
+	region = region.Intersect(image.Rect(0, 0, buf.w, buf.h))
+	if region.Empty() {
+		return buf
+	}
+	out := newEmptyBuffer(region.Dx(), region.Dy())
+	for y := 0; y < out.h; y++ {
+		src := (region.Min.Y+y)*buf.w + region.Min.X
+		copy(out.pix[y*out.w*3:(y+1)*out.w*3], buf.pix[src*3:(src+out.w)*3])
+		copy(out.alpha[y*out.w:(y+1)*out.w], buf.alpha[src:src+out.w])
+	}
+	return out
+}
+
+func newEmptyBuffer(w, h int) *rgbBuffer {
+	return &rgbBuffer{
+		rect:  image.Rect(0, 0, w, h),
+		w:     w,
+		h:     h,
+		pix:   make([]float32, w*h*3),
+		alpha: make([]uint8, w*h),
+	}
+}
@@ -0,0 +1,504 @@
+package services
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"runtime"
+	"sync"
+)
+
+// rgbBuffer is a floating point working copy of an image used by the effect
+// algorithms. Color channels are interleaved RGB in the 0..1 range; alpha is
+// carried through untouched.
+type rgbBuffer struct {
+	rect  image.Rectangle
+	w, h  int
+	pix   []float32
+	alpha []uint8
+}
+
+// newRGBBuffer converts img once into a float buffer. Common decoder output
+// types are read straight from their Pix slices; anything else falls back to
+// the generic color interface. Rows are converted in parallel.
+func newRGBBuffer(img image.Image) *rgbBuffer {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	buf := &rgbBuffer{
+		rect:  bounds,
+		w:     w,
+		h:     h,
+		pix:   make([]float32, w*h*3),
+		alpha: make([]uint8, w*h),
+	}
+
+	parallelFor(h, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			buf.readRow(img, y)
+		}
+	})
+	return buf
+}
+
+// readRow fills row y (relative to the buffer) from src
+func (b *rgbBuffer) readRow(src image.Image, y int) {
+	out := b.pix[y*b.w*3 : (y+1)*b.w*3]
+	alpha := b.alpha[y*b.w : (y+1)*b.w]
+	sy := b.rect.Min.Y + y
+
+	switch img := src.(type) {
+	case *image.NRGBA:
+		row := img.Pix[img.PixOffset(b.rect.Min.X, sy):]
+		for x := 0; x < b.w; x++ {
+			out[x*3] = float32(row[x*4]) / 255
+			out[x*3+1] = float32(row[x*4+1]) / 255
+			out[x*3+2] = float32(row[x*4+2]) / 255
+			alpha[x] = row[x*4+3]
+		}
+	case *image.RGBA:
+		row := img.Pix[img.PixOffset(b.rect.Min.X, sy):]
+		for x := 0; x < b.w; x++ {
+			a := row[x*4+3]
+			alpha[x] = a
+			if a == 0 {
+				continue
+			}
+			scale := 1 / float32(a)
+			out[x*3] = float32(row[x*4]) * scale
+			out[x*3+1] = float32(row[x*4+1]) * scale
+			out[x*3+2] = float32(row[x*4+2]) * scale
+		}
+	case *image.YCbCr:
+		for x := 0; x < b.w; x++ {
+			sx := b.rect.Min.X + x
+			yi, ci := img.YOffset(sx, sy), img.COffset(sx, sy)
+			r, g, bl := color.YCbCrToRGB(img.Y[yi], img.Cb[ci], img.Cr[ci])
+			out[x*3] = float32(r) / 255
+			out[x*3+1] = float32(g) / 255
+			out[x*3+2] = float32(bl) / 255
+			alpha[x] = 255
+		}
+	case *image.Gray:
+		row := img.Pix[img.PixOffset(b.rect.Min.X, sy):]
+		for x := 0; x < b.w; x++ {
+			v := float32(row[x]) / 255
+			out[x*3], out[x*3+1], out[x*3+2] = v, v, v
+			alpha[x] = 255
+		}
+	case *image.NRGBA64:
+		row := img.Pix[img.PixOffset(b.rect.Min.X, sy):]
+		for x := 0; x < b.w; x++ {
+			p := row[x*8:]
+			out[x*3] = float32(uint16(p[0])<<8|uint16(p[1])) / 65535
+			out[x*3+1] = float32(uint16(p[2])<<8|uint16(p[3])) / 65535
+			out[x*3+2] = float32(uint16(p[4])<<8|uint16(p[5])) / 65535
+			alpha[x] = p[6]
+		}
+	case *image.RGBA64:
+		row := img.Pix[img.PixOffset(b.rect.Min.X, sy):]
+		for x := 0; x < b.w; x++ {
+			p := row[x*8:]
+			a := uint16(p[6])<<8 | uint16(p[7])
+			alpha[x] = p[6]
+			if a == 0 {
+				continue
+			}
+			scale := 1 / float32(a)
+			out[x*3] = float32(uint16(p[0])<<8|uint16(p[1])) * scale
+			out[x*3+1] = float32(uint16(p[2])<<8|uint16(p[3])) * scale
+			out[x*3+2] = float32(uint16(p[4])<<8|uint16(p[5])) * scale
+		}
+	case *image.Gray16:
+		row := img.Pix[img.PixOffset(b.rect.Min.X, sy):]
+		for x := 0; x < b.w; x++ {
+			v := float32(uint16(row[x*2])<<8|uint16(row[x*2+1])) / 65535
+			out[x*3], out[x*3+1], out[x*3+2] = v, v, v
+			alpha[x] = 255
+		}
+	case *image.CMYK:
+		row := img.Pix[img.PixOffset(b.rect.Min.X, sy):]
+		for x := 0; x < b.w; x++ {
+			r, g, bl := color.CMYKToRGB(row[x*4], row[x*4+1], row[x*4+2], row[x*4+3])
+			out[x*3] = float32(r) / 255
+			out[x*3+1] = float32(g) / 255
+			out[x*3+2] = float32(bl) / 255
+			alpha[x] = 255
+		}
+	case *image.Paletted:
+		palette := paletteColors(img.Palette)
+		row := img.Pix[img.PixOffset(b.rect.Min.X, sy):]
+		for x := 0; x < b.w; x++ {
+			i := int(row[x])
+			if i >= len(palette) {
+				// Out of range indexes read as transparent black, like At
+				alpha[x] = 0
+				continue
+			}
+			c := palette[i]
+			out[x*3], out[x*3+1], out[x*3+2] = c[0], c[1], c[2]
+			alpha[x] = uint8(c[3])
+		}
+	default:
+		for x := 0; x < b.w; x++ {
+			r, g, bl, a := src.At(b.rect.Min.X+x, sy).RGBA()
+			alpha[x] = uint8(a >> 8)
+			if a == 0 {
+				continue
+			}
+			scale := 1 / float32(a)
+			out[x*3] = float32(r) * scale
+			out[x*3+1] = float32(g) * scale
+			out[x*3+2] = float32(bl) * scale
+		}
+	}
+}
+
+// paletteColors converts a palette to straight float RGB plus 8-bit alpha
+// (in the fourth slot)
+func paletteColors(p color.Palette) [][4]float32 {
+	colors := make([][4]float32, len(p))
+	for i, c := range p {
+		r, g, b, a := c.RGBA()
+		colors[i][3] = float32(a >> 8)
+		if a == 0 {
+			continue
+		}
+		scale := 1 / float32(a)
+		colors[i][0] = float32(r) * scale
+		colors[i][1] = float32(g) * scale
+		colors[i][2] = float32(b) * scale
+	}
+	return colors
+}
+
+func (b *rgbBuffer) clone() *rgbBuffer {
+	return &rgbBuffer{
+		rect:  b.rect,
+		w:     b.w,
+		h:     b.h,
+		pix:   append([]float32(nil), b.pix...),
+		alpha: append([]uint8(nil), b.alpha...),
+	}
+}
+
+func (b *rgbBuffer) toNRGBA() *image.NRGBA {
+	out := image.NewNRGBA(b.rect)
+	parallelFor(b.h, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			row := out.Pix[y*out.Stride:]
+			for x := 0; x < b.w; x++ {
+				i := y*b.w + x
+				row[x*4] = toByte(b.pix[i*3])
+				row[x*4+1] = toByte(b.pix[i*3+1])
+				row[x*4+2] = toByte(b.pix[i*3+2])
+				row[x*4+3] = b.alpha[i]
+			}
+		}
+	})
+	return out
+}
+
+// toNRGBA64 is toNRGBA at 16 bits per channel, for 16-bit sources and
+// working copies that would band at 8 bits
+func (b *rgbBuffer) toNRGBA64() *image.NRGBA64 {
+	out := image.NewNRGBA64(b.rect)
+	parallelFor(b.h, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			row := out.Pix[y*out.Stride:]
+			for x := 0; x < b.w; x++ {
+				i := y*b.w + x
+				p := row[x*8:]
+				putUint16(p, toUint16(float64(b.pix[i*3])))
+				putUint16(p[2:], toUint16(float64(b.pix[i*3+1])))
+				putUint16(p[4:], toUint16(float64(b.pix[i*3+2])))
+				putUint16(p[6:], uint16(b.alpha[i])*0x101)
+			}
+		}
+	})
+	return out
+}
+
+// pixelFunc transforms one pixel in place: r, g, b and alpha in 0..1. x and y
+// are buffer coordinates for position-dependent ops. Implementations must be
+// safe to call from several goroutines.
+type pixelFunc func(x, y int, px *[4]float32)
+
+// applyPixels runs a chain of per-pixel ops in a single parallel pass, so
+// consecutive adjustments cost one trip through memory instead of one each
+func (b *rgbBuffer) applyPixels(fns []pixelFunc) {
+	if len(fns) == 0 {
+		return
+	}
+	parallelFor(b.h, func(y0, y1 int) {
+		var px [4]float32
+		for y := y0; y < y1; y++ {
+			for x := 0; x < b.w; x++ {
+				i := y*b.w + x
+				px = [4]float32{b.pix[i*3], b.pix[i*3+1], b.pix[i*3+2], float32(b.alpha[i]) / 255}
+				for _, fn := range fns {
+					fn(x, y, &px)
+				}
+				b.pix[i*3], b.pix[i*3+1], b.pix[i*3+2] = px[0], px[1], px[2]
+				b.alpha[i] = toByte(px[3])
+			}
+		}
+	})
+}
+
+// luminance returns Rec. 601 luma per pixel
+func (b *rgbBuffer) luminance() []float32 {
+	lum := make([]float32, b.w*b.h)
+	parallelFor(len(lum), func(start, end int) {
+		for i := start; i < end; i++ {
+			lum[i] = luma(b.pix[i*3], b.pix[i*3+1], b.pix[i*3+2])
+		}
+	})
+	return lum
+}
+
+func luma(r, g, b float32) float32 {
+	return 0.299*r + 0.587*g + 0.114*b
+}
+
+// sample reads channel c at a fractional position with bilinear
+// interpolation, clamping at the edges
+func (b *rgbBuffer) sample(x, y float64, c int) float32 {
+	x = math.Max(0, math.Min(float64(b.w-1), x))
+	y = math.Max(0, math.Min(float64(b.h-1), y))
+	x0, y0 := int(x), int(y)
+	x1, y1 := min(x0+1, b.w-1), min(y0+1, b.h-1)
+	tx, ty := float32(x-float64(x0)), float32(y-float64(y0))
+
+	p := func(px, py int) float32 { return b.pix[(py*b.w+px)*3+c] }
+	top := p(x0, y0) + tx*(p(x1, y0)-p(x0, y0))
+	bottom := p(x0, y1) + tx*(p(x1, y1)-p(x0, y1))
+	return top + ty*(bottom-top)
+}
+
+func toByte(v float32) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 1 {
+		return 255
+	}
+	return uint8(v*255 + 0.5)
+}
+
+func clampUnit(v float32) float32 {
+	if v < 0 {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
+
+// effectScale converts pixel sizes tuned for ~1 megapixel images into sizes
+// for this image, so effects look the same regardless of resolution
+func effectScale(w, h int) float64 {
+	return math.Max(1, float64(max(w, h))/1024)
+}
+
+// gaussianBlur blurs interleaved data with the given number of channels in
+// place. Small radii use an exact separable kernel; larger ones the standard
+// three box blur approximation, which stays linear in the image size.
+func gaussianBlur(data []float32, w, h, channels int, sigma float64) {
+	if sigma <= 0 || w == 0 || h == 0 {
+		return
+	}
+	if sigma < 2 {
+		blurKernel(data, w, h, channels, gaussianKernel(sigma))
+		return
+	}
+
+	tmp := make([]float32, len(data))
+	for _, size := range boxSizesForGauss(sigma, 3) {
+		r := (size - 1) / 2
+		boxBlurH(data, tmp, w, h, channels, r)
+		boxBlurV(tmp, data, w, h, channels, r)
+	}
+}
+
+func gaussianKernel(sigma float64) []float32 {
+	radius := int(math.Ceil(sigma * 3))
+	kernel := make([]float32, radius*2+1)
+	var sum float32
+	for i := -radius; i <= radius; i++ {
+		v := float32(math.Exp(-float64(i*i) / (2 * sigma * sigma)))
+		kernel[i+radius] = v
+		sum += v
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+	return kernel
+}
+
+// blurKernel applies a symmetric 1D kernel horizontally then vertically,
+// clamping at the edges
+func blurKernel(data []float32, w, h, channels int, kernel []float32) {
+	radius := len(kernel) / 2
+	tmp := make([]float32, len(data))
+
+	parallelFor(h, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			for x := 0; x < w; x++ {
+				for c := 0; c < channels; c++ {
+					var sum float32
+					for k := -radius; k <= radius; k++ {
+						sx := min(max(x+k, 0), w-1)
+						sum += data[(y*w+sx)*channels+c] * kernel[k+radius]
+					}
+					tmp[(y*w+x)*channels+c] = sum
+				}
+			}
+		}
+	})
+
+	parallelFor(h, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			for x := 0; x < w; x++ {
+				for c := 0; c < channels; c++ {
+					var sum float32
+					for k := -radius; k <= radius; k++ {
+						sy := min(max(y+k, 0), h-1)
+						sum += tmp[(sy*w+x)*channels+c] * kernel[k+radius]
+					}
+					data[(y*w+x)*channels+c] = sum
+				}
+			}
+		}
+	})
+}
+
+// boxSizesForGauss returns n box widths whose successive application
+// approximates a gaussian with the given sigma
+func boxSizesForGauss(sigma float64, n int) []int {
+	ideal := math.Sqrt(12*sigma*sigma/float64(n) + 1)
+	wl := int(math.Floor(ideal))
+	if wl%2 == 0 {
+		wl--
+	}
+	wu := wl + 2
+
+	mIdeal := (12*sigma*sigma - float64(n*wl*wl) - float64(4*n*wl) - float64(3*n)) / float64(-4*wl-4)
+	m := int(math.Round(mIdeal))
+
+	sizes := make([]int, n)
+	for i := range sizes {
+		if i < m {
+			sizes[i] = wl
+		} else {
+			sizes[i] = wu
+		}
+	}
+	return sizes
+}
+
+func boxBlurH(src, dst []float32, w, h, channels, r int) {
+	scale := 1 / float32(2*r+1)
+	parallelFor(h, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			row := y * w
+			for c := 0; c < channels; c++ {
+				var sum float32
+				for k := -r; k <= r; k++ {
+					sum += src[(row+min(max(k, 0), w-1))*channels+c]
+				}
+				for x := 0; x < w; x++ {
+					dst[(row+x)*channels+c] = sum * scale
+					add := min(x+r+1, w-1)
+					sub := max(x-r, 0)
+					sum += src[(row+add)*channels+c] - src[(row+sub)*channels+c]
+				}
+			}
+		}
+	})
+}
+
+func boxBlurV(src, dst []float32, w, h, channels, r int) {
+	scale := 1 / float32(2*r+1)
+	parallelFor(w, func(x0, x1 int) {
+		for x := x0; x < x1; x++ {
+			for c := 0; c < channels; c++ {
+				var sum float32
+				for k := -r; k <= r; k++ {
+					sum += src[(min(max(k, 0), h-1)*w+x)*channels+c]
+				}
+				for y := 0; y < h; y++ {
+					dst[(y*w+x)*channels+c] = sum * scale
+					add := min(y+r+1, h-1)
+					sub := max(y-r, 0)
+					sum += src[(add*w+x)*channels+c] - src[(sub*w+x)*channels+c]
+				}
+			}
+		}
+	})
+}
+
+// sobelMagnitude returns the gradient magnitude of a single channel plane
+func sobelMagnitude(plane []float32, w, h int) []float32 {
+	out := make([]float32, w*h)
+	at := func(x, y int) float32 {
+		return plane[min(max(y, 0), h-1)*w+min(max(x, 0), w-1)]
+	}
+	parallelFor(h, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			for x := 0; x < w; x++ {
+				gx := at(x+1, y-1) + 2*at(x+1, y) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x-1, y) - at(x-1, y+1)
+				gy := at(x-1, y+1) + 2*at(x, y+1) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x, y-1) - at(x+1, y-1)
+				out[y*w+x] = float32(math.Sqrt(float64(gx*gx + gy*gy)))
+			}
+		}
+	})
+	return out
+}
+
+var (
+	pixelPoolOnce  sync.Once
+	pixelPoolTasks chan func()
+)
+
+// parallelFor splits [0, n) into contiguous chunks and runs fn over them on a
+// process-wide pool of GOMAXPROCS workers, so concurrent requests share the
+// CPUs instead of each spawning their own goroutines. fn must not call
+// parallelFor itself.
+func parallelFor(n int, fn func(start, end int)) {
+	workers := runtime.GOMAXPROCS(0)
+	if workers <= 1 || n < 64 {
+		fn(0, n)
+		return
+	}
+
+	pixelPoolOnce.Do(func() {
+		pixelPoolTasks = make(chan func())
+		for i := 0; i < workers; i++ {
+			go func() {
+				for task := range pixelPoolTasks {
+					task()
+				}
+			}()
+		}
+	})
+
+	// A few chunks per worker keeps the load even when rows differ in cost
+	chunk := max(1, (n+workers*4-1)/(workers*4))
+	var wg sync.WaitGroup
+	for start := 0; start < n; start += chunk {
+		end := min(start+chunk, n)
+		wg.Add(1)
+		task := func() {
+			defer wg.Done()
+			fn(start, end)
+		}
+		select {
+		case pixelPoolTasks <- task:
+		default:
+			// Every worker is busy; do the work here rather than queueing
+			task()
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"image"
+	"image/color"
+	"image/color/palette"
+	"math"
+	"math/rand"
+	"testing"
+
+	"mediaVault-backend/internal/models"
+)
+
+// opaqueImage hides the concrete type of an image, forcing the generic
+// At() conversion path
+type opaqueImage struct{ image.Image }
+
+func TestRGBBufferFastPaths(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	rect := image.Rect(3, 5, 40, 29)
+	u8 := func() uint8 { return uint8(rng.Intn(256)) }
+	u16 := func() uint16 { return uint16(rng.Intn(65536)) }
+
+	images := map[string]image.Image{}
+
+	nrgba := image.NewNRGBA(rect)
+	rgba := image.NewRGBA(rect)
+	nrgba64 := image.NewNRGBA64(rect)
+	rgba64 := image.NewRGBA64(rect)
+	gray := image.NewGray(rect)
+	gray16 := image.NewGray16(rect)
+	cmyk := image.NewCMYK(rect)
+	paletted := image.NewPaletted(rect, append(color.Palette{color.NRGBA{200, 100, 50, 128}, color.Transparent}, palette.WebSafe...))
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			nrgba.SetNRGBA(x, y, color.NRGBA{u8(), u8(), u8(), u8()})
+			a := u8()
+			rgba.SetRGBA(x, y, color.RGBA{u8() / 2 * a / 255, u8() * a / 255, a / 3, a})
+			nrgba64.SetNRGBA64(x, y, color.NRGBA64{u16(), u16(), u16(), u16()})
+			a16 := u16()
+			rgba64.SetRGBA64(x, y, color.RGBA64{uint16(uint32(u16()) * uint32(a16) / 65535), a16 / 2, 0, a16})
+			gray.SetGray(x, y, color.Gray{u8()})
+			gray16.SetGray16(x, y, color.Gray16{u16()})
+			cmyk.SetCMYK(x, y, color.CMYK{u8(), u8(), u8(), u8()})
+			paletted.SetColorIndex(x, y, uint8(rng.Intn(len(paletted.Palette))))
+		}
+	}
+	images["NRGBA"] = nrgba
+	images["RGBA"] = rgba
+	images["NRGBA64"] = nrgba64
+	images["RGBA64"] = rgba64
+	images["Gray"] = gray
+	images["Gray16"] = gray16
+	images["CMYK"] = cmyk
+	images["Paletted"] = paletted
+	ycbcr := image.NewYCbCr(rect, image.YCbCrSubsampleRatio420)
+	rng.Read(ycbcr.Y)
+	rng.Read(ycbcr.Cb)
+	rng.Read(ycbcr.Cr)
+	images["YCbCr"] = ycbcr
+
+	for name, img := range images {
+		t.Run(name, func(t *testing.T) {
+			fast, generic := newRGBBuffer(img), newRGBBuffer(opaqueImage{img})
+			for i := range generic.pix {
+				// Transparent pixels carry no color
+				if generic.alpha[i/3] == 0 {
+					continue
+				}
+				// The generic path goes through 16-bit premultiplied values
+				if math.Abs(float64(fast.pix[i]-generic.pix[i])) > 1.0/255 {
+					t.Fatalf("pix[%d] = %v, generic path gives %v", i, fast.pix[i], generic.pix[i])
+				}
+			}
+			for i := range generic.alpha {
+				if fast.alpha[i] != generic.alpha[i] {
+					t.Fatalf("alpha[%d] = %v, generic path gives %v", i, fast.alpha[i], generic.alpha[i])
+				}
+			}
+		})
+	}
+}
+
+// benchmarkImage is a 12 MP frame as the JPEG decoder returns it
+func benchmarkImage() *image.YCbCr {
+	img := image.NewYCbCr(image.Rect(0, 0, 4000, 3000), image.YCbCrSubsampleRatio420)
+	rng := rand.New(rand.NewSource(1))
+	rng.Read(img.Y)
+	rng.Read(img.Cb)
+	rng.Read(img.Cr)
+	return img
+}
+
+// benchmarkConfig is a typical preset: CSS adjustments plus a few per-pixel
+// effects. It only builds per-pixel stages, which renderAtSet relies on.
+var benchmarkConfig = models.FilterConfig{
+	Brightness: floatPtr(1.1),
+	Contrast:   floatPtr(1.2),
+	Saturation: floatPtr(1.3),
+	Effects: []models.Effect{
+		{Type: "warm_filter", Params: map[string]interface{}{"temperature": 4500}},
+		{Type: "vignette", Params: map[string]interface{}{"intensity": 0.4}},
+		{Type: "film_grain", Params: map[string]interface{}{"amount": 0.2}},
+	},
+}
+
+// renderAtSet runs each per-pixel stage as its own serial pass through the
+// image.Image interface, the way effects were applied before the buffer
+// pipeline
+func renderAtSet(img image.Image, stages []pipelineStage) image.Image {
+	bounds := img.Bounds()
+	for _, stage := range stages {
+		out := image.NewNRGBA(bounds)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+				px := [4]float32{float32(c.R) / 255, float32(c.G) / 255, float32(c.B) / 255, float32(c.A) / 255}
+				stage.pixel(x-bounds.Min.X, y-bounds.Min.Y, &px)
+				out.Set(x, y, color.NRGBA{toByte(px[0]), toByte(px[1]), toByte(px[2]), toByte(px[3])})
+			}
+		}
+		img = out
+	}
+	return img
+}
+
+func BenchmarkRenderAtSet(b *testing.B) {
+	img := benchmarkImage()
+	stages := buildPipeline(benchmarkConfig, img.Rect.Dx(), img.Rect.Dy(), &renderAssets{})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		renderAtSet(img, stages)
+	}
+}
+
+func BenchmarkRenderPipeline(b *testing.B) {
+	img := benchmarkImage()
+	stages := buildPipeline(benchmarkConfig, img.Rect.Dx(), img.Rect.Dy(), &renderAssets{})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := runPipeline(b.Context(), img, stages); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkNewRGBBuffer compares the typed readers with the At() fallback
+func BenchmarkNewRGBBuffer(b *testing.B) {
+	ycbcr := benchmarkImage()
+	rotated := applyOrientation(ycbcr, orientationRotate90)
+	for _, bench := range []struct {
+		name string
+		img  image.Image
+	}{
+		{"YCbCr", ycbcr},
+		{"YCbCrGeneric", opaqueImage{ycbcr}},
+		{"RGBA64", rotated},
+		{"RGBA64Generic", opaqueImage{rotated}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				newRGBBuffer(bench.img)
+			}
+		})
+	}
+}
+
+func BenchmarkParallelFor(b *testing.B) {
+	img := benchmarkImage()
+	buf := newRGBBuffer(img)
+	op := func(x, y int, px *[4]float32) {
+		px[0], px[1], px[2] = px[2], px[0], px[1]
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.applyPixels([]pixelFunc{op})
+	}
+}
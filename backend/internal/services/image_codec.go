@@ -0,0 +1,529 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mediaVault-backend/internal/models"
+
+	// Register additional decoders with image.Decode
+	_ "image/gif"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	defaultJPEGQuality = 90
+	defaultWebPQuality = 82
+	defaultAVIFQuality = 60
+	defaultEffort      = 5
+
+	imageToolTimeout = 2 * time.Minute
+)
+
+// EncoderInfo describes an output encoder available in this build
+type EncoderInfo struct {
+	Format   string `json:"format"`
+	MimeType string `json:"mimeType"`
+	Lossy    bool   `json:"lossy"`
+	Lossless bool   `json:"lossless"`
+	Alpha    bool   `json:"alpha"`
+	Backend  string `json:"backend"` // "native" or the external tool used
+}
+
+// imageEncoder writes img to w; icc is an ICC profile to embed, or nil.
+// Encoders backed by an external tool stop when ctx is done.
+type imageEncoder struct {
+	info   EncoderInfo
+	encode func(ctx context.Context, w io.Writer, img image.Image, opts models.OutputOptions, icc []byte) error
+}
+
+// decodedImage is a decoded original together with its embedded color profile
+type decodedImage struct {
+	Image       image.Image
+	Format      string
+	Profile     *colorProfile // nil for untagged images, which are treated as sRGB
+	Orientation int           // EXIF orientation that was applied to make Image upright
+}
+
+var (
+	encodersOnce sync.Once
+	encoders     map[string]*imageEncoder
+)
+
+// loadEncoders builds the encoder registry. JPEG and PNG are always present;
+// WebP and AVIF depend on cwebp and avifenc being installed on the host.
+func loadEncoders() map[string]*imageEncoder {
+	encodersOnce.Do(func() {
+		encoders = map[string]*imageEncoder{
+			"jpeg": {
+				info:   EncoderInfo{Format: "jpeg", MimeType: "image/jpeg", Lossy: true, Backend: "native"},
+				encode: encodeJPEG,
+			},
+			"png": {
+				info:   EncoderInfo{Format: "png", MimeType: "image/png", Lossless: true, Alpha: true, Backend: "native"},
+				encode: encodePNG,
+			},
+		}
+
+		if path, ok := lookupImageTool("cwebp", "CWEBP_PATH"); ok {
+			encoders["webp"] = &imageEncoder{
+				info: EncoderInfo{Format: "webp", MimeType: "image/webp", Lossy: true, Lossless: true, Alpha: true, Backend: "cwebp"},
+				encode: func(ctx context.Context, w io.Writer, img image.Image, opts models.OutputOptions, icc []byte) error {
+					return encodeWebP(ctx, path, w, img, opts, icc)
+				},
+			}
+		}
+
+		if path, ok := lookupImageTool("avifenc", "AVIFENC_PATH"); ok {
+			encoders["avif"] = &imageEncoder{
+				info: EncoderInfo{Format: "avif", MimeType: "image/avif", Lossy: true, Lossless: true, Alpha: true, Backend: "avifenc"},
+				encode: func(ctx context.Context, w io.Writer, img image.Image, opts models.OutputOptions, icc []byte) error {
+					return encodeAVIF(ctx, path, w, img, opts, icc)
+				},
+			}
+		}
+	})
+
+	return encoders
+}
+
+// AvailableEncoders lists the output formats this server can produce
+func AvailableEncoders() []EncoderInfo {
+	list := make([]EncoderInfo, 0, len(loadEncoders()))
+	for _, enc := range loadEncoders() {
+		list = append(list, enc.info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Format < list[j].Format
+	})
+	return list
+}
+
+// IsEncoderAvailable reports whether the given output format can be encoded
+func IsEncoderAvailable(format string) bool {
+	_, ok := loadEncoders()[normalizeFormat(format)]
+	return ok
+}
+
+// NegotiateImageFormat picks the best available output format from an HTTP
+// Accept header. Modern formats are preferred over JPEG/PNG at equal q-values.
+// It returns "" when the client expressed no specific image preference.
+func NegotiateImageFormat(accept string) string {
+	preference := map[string]int{"avif": 4, "webp": 3, "png": 2, "jpeg": 1}
+
+	best := ""
+	bestQ := 0.0
+	for _, r := range parseAccept(accept) {
+		mediaType, q := r.mediaType, r.q
+		if !strings.HasPrefix(mediaType, "image/") || mediaType == "image/*" {
+			continue
+		}
+
+		format := normalizeFormat(strings.TrimPrefix(mediaType, "image/"))
+		if q <= 0 || !IsEncoderAvailable(format) {
+			continue
+		}
+
+		if q > bestQ || (q == bestQ && preference[format] > preference[best]) {
+			best = format
+			bestQ = q
+		}
+	}
+
+	return best
+}
+
+// PrefersImageResponse reports whether an Accept header asks for image
+// bytes rather than JSON: some image type must rank above application/json.
+// Wildcards like */* keep the JSON response older clients expect.
+func PrefersImageResponse(accept string) bool {
+	imageQ, jsonQ := 0.0, 0.0
+	for _, r := range parseAccept(accept) {
+		switch {
+		case strings.HasPrefix(r.mediaType, "image/"):
+			imageQ = max(imageQ, r.q)
+		case r.mediaType == "application/json":
+			jsonQ = max(jsonQ, r.q)
+		}
+	}
+	return imageQ > jsonQ
+}
+
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// parseAccept splits an Accept header into lowercased media ranges with
+// their q-values
+func parseAccept(accept string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		r := acceptRange{mediaType: strings.ToLower(strings.TrimSpace(fields[0])), q: 1}
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					r.q = v
+				}
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
+
+// ValidateOutputOptions checks encoder options before any work is done
+func ValidateOutputOptions(opts models.OutputOptions) error {
+	if opts.Format != "" && !IsEncoderAvailable(opts.Format) {
+		return fmt.Errorf("output format %q is not available", opts.Format)
+	}
+	if opts.Quality != nil && (*opts.Quality < 1 || *opts.Quality > 100) {
+		return fmt.Errorf("quality must be between 1 and 100")
+	}
+	if opts.Effort != nil && (*opts.Effort < 0 || *opts.Effort > 10) {
+		return fmt.Errorf("effort must be between 0 and 10")
+	}
+	if opts.AlphaQuality != nil && (*opts.AlphaQuality < 0 || *opts.AlphaQuality > 100) {
+		return fmt.Errorf("alphaQuality must be between 0 and 100")
+	}
+	switch opts.ColorSpace {
+	case "", models.OutputColorSpaceSource, models.OutputColorSpaceSRGB:
+	default:
+		return fmt.Errorf("colorSpace must be %q or %q", models.OutputColorSpaceSource, models.OutputColorSpaceSRGB)
+	}
+	return nil
+}
+
+// encodeImage encodes img using the requested options. When no format is
+// requested the source format is kept if it can be encoded; otherwise PNG is
+// used for images with transparency and JPEG for everything else. A non-nil
+// icc profile is embedded in the output.
+func encodeImage(ctx context.Context, img image.Image, sourceFormat string, opts models.OutputOptions, icc []byte) ([]byte, string, error) {
+	format := normalizeFormat(opts.Format)
+	if format == "" {
+		format = normalizeFormat(sourceFormat)
+	}
+
+	enc, ok := loadEncoders()[format]
+	if !ok {
+		if opts.Format != "" {
+			return nil, "", fmt.Errorf("output format %q is not available", opts.Format)
+		}
+		if hasTransparency(img) {
+			enc = loadEncoders()["png"]
+		} else {
+			enc = loadEncoders()["jpeg"]
+		}
+	}
+
+	if enc.info.Format == "jpeg" || (opts.StripAlpha != nil && *opts.StripAlpha) {
+		img = flattenAlpha(img)
+	}
+
+	var buf bytes.Buffer
+	if err := enc.encode(ctx, &buf, img, opts, icc); err != nil {
+		return nil, "", fmt.Errorf("failed to encode %s: %w", enc.info.Format, err)
+	}
+
+	return buf.Bytes(), enc.info.Format, nil
+}
+
+// decodeImage decodes an original of any supported format. Formats the
+// standard decoders can't handle (HEIC/HEIF and camera RAW) go through the
+// external converters; formatHint is the recorded original format, which is
+// needed to tell RAW files apart from plain TIFFs.
+//
+// The result is always upright: a non-zero orientation (e.g. one recorded on
+// the media after a metadata-only rotation) is applied instead of the one the
+// file itself carries.
+func decodeImage(ctx context.Context, data []byte, formatHint string, orientation int) (*decodedImage, error) {
+	format := detectImageFormat(data, "")
+	if hint := normalizeFormat(formatHint); hint != "" && (format == "" || format == "tiff") {
+		format = hint
+	}
+
+	var decoded *decodedImage
+	switch {
+	case isHEIFFormat(format):
+		img, err := decodeHEIF(ctx, data, format)
+		if err != nil {
+			return nil, err
+		}
+		decoded = img
+	case isRawFormat(format):
+		img, err := decodeRaw(ctx, data, format)
+		if err != nil {
+			return nil, err
+		}
+		decoded = img
+	default:
+		img, decodedFormat, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode image: %w", err)
+		}
+		decoded = &decodedImage{
+			Image:       img,
+			Format:      decodedFormat,
+			Profile:     profileFromData(data),
+			Orientation: readEXIFOrientation(data),
+		}
+	}
+
+	if validOrientation(orientation) {
+		decoded.Orientation = orientation
+	}
+	if !validOrientation(decoded.Orientation) {
+		decoded.Orientation = orientationNormal
+	}
+	decoded.Image = applyOrientation(decoded.Image, decoded.Orientation)
+	return decoded, nil
+}
+
+// profileFromData parses the embedded ICC profile, ignoring malformed ones
+func profileFromData(data []byte) *colorProfile {
+	icc := extractICCProfile(data)
+	if icc == nil {
+		return nil
+	}
+	profile, err := parseICCProfile(icc)
+	if err != nil {
+		return nil
+	}
+	return profile
+}
+
+// MimeTypeForFormat returns the content type for an encoder format name
+func MimeTypeForFormat(format string) string {
+	if enc, ok := loadEncoders()[normalizeFormat(format)]; ok {
+		return enc.info.MimeType
+	}
+	return "image/" + normalizeFormat(format)
+}
+
+func encodeJPEG(_ context.Context, w io.Writer, img image.Image, opts models.OutputOptions, icc []byte) error {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: intOr(opts.Quality, defaultJPEGQuality)}); err != nil {
+		return err
+	}
+	_, err := w.Write(embedICCProfile(buf.Bytes(), "jpeg", icc))
+	return err
+}
+
+func encodePNG(_ context.Context, w io.Writer, img image.Image, opts models.OutputOptions, icc []byte) error {
+	encoder := png.Encoder{CompressionLevel: png.DefaultCompression}
+	switch effort := intOr(opts.Effort, defaultEffort); {
+	case effort <= 2:
+		encoder.CompressionLevel = png.BestSpeed
+	case effort >= 8:
+		encoder.CompressionLevel = png.BestCompression
+	}
+
+	var buf bytes.Buffer
+	if err := encoder.Encode(&buf, img); err != nil {
+		return err
+	}
+	_, err := w.Write(embedICCProfile(buf.Bytes(), "png", icc))
+	return err
+}
+
+func encodeWebP(ctx context.Context, tool string, w io.Writer, img image.Image, opts models.OutputOptions, icc []byte) error {
+	effort := intOr(opts.Effort, defaultEffort)
+	args := []string{"-quiet", "-m", strconv.Itoa(int(math.Round(float64(effort) * 6 / 10)))}
+
+	if opts.Lossless {
+		args = append(args, "-lossless", "-exact")
+	} else {
+		args = append(args, "-q", strconv.Itoa(intOr(opts.Quality, defaultWebPQuality)))
+	}
+	if opts.AlphaQuality != nil {
+		args = append(args, "-alpha_q", strconv.Itoa(*opts.AlphaQuality))
+	}
+	if opts.StripAlpha != nil && *opts.StripAlpha {
+		args = append(args, "-noalpha")
+	}
+	if icc != nil {
+		args = append(args, "-metadata", "icc")
+	}
+
+	return encodeWithTool(ctx, tool, w, img, icc, func(in, out string) []string {
+		return append(args, in, "-o", out)
+	}, ".webp")
+}
+
+func encodeAVIF(ctx context.Context, tool string, w io.Writer, img image.Image, opts models.OutputOptions, icc []byte) error {
+	effort := intOr(opts.Effort, defaultEffort)
+	args := []string{"--speed", strconv.Itoa(10 - effort)}
+
+	if opts.Lossless {
+		args = append(args, "--lossless")
+	} else {
+		args = append(args, "--qcolor", strconv.Itoa(intOr(opts.Quality, defaultAVIFQuality)))
+		if opts.AlphaQuality != nil {
+			args = append(args, "--qalpha", strconv.Itoa(*opts.AlphaQuality))
+		}
+	}
+
+	// avifenc picks up the ICC profile from the PNG input
+	return encodeWithTool(ctx, tool, w, img, icc, func(in, out string) []string {
+		return append(args, in, out)
+	}, ".avif")
+}
+
+// encodeWithTool writes img as a PNG (carrying icc, if any) to a scratch
+// directory, runs an external encoder over it and copies the result to w.
+func encodeWithTool(ctx context.Context, tool string, w io.Writer, img image.Image, icc []byte, buildArgs func(in, out string) []string, ext string) error {
+	var input bytes.Buffer
+	if err := (&png.Encoder{CompressionLevel: png.BestSpeed}).Encode(&input, img); err != nil {
+		return fmt.Errorf("failed to write scratch image: %w", err)
+	}
+
+	result, err := convertWithTool(ctx, tool, embedICCProfile(input.Bytes(), "png", icc), ".png", ext, buildArgs)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(result)
+	return err
+}
+
+// convertWithTool runs a file-based external converter: data is written to a
+// scratch input file and the tool's output file is read back.
+func convertWithTool(ctx context.Context, tool string, data []byte, inExt, outExt string, buildArgs func(in, out string) []string) ([]byte, error) {
+	return withScratchInput(data, inExt, func(dir, in string) ([]byte, error) {
+		out := filepath.Join(dir, "output"+outExt)
+		if _, err := runImageTool(ctx, tool, buildArgs(in, out), nil); err != nil {
+			return nil, err
+		}
+
+		result, err := os.ReadFile(out)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s output: %w", filepath.Base(tool), err)
+		}
+		return result, nil
+	})
+}
+
+// withScratchInput writes data to a file in a temporary directory for tools
+// that can't read from stdin; the directory is removed when fn returns.
+func withScratchInput(data []byte, ext string, fn func(dir, in string) ([]byte, error)) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "mediavault-convert-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scratch directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	in := filepath.Join(dir, "input"+ext)
+	if err := os.WriteFile(in, data, 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write scratch file: %w", err)
+	}
+
+	return fn(dir, in)
+}
+
+// runImageTool executes an external image tool and returns its stdout
+func runImageTool(ctx context.Context, tool string, args []string, stdin []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, imageToolTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, tool, args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s failed: %w: %s", filepath.Base(tool), err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// lookupImageTool resolves an external tool, honoring an optional env override
+func lookupImageTool(name, envVar string) (string, bool) {
+	if override := os.Getenv(envVar); override != "" {
+		name = override
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+func normalizeFormat(format string) string {
+	format = strings.ToLower(strings.TrimSpace(format))
+	switch format {
+	case "jpg":
+		return "jpeg"
+	default:
+		return format
+	}
+}
+
+func hasTransparency(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return !o.Opaque()
+	}
+
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// flattenAlpha composites img over white so formats without an alpha channel
+// don't turn transparent areas black
+func flattenAlpha(img image.Image) image.Image {
+	if !hasTransparency(img) {
+		return img
+	}
+
+	bounds := img.Bounds()
+	flat := image.NewRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			bg := 0xffff - a
+			i := flat.PixOffset(x, y)
+			flat.Pix[i] = uint8((r + bg) >> 8)
+			flat.Pix[i+1] = uint8((g + bg) >> 8)
+			flat.Pix[i+2] = uint8((b + bg) >> 8)
+			flat.Pix[i+3] = 0xff
+		}
+	}
+	return flat
+}
+
+func intOr(v *int, fallback int) int {
+	if v != nil {
+		return *v
+	}
+	return fallback
+}
@@ -0,0 +1,536 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"log"
+	"mime/multipart"
+	"path/filepath"
+	"strings"
+
+	"mediaVault-backend/internal/models"
+)
+
+// rawFormats maps camera RAW formats to their conventional MIME types
+var rawFormats = map[string]string{
+	"cr2": "image/x-canon-cr2",
+	"cr3": "image/x-canon-cr3",
+	"nef": "image/x-nikon-nef",
+	"arw": "image/x-sony-arw",
+	"dng": "image/x-adobe-dng",
+	"orf": "image/x-olympus-orf",
+	"rw2": "image/x-panasonic-rw2",
+	"raf": "image/x-fuji-raf",
+	"pef": "image/x-pentax-pef",
+	"srw": "image/x-samsung-srw",
+}
+
+var formatMimeTypes = map[string]string{
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+	"gif":  "image/gif",
+	"webp": "image/webp",
+	"bmp":  "image/bmp",
+	"tiff": "image/tiff",
+	"heic": "image/heic",
+	"heif": "image/heif",
+	"avif": "image/avif",
+	"svg":  "image/svg+xml",
+}
+
+type ImageIngestService struct {
+	minioSvc *MinioService
+}
+
+func NewImageIngestService(minioSvc *MinioService) *ImageIngestService {
+	return &ImageIngestService{
+		minioSvc: minioSvc,
+	}
+}
+
+// ProcessUpload inspects a freshly uploaded original, records its real format
+// and generates any derived variants needed to display and process it. The
+// original object in the bucket is never modified.
+func (s *ImageIngestService) ProcessUpload(ctx context.Context, media *models.MediaFile, file *multipart.FileHeader) error {
+	src, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open upload: %w", err)
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return fmt.Errorf("failed to read upload: %w", err)
+	}
+
+	format := detectImageFormat(data, media.OriginalName)
+	if format == "" {
+		return nil
+	}
+
+	media.OriginalFormat = format
+	if mimeType := mimeTypeForImageFormat(format); mimeType != "" {
+		media.MimeType = mimeType
+	}
+	if format == "svg" {
+		raster, err := s.rasterize(ctx, media, data)
+		if err != nil {
+			log.Printf("Failed to rasterize %s: %v", media.FileName, err)
+			return nil
+		}
+		media.SetVariant(models.VariantRaster, *raster)
+		return nil
+	}
+
+	media.ColorSpace = colorSpaceOf(profileFromData(data))
+	media.Orientation = readEXIFOrientation(data)
+	if !needsDeveloping(format) {
+		return nil
+	}
+
+	developed, err := s.develop(ctx, media, data, 0)
+	if err != nil {
+		// The original is still stored; it just can't be previewed or filtered
+		log.Printf("Failed to develop %s (%s): %v", media.FileName, format, err)
+		return nil
+	}
+
+	media.SetVariant(models.VariantDeveloped, *developed)
+	return nil
+}
+
+// IsImageUpload reports whether an upload should be treated as an image,
+// including RAW files that browsers send as application/octet-stream
+func IsImageUpload(contentType, fileName string) bool {
+	if strings.HasPrefix(contentType, "image/") {
+		return true
+	}
+	return isRawFormat(strings.TrimPrefix(strings.ToLower(filepath.Ext(fileName)), "."))
+}
+
+// DevelopImage converts HEIC/HEIF, RAW, TIFF and SVG data to a format the rest
+// of the pipeline (and third-party APIs) can read, and bakes EXIF orientation
+// into the pixels. Other images are returned as-is.
+func (s *ImageIngestService) DevelopImage(ctx context.Context, data []byte, fileName string) ([]byte, string, error) {
+	format := detectImageFormat(data, fileName)
+	if format == "svg" {
+		sanitized, err := SanitizeSVG(data)
+		if err != nil {
+			return nil, "", err
+		}
+		img, err := rasterizeSVG(ctx, sanitized)
+		if err != nil {
+			return nil, "", err
+		}
+		encoded, _, err := encodeImage(ctx, img, "png", models.OutputOptions{Format: "png"}, nil)
+		return encoded, "image/png", err
+	}
+	if !needsDeveloping(format) && readEXIFOrientation(data) <= orientationNormal {
+		return data, mimeTypeForImageFormat(format), nil
+	}
+
+	decoded, err := decodeImage(ctx, data, format, 0)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Third-party consumers mostly assume sRGB, so convert rather than tag
+	img := decoded.Image
+	if decoded.Profile.needsConversion() {
+		img = newColorTransform(decoded.Profile, srgbProfile).apply(img)
+	}
+
+	encoded, outputFormat, err := encodeImage(ctx, img, "", developedOutputOptions(img), nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return encoded, MimeTypeForFormat(outputFormat), nil
+}
+
+// develop stores an upright, browser-readable rendition of the original.
+// A zero orientation uses the one the decoder finds and records it on media.
+func (s *ImageIngestService) develop(ctx context.Context, media *models.MediaFile, data []byte, orientation int) (*models.MediaVariant, error) {
+	decoded, err := decodeImage(ctx, data, media.OriginalFormat, orientation)
+	if err != nil {
+		return nil, err
+	}
+	media.ColorSpace = colorSpaceOf(decoded.Profile)
+	media.Orientation = decoded.Orientation
+
+	// The derivative keeps the source color space; browsers honor the profile
+	var icc []byte
+	if decoded.Profile != nil {
+		icc = decoded.Profile.Data
+	}
+
+	img := decoded.Image
+	encoded, outputFormat, err := encodeImage(ctx, img, "", developedOutputOptions(img), icc)
+	if err != nil {
+		return nil, err
+	}
+
+	return storeVariant(s.minioSvc, media, models.VariantDeveloped, img.Bounds(), encoded, outputFormat)
+}
+
+// rasterize renders an SVG preview. The markup is sanitized again first so a
+// caller that skipped sanitization can't feed scripts to the renderer.
+func (s *ImageIngestService) rasterize(ctx context.Context, media *models.MediaFile, data []byte) (*models.MediaVariant, error) {
+	sanitized, err := SanitizeSVG(data)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := rasterizeSVG(ctx, sanitized)
+	if err != nil {
+		return nil, err
+	}
+	img = applyOrientation(img, media.Orientation)
+
+	encoded, outputFormat, err := encodeImage(ctx, img, "png", models.OutputOptions{Format: "png"}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return storeVariant(s.minioSvc, media, models.VariantRaster, img.Bounds(), encoded, outputFormat)
+}
+
+// RotateMedia turns media clockwise by a multiple of 90 degrees and returns
+// the mode that was used. Lossless rotation rewrites JPEG originals with
+// jpegtran; metadata rotation records the new orientation on media and
+// regenerates its derived variants upright. The caller persists media.
+func (s *ImageIngestService) RotateMedia(ctx context.Context, media *models.MediaFile, degrees int, mode string) (string, error) {
+	if degrees%90 != 0 || degrees%360 == 0 {
+		return "", fmt.Errorf("degrees must be a non-zero multiple of 90")
+	}
+	switch mode {
+	case "":
+		mode = models.RotateModeAuto
+	case models.RotateModeAuto, models.RotateModeLossless, models.RotateModeMetadata:
+	default:
+		return "", fmt.Errorf("mode must be one of auto, lossless or metadata")
+	}
+
+	reader, err := s.minioSvc.GetFileContent(media.FileName)
+	if err != nil {
+		return "", err
+	}
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to read original: %w", err)
+	}
+
+	current := media.Orientation
+	if !validOrientation(current) {
+		current = readEXIFOrientation(data)
+	}
+	orientation := rotateOrientation(current, degrees)
+
+	if mode != models.RotateModeMetadata {
+		rotated, err := rotateJPEGLossless(ctx, data, media.OriginalFormat, orientation)
+		if err == nil {
+			if err := s.minioSvc.UploadBytes(media.FileName, rotated, media.MimeType); err != nil {
+				return "", err
+			}
+			media.Size = int64(len(rotated))
+			media.Orientation = orientationNormal
+			return models.RotateModeLossless, s.regenerateVariants(ctx, media, rotated)
+		}
+		if mode == models.RotateModeLossless {
+			return "", err
+		}
+		log.Printf("Lossless rotation of %s unavailable, recording orientation instead: %v", media.FileName, err)
+	}
+
+	media.Orientation = orientation
+	return models.RotateModeMetadata, s.regenerateVariants(ctx, media, data)
+}
+
+// regenerateVariants replaces the derived variants after the original or its
+// orientation changed. Anything that can't be rebuilt is dropped, since it
+// would no longer match the original.
+func (s *ImageIngestService) regenerateVariants(ctx context.Context, media *models.MediaFile, data []byte) error {
+	stale := media.VariantFileNames()
+	media.Variants = nil
+	media.ContentVersion++
+
+	var variant *models.MediaVariant
+	var err error
+	switch {
+	case media.IsSVG():
+		if variant, err = s.rasterize(ctx, media, data); err == nil {
+			media.SetVariant(models.VariantRaster, *variant)
+		}
+	case needsDeveloping(media.OriginalFormat) || media.Orientation > orientationNormal:
+		// Browsers only honor orientation written in the file, so a recorded
+		// rotation needs an upright rendition to display
+		if variant, err = s.develop(ctx, media, data, media.Orientation); err == nil {
+			media.SetVariant(models.VariantDeveloped, *variant)
+		}
+	}
+
+	current := make(map[string]bool)
+	for _, name := range media.VariantFileNames() {
+		current[name] = true
+	}
+	for _, name := range stale {
+		if !current[name] {
+			_ = s.minioSvc.DeleteFile(name)
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to regenerate variants: %w", err)
+	}
+	return nil
+}
+
+// rotateJPEGLossless transforms JPEG data with jpegtran so it displays with
+// the given orientation and resets the EXIF tag to match
+func rotateJPEGLossless(ctx context.Context, data []byte, format string, orientation int) ([]byte, error) {
+	if format != "jpeg" {
+		return nil, fmt.Errorf("lossless rotation is only supported for JPEG")
+	}
+	tool, ok := lookupImageTool("jpegtran", "JPEGTRAN_PATH")
+	if !ok {
+		return nil, fmt.Errorf("lossless rotation requires jpegtran to be installed")
+	}
+
+	rotated := append([]byte(nil), data...)
+	if transform, ok := jpegtranOrientationArgs[orientation]; ok {
+		// -perfect refuses transforms that would have to drop partial edge blocks
+		args := append([]string{"-copy", "all", "-perfect"}, transform...)
+		output, err := runImageTool(ctx, tool, args, data)
+		if err != nil {
+			return nil, err
+		}
+		rotated = output
+	}
+
+	resetEXIFOrientation(rotated)
+	return rotated, nil
+}
+
+// storeVariant uploads a derived rendition next to the original
+func storeVariant(minioSvc *MinioService, media *models.MediaFile, name string, bounds image.Rectangle, data []byte, format string) (*models.MediaVariant, error) {
+	base := strings.TrimSuffix(media.FileName, filepath.Ext(media.FileName))
+	fileName := fmt.Sprintf("variants/%s/%s.%s", base, name, format)
+	mimeType := MimeTypeForFormat(format)
+
+	if err := minioSvc.UploadBytes(fileName, data, mimeType); err != nil {
+		return nil, err
+	}
+
+	return &models.MediaVariant{
+		FileName: fileName,
+		MimeType: mimeType,
+		Width:    bounds.Dx(),
+		Height:   bounds.Dy(),
+		Size:     int64(len(data)),
+	}, nil
+}
+
+// developedOutputOptions picks a full-resolution display format: JPEG for
+// opaque images, WebP (or PNG without cwebp) when there is transparency
+func developedOutputOptions(img image.Image) models.OutputOptions {
+	quality := 92
+	opts := models.OutputOptions{Format: "jpeg", Quality: &quality}
+	if hasTransparency(img) {
+		opts.Format = "png"
+		if IsEncoderAvailable("webp") {
+			opts.Format = "webp"
+		}
+	}
+	return opts
+}
+
+// detectImageFormat sniffs the container format from magic bytes, using the
+// file extension to tell TIFF-based RAW formats apart
+func detectImageFormat(data []byte, fileName string) string {
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(fileName)), ".")
+
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return "jpeg"
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return "png"
+	case bytes.HasPrefix(data, []byte("GIF8")):
+		return "gif"
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return "webp"
+	case bytes.HasPrefix(data, []byte("BM")):
+		return "bmp"
+	case bytes.HasPrefix(data, []byte("FUJIFILMCCD-RAW")):
+		return "raf"
+	case bytes.HasPrefix(data, []byte("IIU\x00")):
+		return "rw2"
+	case bytes.HasPrefix(data, []byte("IIRO")), bytes.HasPrefix(data, []byte("IIRS")):
+		return "orf"
+	case bytes.HasPrefix(data, []byte("II*\x00")), bytes.HasPrefix(data, []byte("MM\x00*")):
+		if _, ok := rawFormats[ext]; ok {
+			return ext
+		}
+		if len(data) >= 10 && string(data[8:10]) == "CR" {
+			return "cr2"
+		}
+		return "tiff"
+	case len(data) >= 12 && string(data[4:8]) == "ftyp":
+		return detectISOBMFFBrand(data)
+	case isSVGData(data):
+		return "svg"
+	}
+
+	if _, ok := rawFormats[ext]; ok {
+		return ext
+	}
+	return ""
+}
+
+// detectISOBMFFBrand distinguishes HEIC, AVIF and CR3 from the ftyp box
+func detectISOBMFFBrand(data []byte) string {
+	brands := []string{string(data[8:12])}
+
+	boxSize := int(data[0])<<24 | int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+	if boxSize > len(data) {
+		boxSize = len(data)
+	}
+	for i := 16; i+4 <= boxSize; i += 4 {
+		brands = append(brands, string(data[i:i+4]))
+	}
+
+	for _, brand := range brands {
+		switch brand {
+		case "avif", "avis":
+			return "avif"
+		case "heic", "heix", "hevc", "hevx", "heim", "heis":
+			return "heic"
+		case "crx ":
+			return "cr3"
+		}
+	}
+	for _, brand := range brands {
+		if brand == "mif1" || brand == "msf1" {
+			return "heif"
+		}
+	}
+	return ""
+}
+
+func isSVGData(data []byte) bool {
+	head := data
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	head = bytes.ToLower(bytes.TrimSpace(head))
+	return (bytes.HasPrefix(head, []byte("<?xml")) || bytes.HasPrefix(head, []byte("<svg")) || bytes.HasPrefix(head, []byte("<!doctype svg"))) &&
+		bytes.Contains(head, []byte("<svg"))
+}
+
+func isHEIFFormat(format string) bool {
+	return format == "heic" || format == "heif"
+}
+
+func isRawFormat(format string) bool {
+	_, ok := rawFormats[format]
+	return ok
+}
+
+// needsDeveloping reports whether browsers and the standard decoders can't
+// read the format, so a developed derivative is required
+func needsDeveloping(format string) bool {
+	return isHEIFFormat(format) || isRawFormat(format) || format == "tiff"
+}
+
+func mimeTypeForImageFormat(format string) string {
+	if mimeType, ok := rawFormats[format]; ok {
+		return mimeType
+	}
+	return formatMimeTypes[format]
+}
+
+// decodeHEIF converts HEIC/HEIF through libheif's heif-convert, which carries
+// the embedded color profile over to its PNG output and applies the container's
+// rotation and mirroring itself
+func decodeHEIF(ctx context.Context, data []byte, format string) (*decodedImage, error) {
+	tool, ok := lookupImageTool("heif-convert", "HEIF_CONVERT_PATH")
+	if !ok {
+		return nil, fmt.Errorf("HEIC/HEIF decoding requires heif-convert (libheif) to be installed")
+	}
+
+	converted, err := convertWithTool(ctx, tool, data, ".heic", ".png", func(in, out string) []string {
+		return []string{in, out}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(converted))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode converted HEIF image: %w", err)
+	}
+	return &decodedImage{Image: img, Format: format, Profile: profileFromData(converted), Orientation: orientationNormal}, nil
+}
+
+// decodeRaw develops a camera RAW file with dcraw. Without dcraw it falls back
+// to the largest JPEG preview embedded in the file, which most cameras write
+// at (or close to) full resolution.
+// dcraw output is sRGB and already rotated, while embedded previews carry
+// their own profile and follow the RAW file's orientation tag.
+func decodeRaw(ctx context.Context, data []byte, format string) (*decodedImage, error) {
+	if tool, ok := lookupImageTool("dcraw", "DCRAW_PATH"); ok {
+		// -c: write to stdout, -w: camera white balance, -T: TIFF output
+		converted, err := withScratchInput(data, "."+format, func(_, in string) ([]byte, error) {
+			return runImageTool(ctx, tool, []string{"-c", "-w", "-T", in}, nil)
+		})
+		if err == nil {
+			if img, _, err := image.Decode(bytes.NewReader(converted)); err == nil {
+				return &decodedImage{Image: img, Format: format, Orientation: orientationNormal}, nil
+			}
+		} else {
+			log.Printf("dcraw failed, falling back to embedded preview: %v", err)
+		}
+	}
+
+	img, preview := largestEmbeddedJPEG(data)
+	if img == nil {
+		return nil, fmt.Errorf("no RAW decoder available for %s and no embedded preview found", format)
+	}
+	orientation := readEXIFOrientation(data)
+	if orientation == 0 {
+		orientation = readEXIFOrientation(preview)
+	}
+	return &decodedImage{Image: img, Format: format, Profile: profileFromData(preview), Orientation: orientation}, nil
+}
+
+// largestEmbeddedJPEG scans a RAW container for embedded JPEG streams and
+// returns the largest one that decodes, along with its bytes
+func largestEmbeddedJPEG(data []byte) (image.Image, []byte) {
+	var best image.Image
+	var bestData []byte
+	bestPixels := 0
+
+	for offset := 0; ; {
+		start := bytes.Index(data[offset:], []byte{0xFF, 0xD8, 0xFF})
+		if start < 0 {
+			break
+		}
+		start += offset
+
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(data[start:]))
+		if err == nil && cfg.Width*cfg.Height > bestPixels {
+			if img, err := jpeg.Decode(bytes.NewReader(data[start:])); err == nil {
+				best = img
+				bestData = data[start:]
+				bestPixels = cfg.Width * cfg.Height
+			}
+		}
+		offset = start + 3
+	}
+
+	return best, bestData
+}
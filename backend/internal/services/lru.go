@@ -0,0 +1,110 @@
+package services
+
+import (
+	"container/list"
+	"sync"
+)
+
+// lruCache is a small thread-safe cache that drops the least recently used
+// entry once it holds more than size entries, or, for caches built with
+// newSizedLRUCache, more than maxBytes in total
+type lruCache[V any] struct {
+	mu       sync.Mutex
+	size     int
+	maxBytes int64
+	bytes    int64
+	sizeOf   func(V) int64
+	onRemove func(key string) // called with the lock held
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+type lruEntry[V any] struct {
+	key   string
+	value V
+	bytes int64
+}
+
+func newLRUCache[V any](size int) *lruCache[V] {
+	return &lruCache[V]{size: size, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// newSizedLRUCache bounds the cache by the total sizeOf its values instead
+// of their count
+func newSizedLRUCache[V any](maxBytes int64, sizeOf func(V) int64) *lruCache[V] {
+	return &lruCache[V]{maxBytes: maxBytes, sizeOf: sizeOf, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (c *lruCache[V]) get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*lruEntry[V]).value, true
+}
+
+func (c *lruCache[V]) put(key string, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var bytes int64
+	if c.sizeOf != nil {
+		bytes = c.sizeOf(value)
+	}
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*lruEntry[V])
+		c.bytes += bytes - entry.bytes
+		entry.value, entry.bytes = value, bytes
+		c.order.MoveToFront(el)
+	} else {
+		c.entries[key] = c.order.PushFront(&lruEntry[V]{key: key, value: value, bytes: bytes})
+		c.bytes += bytes
+	}
+	for c.order.Len() > 0 && ((c.size > 0 && c.order.Len() > c.size) || (c.sizeOf != nil && c.bytes > c.maxBytes)) {
+		c.remove(c.order.Back())
+	}
+}
+
+// delete drops key if it's cached
+func (c *lruCache[V]) delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+}
+
+// removeIf drops every entry whose key matches
+func (c *lruCache[V]) removeIf(match func(key string) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, el := range c.entries {
+		if match(key) {
+			c.remove(el)
+		}
+	}
+}
+
+// usage returns the number of entries and their total size
+func (c *lruCache[V]) usage() (int, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len(), c.bytes
+}
+
+func (c *lruCache[V]) remove(el *list.Element) {
+	entry := el.Value.(*lruEntry[V])
+	c.order.Remove(el)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.bytes
+	if c.onRemove != nil {
+		c.onRemove(entry.key)
+	}
+}
@@ -0,0 +1,327 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Built-in looks, referenced from effects by file name without extension
+//
+//go:embed luts/*.cube
+var lutFS embed.FS
+
+const (
+	minLUTSize = 2
+	maxLUTSize = 65
+	// MaxLUTFileSize bounds uploads; a 65-point cube is about 8 MB of text
+	MaxLUTFileSize = 10 << 20
+	// lutCacheSize is how many uploaded LUTs stay parsed in memory
+	lutCacheSize = 32
+)
+
+// ErrInvalidLUT is returned for uploads that aren't a usable .cube 3D LUT
+var ErrInvalidLUT = errors.New("invalid LUT")
+
+// LUT interpolation modes
+const (
+	LUTTrilinear   = "trilinear"
+	LUTTetrahedral = "tetrahedral"
+)
+
+// lut3D is a parsed 3D lookup table. data holds size³ RGB entries with red
+// changing fastest, then green, then blue, as in the .cube format.
+type lut3D struct {
+	title     string
+	size      int
+	domainMin [3]float32
+	domainMax [3]float32
+	data      []float32
+}
+
+// parseCubeLUT reads an Adobe/Resolve .cube 3D LUT
+func parseCubeLUT(r io.Reader) (*lut3D, error) {
+	l := &lut3D{domainMax: [3]float32{1, 1, 1}}
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+
+		switch fields[0] {
+		case "TITLE":
+			l.title = strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "TITLE")), `"`)
+			continue
+		case "LUT_1D_SIZE":
+			return nil, fmt.Errorf("1D LUTs are not supported")
+		case "LUT_3D_SIZE":
+			if l.size != 0 {
+				return nil, fmt.Errorf("line %d: duplicate LUT_3D_SIZE", lineNo)
+			}
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("line %d: malformed LUT_3D_SIZE", lineNo)
+			}
+			size, err := strconv.Atoi(fields[1])
+			if err != nil || size < minLUTSize || size > maxLUTSize {
+				return nil, fmt.Errorf("line %d: LUT_3D_SIZE must be between %d and %d", lineNo, minLUTSize, maxLUTSize)
+			}
+			l.size = size
+			l.data = make([]float32, 0, size*size*size*3)
+			continue
+		case "DOMAIN_MIN", "DOMAIN_MAX":
+			v, err := parseLUTTriple(fields[1:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: malformed %s: %w", lineNo, fields[0], err)
+			}
+			if fields[0] == "DOMAIN_MIN" {
+				l.domainMin = v
+			} else {
+				l.domainMax = v
+			}
+			continue
+		case "LUT_3D_INPUT_RANGE":
+			// Resolve's single-range form of DOMAIN_MIN/DOMAIN_MAX
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("line %d: malformed LUT_3D_INPUT_RANGE", lineNo)
+			}
+			lo, errLo := strconv.ParseFloat(fields[1], 32)
+			hi, errHi := strconv.ParseFloat(fields[2], 32)
+			if errLo != nil || errHi != nil {
+				return nil, fmt.Errorf("line %d: malformed LUT_3D_INPUT_RANGE", lineNo)
+			}
+			l.domainMin = [3]float32{float32(lo), float32(lo), float32(lo)}
+			l.domainMax = [3]float32{float32(hi), float32(hi), float32(hi)}
+			continue
+		}
+
+		v, err := parseLUTTriple(fields)
+		if err != nil {
+			if len(l.data) == 0 && !isLUTNumber(fields[0]) {
+				// Unknown keyword ahead of the table, e.g. a vendor extension
+				continue
+			}
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		if l.size == 0 {
+			return nil, fmt.Errorf("line %d: table data before LUT_3D_SIZE", lineNo)
+		}
+		if len(l.data) == cap(l.data) {
+			return nil, fmt.Errorf("line %d: more than %d table entries", lineNo, l.size*l.size*l.size)
+		}
+		l.data = append(l.data, v[0], v[1], v[2])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read LUT: %w", err)
+	}
+
+	if l.size == 0 {
+		return nil, fmt.Errorf("missing LUT_3D_SIZE")
+	}
+	if want := l.size * l.size * l.size * 3; len(l.data) != want {
+		return nil, fmt.Errorf("expected %d table entries, got %d", want/3, len(l.data)/3)
+	}
+	for c := 0; c < 3; c++ {
+		if l.domainMax[c] <= l.domainMin[c] {
+			return nil, fmt.Errorf("DOMAIN_MAX must be greater than DOMAIN_MIN")
+		}
+	}
+	return l, nil
+}
+
+func parseLUTTriple(fields []string) ([3]float32, error) {
+	var v [3]float32
+	if len(fields) != 3 {
+		return v, fmt.Errorf("expected 3 values, got %d", len(fields))
+	}
+	for i, f := range fields {
+		n, err := strconv.ParseFloat(f, 32)
+		if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+			return v, fmt.Errorf("invalid value %q", f)
+		}
+		v[i] = float32(n)
+	}
+	return v, nil
+}
+
+func isLUTNumber(s string) bool {
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
+
+// lookup maps a color through the table. Inputs are scaled from the LUT
+// domain and clamped to its edges.
+func (l *lut3D) lookup(r, g, b float32, tetrahedral bool) (float32, float32, float32) {
+	n := l.size - 1
+	pos := [3]float32{r, g, b}
+	var idx [3]int
+	var frac [3]float32
+	for c := 0; c < 3; c++ {
+		p := (pos[c] - l.domainMin[c]) / (l.domainMax[c] - l.domainMin[c]) * float32(n)
+		if p <= 0 {
+			p = 0
+		} else if p >= float32(n) {
+			p = float32(n)
+		}
+		i := int(p)
+		if i == n {
+			i = n - 1
+		}
+		idx[c], frac[c] = i, p-float32(i)
+	}
+
+	// Corner offsets into data; cXYZ is the corner at +X red, +Y green, +Z blue
+	stride := [3]int{3, l.size * 3, l.size * l.size * 3}
+	base := idx[0]*stride[0] + idx[1]*stride[1] + idx[2]*stride[2]
+	corner := func(dr, dg, db int) int {
+		return base + dr*stride[0] + dg*stride[1] + db*stride[2]
+	}
+	c000, c111 := corner(0, 0, 0), corner(1, 1, 1)
+	fr, fg, fb := frac[0], frac[1], frac[2]
+	d := l.data
+
+	var out [3]float32
+	if !tetrahedral {
+		c100, c010, c001 := corner(1, 0, 0), corner(0, 1, 0), corner(0, 0, 1)
+		c110, c101, c011 := corner(1, 1, 0), corner(1, 0, 1), corner(0, 1, 1)
+		for c := 0; c < 3; c++ {
+			x00 := d[c000+c] + (d[c100+c]-d[c000+c])*fr
+			x10 := d[c010+c] + (d[c110+c]-d[c010+c])*fr
+			x01 := d[c001+c] + (d[c101+c]-d[c001+c])*fr
+			x11 := d[c011+c] + (d[c111+c]-d[c011+c])*fr
+			y0 := x00 + (x10-x00)*fg
+			y1 := x01 + (x11-x01)*fg
+			out[c] = y0 + (y1-y0)*fb
+		}
+		return out[0], out[1], out[2]
+	}
+
+	// Tetrahedral: split the cube into six tetrahedra along the diagonal and
+	// interpolate within the one containing the point, which keeps neutral
+	// tones on the gray axis
+	var w0, w1, w2, w3 float32
+	var a, b2 int
+	switch {
+	case fr > fg && fg > fb:
+		w0, w1, w2, w3 = 1-fr, fr-fg, fg-fb, fb
+		a, b2 = corner(1, 0, 0), corner(1, 1, 0)
+	case fr > fb && fb >= fg:
+		w0, w1, w2, w3 = 1-fr, fr-fb, fb-fg, fg
+		a, b2 = corner(1, 0, 0), corner(1, 0, 1)
+	case fb >= fr && fr > fg:
+		w0, w1, w2, w3 = 1-fb, fb-fr, fr-fg, fg
+		a, b2 = corner(0, 0, 1), corner(1, 0, 1)
+	case fb > fg && fg >= fr:
+		w0, w1, w2, w3 = 1-fb, fb-fg, fg-fr, fr
+		a, b2 = corner(0, 0, 1), corner(0, 1, 1)
+	case fg >= fb && fb > fr:
+		w0, w1, w2, w3 = 1-fg, fg-fb, fb-fr, fr
+		a, b2 = corner(0, 1, 0), corner(0, 1, 1)
+	default:
+		w0, w1, w2, w3 = 1-fg, fg-fr, fr-fb, fb
+		a, b2 = corner(0, 1, 0), corner(1, 1, 0)
+	}
+	for c := 0; c < 3; c++ {
+		out[c] = w0*d[c000+c] + w1*d[a+c] + w2*d[b2+c] + w3*d[c111+c]
+	}
+	return out[0], out[1], out[2]
+}
+
+// lutOp maps each pixel through l. Params: interpolation ("trilinear" or
+// "tetrahedral"), intensity (0-1) to blend with the original.
+func lutOp(l *lut3D, params map[string]interface{}) pixelFunc {
+	intensity := float32(clampParam(paramFloat(params, "intensity", 1), 0, 1))
+	if intensity == 0 {
+		return nil
+	}
+	tetrahedral := paramString(params, "interpolation", LUTTrilinear) == LUTTetrahedral
+
+	return func(x, y int, px *[4]float32) {
+		r, g, b := l.lookup(px[0], px[1], px[2], tetrahedral)
+		px[0] += (r - px[0]) * intensity
+		px[1] += (g - px[1]) * intensity
+		px[2] += (b - px[2]) * intensity
+	}
+}
+
+// validateLUTParams checks a lut effect's params without loading the table
+func validateLUTParams(params map[string]interface{}) error {
+	ref := paramString(params, "lut", "")
+	if ref == "" {
+		return fmt.Errorf("lut param is required")
+	}
+	if !isBuiltinLUT(ref) && !primitive.IsValidObjectID(ref) {
+		return fmt.Errorf("unknown LUT %q", ref)
+	}
+	switch paramString(params, "interpolation", LUTTrilinear) {
+	case LUTTrilinear, LUTTetrahedral:
+	default:
+		return fmt.Errorf("interpolation must be %q or %q", LUTTrilinear, LUTTetrahedral)
+	}
+	return nil
+}
+
+var (
+	builtinLUTMu    sync.Mutex
+	builtinLUTCache = make(map[string]*lut3D)
+)
+
+// BuiltinLUTs lists the names of the embedded LUTs
+func BuiltinLUTs() []string {
+	entries, _ := lutFS.ReadDir("luts")
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), path.Ext(e.Name())))
+	}
+	sort.Strings(names)
+	return names
+}
+
+func isBuiltinLUT(name string) bool {
+	if name == "" || strings.ContainsAny(name, "/.") {
+		return false
+	}
+	_, err := lutFS.Open("luts/" + name + ".cube")
+	return err == nil
+}
+
+// loadBuiltinLUT returns an embedded LUT by name (e.g. "teal_orange")
+func loadBuiltinLUT(name string) (*lut3D, error) {
+	builtinLUTMu.Lock()
+	defer builtinLUTMu.Unlock()
+
+	if l, ok := builtinLUTCache[name]; ok {
+		return l, nil
+	}
+	if !isBuiltinLUT(name) {
+		return nil, fmt.Errorf("unknown LUT %q", name)
+	}
+	data, err := lutFS.ReadFile("luts/" + name + ".cube")
+	if err != nil {
+		return nil, fmt.Errorf("unknown LUT %q", name)
+	}
+	l, err := parseCubeLUT(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse built-in LUT %q: %w", name, err)
+	}
+	builtinLUTCache[name] = l
+	return l, nil
+}
+
+// uploadedLUTs keeps recently used uploaded LUTs parsed, keyed by ID
+var uploadedLUTs = newLRUCache[*lut3D](lutCacheSize)
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"testing"
+)
+
+// cubeText writes a size-point .cube table from f
+func cubeText(header string, size int, f func(r, g, b float64) [3]float64) string {
+	var sb strings.Builder
+	sb.WriteString(header)
+	fmt.Fprintf(&sb, "LUT_3D_SIZE %d\n", size)
+	n := float64(size - 1)
+	for b := 0; b < size; b++ {
+		for g := 0; g < size; g++ {
+			for r := 0; r < size; r++ {
+				v := f(float64(r)/n, float64(g)/n, float64(b)/n)
+				fmt.Fprintf(&sb, "%g %g %g\n", v[0], v[1], v[2])
+			}
+		}
+	}
+	return sb.String()
+}
+
+func identityCube(r, g, b float64) [3]float64 { return [3]float64{r, g, b} }
+
+func TestParseCubeLUT(t *testing.T) {
+	identity2 := cubeText("", 2, identityCube)
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+		check   func(t *testing.T, l *lut3D)
+	}{
+		{
+			name:  "identity with header",
+			input: cubeText("# comment\nTITLE \"Neutral look\"\n\n", 3, identityCube),
+			check: func(t *testing.T, l *lut3D) {
+				if l.title != "Neutral look" || l.size != 3 || len(l.data) != 27*3 {
+					t.Errorf("title %q, size %d, %d values", l.title, l.size, len(l.data))
+				}
+				// Red changes fastest: entry 1 is r=0.5
+				if l.data[3] != 0.5 || l.data[4] != 0 || l.data[5] != 0 {
+					t.Errorf("entry 1 = %v", l.data[3:6])
+				}
+			},
+		},
+		{
+			name:  "domain",
+			input: "DOMAIN_MIN 0 0 0\nDOMAIN_MAX 2 2 4\n" + identity2,
+			check: func(t *testing.T, l *lut3D) {
+				if l.domainMax != [3]float32{2, 2, 4} {
+					t.Errorf("domainMax = %v", l.domainMax)
+				}
+			},
+		},
+		{
+			name:  "input range",
+			input: "LUT_3D_INPUT_RANGE -0.5 1.5\n" + identity2,
+			check: func(t *testing.T, l *lut3D) {
+				if l.domainMin != [3]float32{-0.5, -0.5, -0.5} || l.domainMax != [3]float32{1.5, 1.5, 1.5} {
+					t.Errorf("domain = %v..%v", l.domainMin, l.domainMax)
+				}
+			},
+		},
+		{name: "vendor keyword", input: "LUT_IN_VIDEO_RANGE\n" + identity2},
+		{name: "empty", input: "", wantErr: "missing LUT_3D_SIZE"},
+		{name: "1D", input: "LUT_1D_SIZE 4\n", wantErr: "1D LUTs are not supported"},
+		{name: "size too small", input: "LUT_3D_SIZE 1\n0 0 0\n", wantErr: "must be between"},
+		{name: "size too large", input: "LUT_3D_SIZE 66\n", wantErr: "must be between"},
+		{name: "size not a number", input: "LUT_3D_SIZE big\n", wantErr: "must be between"},
+		{name: "duplicate size", input: "LUT_3D_SIZE 2\nLUT_3D_SIZE 2\n", wantErr: "duplicate LUT_3D_SIZE"},
+		{name: "data before size", input: "0 0 0\n" + identity2, wantErr: "table data before LUT_3D_SIZE"},
+		{name: "two values", input: "LUT_3D_SIZE 2\n0 0\n", wantErr: "line 2: expected 3 values"},
+		{name: "not a number", input: "LUT_3D_SIZE 2\n0 0 x\n", wantErr: `invalid value "x"`},
+		{name: "NaN", input: "LUT_3D_SIZE 2\n0 0 NaN\n", wantErr: `invalid value "NaN"`},
+		{name: "short table", input: strings.TrimSuffix(identity2, "1 1 1\n"), wantErr: "expected 8 table entries, got 7"},
+		{name: "long table", input: identity2 + "1 1 1\n", wantErr: "more than 8 table entries"},
+		{name: "empty domain", input: "DOMAIN_MIN 1 0 0\nDOMAIN_MAX 1 1 1\n" + identity2, wantErr: "DOMAIN_MAX must be greater"},
+		{name: "malformed domain", input: "DOMAIN_MAX 1 1\n" + identity2, wantErr: "malformed DOMAIN_MAX"},
+		{name: "line too long", input: "TITLE \"" + strings.Repeat("x", 70000) + "\"\n" + identity2, wantErr: "failed to read LUT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := parseCubeLUT(strings.NewReader(tt.input))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.check != nil {
+				tt.check(t, l)
+			}
+		})
+	}
+}
+
+// Files past MaxLUTFileSize are cut off by the reader and rejected rather
+// than loaded as a partial table
+func TestParseCubeLUTOversized(t *testing.T) {
+	data := cubeText("", maxLUTSize, func(r, g, b float64) [3]float64 {
+		return [3]float64{r * 0.123456789, g * 0.123456789, b * 0.123456789}
+	})
+	data = strings.Repeat("# padding\n", 1<<17) + data
+	if len(data) <= MaxLUTFileSize {
+		t.Fatalf("test file is only %d bytes", len(data))
+	}
+
+	if _, err := parseCubeLUT(strings.NewReader(data)); err != nil {
+		t.Fatalf("untruncated file: %v", err)
+	}
+	if _, err := parseCubeLUT(io.LimitReader(strings.NewReader(data), MaxLUTFileSize)); err == nil {
+		t.Fatal("truncated file parsed")
+	}
+}
+
+func TestLUTInterpolation(t *testing.T) {
+	const tolerance = 1e-5
+	parse := func(t *testing.T, size int, f func(r, g, b float64) [3]float64) *lut3D {
+		t.Helper()
+		l, err := parseCubeLUT(strings.NewReader(cubeText("", size, f)))
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		return l
+	}
+
+	// Red output is r·g. Trilinear reproduces the product between the two
+	// corners; tetrahedral in a 2-point cube gives min(r, g).
+	product := parse(t, 2, func(r, g, b float64) [3]float64 { return [3]float64{r * g, b, 0} })
+	points := [][3]float32{
+		{0.25, 0.75, 0.5}, {0.8, 0.3, 0.1}, {0.5, 0.5, 0.5}, {0.1, 0.2, 0.9}, {1, 0.4, 0},
+	}
+	for _, p := range points {
+		tri, _, _ := product.lookup(p[0], p[1], p[2], false)
+		tet, _, _ := product.lookup(p[0], p[1], p[2], true)
+		if want := p[0] * p[1]; math.Abs(float64(tri-want)) > tolerance {
+			t.Errorf("trilinear %v = %v, want %v", p, tri, want)
+		}
+		if want := min(p[0], p[1]); math.Abs(float64(tet-want)) > tolerance {
+			t.Errorf("tetrahedral %v = %v, want %v", p, tet, want)
+		}
+	}
+
+	// Both are exact on affine tables, at any size and across the domain
+	affine := func(r, g, b float64) [3]float64 {
+		return [3]float64{0.1 + 0.5*r + 0.2*g, 0.3*g - 0.1*b, 0.9 * b}
+	}
+	for _, size := range []int{2, 5, 17} {
+		l := parse(t, size, affine)
+		for _, p := range points {
+			want := affine(float64(p[0]), float64(p[1]), float64(p[2]))
+			for _, tetrahedral := range []bool{false, true} {
+				r, g, b := l.lookup(p[0], p[1], p[2], tetrahedral)
+				got := [3]float32{r, g, b}
+				for c := range got {
+					if math.Abs(float64(got[c])-want[c]) > tolerance {
+						t.Errorf("size %d tetrahedral=%v %v = %v, want %v", size, tetrahedral, p, got, want)
+						break
+					}
+				}
+			}
+		}
+	}
+
+	// Tetrahedral keeps grays on the diagonal: a table that is neutral only
+	// along the gray axis still maps grays to grays
+	tinted := parse(t, 3, func(r, g, b float64) [3]float64 {
+		if r == g && g == b {
+			return [3]float64{r, g, b}
+		}
+		return [3]float64{1, 0, 0}
+	})
+	for _, v := range []float32{0.1, 0.3, 0.6, 0.95} {
+		r, g, b := tinted.lookup(v, v, v, true)
+		if math.Abs(float64(r-v)) > tolerance || math.Abs(float64(g-v)) > tolerance || math.Abs(float64(b-v)) > tolerance {
+			t.Errorf("tetrahedral gray %v = (%v, %v, %v)", v, r, g, b)
+		}
+		if r, g, _ := tinted.lookup(v, v, v, false); r == g {
+			t.Errorf("trilinear gray %v stayed neutral; the test table is too weak", v)
+		}
+	}
+
+	// Inputs outside the domain clamp to the edge entries
+	l := parse(t, 5, identityCube)
+	for _, tetrahedral := range []bool{false, true} {
+		if r, g, b := l.lookup(-0.5, 1.5, 0.5, tetrahedral); r != 0 || g != 1 || math.Abs(float64(b-0.5)) > tolerance {
+			t.Errorf("tetrahedral=%v clamped = (%v, %v, %v)", tetrahedral, r, g, b)
+		}
+	}
+}
+
+func TestBuiltinLUTs(t *testing.T) {
+	names := BuiltinLUTs()
+	if len(names) == 0 {
+		t.Fatal("no built-in LUTs")
+	}
+	for _, name := range names {
+		if _, err := loadBuiltinLUT(name); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "../lut", "teal_orange.cube", "missing"} {
+		if isBuiltinLUT(name) {
+			t.Errorf("isBuiltinLUT(%q) = true", name)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"mediaVault-backend/internal/models"
+)
+
+// grayMask is an uploaded mask image with values in 0..1
+type grayMask struct {
+	w, h int
+	pix  []float32
+}
+
+func newGrayMask(img *image.Gray) *grayMask {
+	m := &grayMask{w: img.Rect.Dx(), h: img.Rect.Dy()}
+	m.pix = make([]float32, m.w*m.h)
+	for y := 0; y < m.h; y++ {
+		row := img.Pix[y*img.Stride:]
+		for x := 0; x < m.w; x++ {
+			m.pix[y*m.w+x] = float32(row[x]) / 255
+		}
+	}
+	return m
+}
+
+// at samples the mask stretched to a w x h image, bilinearly
+func (m *grayMask) at(x, y, w, h int) float32 {
+	sx := math.Max(0, math.Min(float64(m.w-1), (float64(x)+0.5)*float64(m.w)/float64(w)-0.5))
+	sy := math.Max(0, math.Min(float64(m.h-1), (float64(y)+0.5)*float64(m.h)/float64(h)-0.5))
+	x0, y0 := int(sx), int(sy)
+	x1, y1 := min(x0+1, m.w-1), min(y0+1, m.h-1)
+	tx, ty := float32(sx-float64(x0)), float32(sy-float64(y0))
+
+	p := func(px, py int) float32 { return m.pix[py*m.w+px] }
+	top := p(x0, y0) + tx*(p(x1, y0)-p(x0, y0))
+	bottom := p(x0, y1) + tx*(p(x1, y1)-p(x0, y1))
+	return top + ty*(bottom-top)
+}
+
+// maskStages wraps stages so their result is blended over the unfiltered
+// buffer through mask. It returns stages unchanged when there's no mask.
+func maskStages(mask *models.MaskConfig, w, h int, assets *renderAssets, stages []pipelineStage) []pipelineStage {
+	value := maskFunc(mask, w, h, assets)
+	if value == nil || len(stages) == 0 {
+		return stages
+	}
+
+	var original *rgbBuffer
+	masked := make([]pipelineStage, 0, len(stages)+2)
+	masked = append(masked, pipelineStage{buffer: func(buf *rgbBuffer) {
+		original = buf.clone()
+	}})
+	masked = append(masked, stages...)
+	return append(masked, pipelineStage{buffer: func(buf *rgbBuffer) {
+		blendMasked(buf, original, value)
+	}})
+}
+
+// blendMasked mixes filtered towards original wherever the mask is below 1
+func blendMasked(filtered, original *rgbBuffer, value func(x, y int) float32) {
+	parallelFor(filtered.h, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			for x := 0; x < filtered.w; x++ {
+				k := clampUnit(value(x, y))
+				if k == 1 {
+					continue
+				}
+				i := y*filtered.w + x
+				for c := 0; c < 3; c++ {
+					o := original.pix[i*3+c]
+					filtered.pix[i*3+c] = o + (filtered.pix[i*3+c]-o)*k
+				}
+				oa := float32(original.alpha[i])
+				filtered.alpha[i] = toByte((oa + (float32(filtered.alpha[i])-oa)*k) / 255)
+			}
+		}
+	})
+}
+
+// maskFunc returns the mask value (0-1) at each pixel of a w x h image, or
+// nil when mask doesn't restrict anything
+func maskFunc(mask *models.MaskConfig, w, h int, assets *renderAssets) func(x, y int) float32 {
+	if mask == nil {
+		return nil
+	}
+	fw, fh := float64(w), float64(h)
+
+	var value func(px, py float64) float64
+	switch mask.Type {
+	case models.MaskRect, models.MaskEllipse:
+		r := mask.Rect
+		cx, cy := (r.X+r.Width/2)*fw, (r.Y+r.Height/2)*fh
+		hw, hh := math.Max(r.Width*fw/2, 0.5), math.Max(r.Height*fh/2, 0.5)
+		feather := clampParam(mask.Feather, 0, 1)
+		if mask.Type == models.MaskRect {
+			featherPx := feather * math.Min(hw, hh)
+			value = func(px, py float64) float64 {
+				// Distance inside the nearest edge
+				inside := math.Min(hw-math.Abs(px-cx), hh-math.Abs(py-cy))
+				if featherPx == 0 {
+					return step(inside)
+				}
+				return smoothstep64(0, featherPx, inside)
+			}
+		} else {
+			value = func(px, py float64) float64 {
+				dx, dy := (px-cx)/hw, (py-cy)/hh
+				d := math.Sqrt(dx*dx + dy*dy)
+				if feather == 0 {
+					return step(1 - d)
+				}
+				return 1 - smoothstep64(1-feather, 1, d)
+			}
+		}
+
+	case models.MaskLinear:
+		ax, ay := mask.From.X*fw, mask.From.Y*fh
+		dx, dy := mask.To.X*fw-ax, mask.To.Y*fh-ay
+		length2 := dx*dx + dy*dy
+		value = func(px, py float64) float64 {
+			// Position along From -> To
+			t := ((px-ax)*dx + (py-ay)*dy) / length2
+			return 1 - smoothstep64(0, 1, t)
+		}
+
+	case models.MaskRadial:
+		cx, cy := mask.From.X*fw, mask.From.Y*fh
+		radius := math.Hypot(mask.To.X*fw-cx, mask.To.Y*fh-cy)
+		value = func(px, py float64) float64 {
+			return 1 - smoothstep64(0, 1, math.Hypot(px-cx, py-cy)/radius)
+		}
+
+	case models.MaskImage:
+		m := assets.masks[mask.MaskID.Hex()]
+		if m == nil {
+			return nil
+		}
+		value = func(px, py float64) float64 {
+			return float64(m.at(int(px), int(py), w, h))
+		}
+
+	default:
+		return nil
+	}
+
+	invert := mask.Invert
+	return func(x, y int) float32 {
+		// Sample at the pixel center
+		v := value(float64(x)+0.5, float64(y)+0.5)
+		if invert {
+			v = 1 - v
+		}
+		return float32(v)
+	}
+}
+
+func step(v float64) float64 {
+	if v > 0 {
+		return 1
+	}
+	return 0
+}
+
+func smoothstep64(edge0, edge1, x float64) float64 {
+	t := clampParam((x-edge0)/(edge1-edge0), 0, 1)
+	return t * t * (3 - 2*t)
+}
+
+// validateMask checks a mask has what its type needs
+func validateMask(mask *models.MaskConfig) error {
+	if mask == nil {
+		return nil
+	}
+	switch mask.Type {
+	case models.MaskNone:
+	case models.MaskRect, models.MaskEllipse:
+		if mask.Rect == nil {
+			return fmt.Errorf("mask.rect is required for %s masks", mask.Type)
+		}
+		if err := validateCropRect(mask.Rect); err != nil {
+			return fmt.Errorf("mask.rect: %w", err)
+		}
+		if mask.Feather < 0 || mask.Feather > 1 {
+			return fmt.Errorf("mask.feather must be between 0 and 1")
+		}
+	case models.MaskLinear, models.MaskRadial:
+		if mask.From == nil || mask.To == nil {
+			return fmt.Errorf("mask.from and mask.to are required for %s masks", mask.Type)
+		}
+		if *mask.From == *mask.To {
+			return fmt.Errorf("mask.from and mask.to must differ")
+		}
+		for name, p := range map[string]*models.MaskPoint{"from": mask.From, "to": mask.To} {
+			// Gradients may start or end off the image, within reason
+			if math.Abs(p.X) > 10 || math.Abs(p.Y) > 10 {
+				return fmt.Errorf("mask.%s is too far outside the image", name)
+			}
+		}
+	case models.MaskImage:
+		if mask.MaskID == nil || mask.MaskID.IsZero() {
+			return fmt.Errorf("mask.maskId is required for image masks")
+		}
+	default:
+		return fmt.Errorf("unknown mask type %q", mask.Type)
+	}
+	return nil
+}
@@ -1,12 +1,15 @@
 package services
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"log"
 	"mime/multipart"
+	"net/url"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"mediaVault-backend/internal/config"
@@ -206,20 +209,64 @@ func (ms *MinioService) UploadFile(file *multipart.FileHeader, metadata models.C
 	}
 	log.Printf("MinIO upload successful for %s", fileName)
 
-	// Create MediaFile struct
-	mediaFile := &models.MediaFile{
+	return newMediaFile(fileName, file.Filename, file.Header.Get("Content-Type"), file.Size, metadata, userID), nil
+}
+
+// UploadContent stores an upload whose content was rewritten before storage
+// (e.g. sanitized SVG). SVGs are stored with an attachment disposition so the
+// public bucket never renders them inline.
+func (ms *MinioService) UploadContent(data []byte, originalName, contentType string, metadata models.CreateMediaRequest, userID primitive.ObjectID) (*models.MediaFile, error) {
+	fileName := fmt.Sprintf("%s%s", uuid.New().String(), filepath.Ext(originalName))
+
+	putOptions := minio.PutObjectOptions{ContentType: contentType}
+	if strings.Contains(contentType, "svg") {
+		putOptions.ContentDisposition = "attachment"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	_, err := ms.Client.PutObject(ctx, ms.BucketName, fileName, bytes.NewReader(data), int64(len(data)), putOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload file to MinIO: %w", err)
+	}
+
+	return newMediaFile(fileName, originalName, contentType, int64(len(data)), metadata, userID), nil
+}
+
+func newMediaFile(fileName, originalName, contentType string, size int64, metadata models.CreateMediaRequest, userID primitive.ObjectID) *models.MediaFile {
+	return &models.MediaFile{
 		FileName:     fileName,
-		OriginalName: file.Filename,
+		OriginalName: originalName,
 		Title:        metadata.Title,
 		Description:  metadata.Description,
-		MimeType:     file.Header.Get("Content-Type"),
-		Size:         file.Size,
+		MimeType:     contentType,
+		Size:         size,
 		Category:     metadata.Category,
 		Tags:         metadata.Tags,
 		UserID:       userID,
 	}
+}
+
+// UploadBytes stores generated content (derived variants, rendered results)
+// under the given object name
+func (ms *MinioService) UploadBytes(fileName string, data []byte, contentType string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	_, err := ms.Client.PutObject(
+		ctx,
+		ms.BucketName,
+		fileName,
+		bytes.NewReader(data),
+		int64(len(data)),
+		minio.PutObjectOptions{ContentType: contentType},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s to MinIO: %w", fileName, err)
+	}
 
-	return mediaFile, nil
+	return nil
 }
 
 func (ms *MinioService) GetFileURL(fileName string) (string, error) {
@@ -237,6 +284,26 @@ func (ms *MinioService) GetFileURL(fileName string) (string, error) {
 	return url.String(), nil
 }
 
+// GetAttachmentURL returns a presigned URL that forces a download instead of
+// inline rendering, for content (like SVG) that browsers could execute
+func (ms *MinioService) GetAttachmentURL(fileName, downloadName string) (string, error) {
+	params := url.Values{}
+	params.Set("response-content-disposition", fmt.Sprintf("attachment; filename=%q", downloadName))
+
+	presigned, err := ms.Client.PresignedGetObject(
+		context.Background(),
+		ms.BucketName,
+		fileName,
+		7*24*time.Hour,
+		params,
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate presigned URL: %w", err)
+	}
+
+	return presigned.String(), nil
+}
+
 func (ms *MinioService) DeleteFile(fileName string) error {
 	err := ms.Client.RemoveObject(
 		context.Background(),
@@ -251,6 +318,36 @@ func (ms *MinioService) DeleteFile(fileName string) error {
 	return nil
 }
 
+// DeletePrefix removes every object under prefix that match accepts (nil
+// accepts all)
+func (ms *MinioService) DeletePrefix(prefix string, match func(name string) bool) error {
+	ctx := context.Background()
+	for obj := range ms.Client.ListObjects(ctx, ms.BucketName, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return fmt.Errorf("failed to list %s in MinIO: %w", prefix, obj.Err)
+		}
+		if match != nil && !match(obj.Key) {
+			continue
+		}
+		if err := ms.Client.RemoveObject(ctx, ms.BucketName, obj.Key, minio.RemoveObjectOptions{}); err != nil {
+			return fmt.Errorf("failed to delete %s from MinIO: %w", obj.Key, err)
+		}
+	}
+	return nil
+}
+
+// ListPrefix returns the names of every object under prefix
+func (ms *MinioService) ListPrefix(prefix string) ([]string, error) {
+	var names []string
+	for obj := range ms.Client.ListObjects(context.Background(), ms.BucketName, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("failed to list %s in MinIO: %w", prefix, obj.Err)
+		}
+		names = append(names, obj.Key)
+	}
+	return names, nil
+}
+
 func (ms *MinioService) GetFileContent(fileName string) (io.ReadCloser, error) {
 	obj, err := ms.Client.GetObject(
 		context.Background(),
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+)
+
+// EXIF orientation values. Each one describes the transform that turns the
+// stored pixels upright.
+const (
+	orientationNormal     = 1
+	orientationFlipH      = 2
+	orientationRotate180  = 3
+	orientationFlipV      = 4
+	orientationTranspose  = 5
+	orientationRotate90   = 6 // rotate 90° clockwise
+	orientationTransverse = 7
+	orientationRotate270  = 8 // rotate 90° counter-clockwise
+)
+
+// orientationOps decomposes each orientation into a horizontal flip followed
+// by a number of clockwise quarter turns
+var orientationOps = map[int]struct {
+	quarterTurns int
+	flip         bool
+}{
+	orientationNormal:     {0, false},
+	orientationFlipH:      {0, true},
+	orientationRotate180:  {2, false},
+	orientationFlipV:      {2, true},
+	orientationTranspose:  {3, true},
+	orientationRotate90:   {1, false},
+	orientationTransverse: {1, true},
+	orientationRotate270:  {3, false},
+}
+
+// jpegtranOrientationArgs are the lossless jpegtran transforms matching each orientation
+var jpegtranOrientationArgs = map[int][]string{
+	orientationFlipH:      {"-flip", "horizontal"},
+	orientationRotate180:  {"-rotate", "180"},
+	orientationFlipV:      {"-flip", "vertical"},
+	orientationTranspose:  {"-transpose"},
+	orientationRotate90:   {"-rotate", "90"},
+	orientationTransverse: {"-transverse"},
+	orientationRotate270:  {"-rotate", "270"},
+}
+
+func validOrientation(orientation int) bool {
+	_, ok := orientationOps[orientation]
+	return ok
+}
+
+// rotateOrientation composes an orientation with an extra clockwise rotation
+func rotateOrientation(orientation, degrees int) int {
+	op, ok := orientationOps[orientation]
+	if !ok {
+		op = orientationOps[orientationNormal]
+	}
+	turns := ((op.quarterTurns+degrees/90)%4 + 4) % 4
+
+	for value, candidate := range orientationOps {
+		if candidate.quarterTurns == turns && candidate.flip == op.flip {
+			return value
+		}
+	}
+	return orientationNormal
+}
+
+// applyOrientation returns img transformed upright according to orientation
+func applyOrientation(img image.Image, orientation int) image.Image {
+	op, ok := orientationOps[orientation]
+	if !ok || orientation == orientationNormal {
+		return img
+	}
+
+	src := image.NewRGBA64(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(src, src.Bounds(), img, img.Bounds().Min, draw.Src)
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+
+	if op.flip {
+		for y := 0; y < h; y++ {
+			row := src.Pix[y*src.Stride : y*src.Stride+w*8]
+			for l, r := 0, (w-1)*8; l < r; l, r = l+8, r-8 {
+				for i := 0; i < 8; i++ {
+					row[l+i], row[r+i] = row[r+i], row[l+i]
+				}
+			}
+		}
+	}
+
+	switch op.quarterTurns {
+	case 1:
+		dst := image.NewRGBA64(image.Rect(0, 0, h, w))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				copy(dst.Pix[dst.PixOffset(h-1-y, x):][:8], src.Pix[src.PixOffset(x, y):][:8])
+			}
+		}
+		return dst
+	case 2:
+		dst := image.NewRGBA64(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				copy(dst.Pix[dst.PixOffset(w-1-x, h-1-y):][:8], src.Pix[src.PixOffset(x, y):][:8])
+			}
+		}
+		return dst
+	case 3:
+		dst := image.NewRGBA64(image.Rect(0, 0, h, w))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				copy(dst.Pix[dst.PixOffset(y, w-1-x):][:8], src.Pix[src.PixOffset(x, y):][:8])
+			}
+		}
+		return dst
+	}
+	return src
+}
+
+// readEXIFOrientation returns the Orientation tag from JPEG, PNG (eXIf), WebP
+// or TIFF-based data, or 0 if there is none
+func readEXIFOrientation(data []byte) int {
+	tiff := findEXIFTIFF(data)
+	if tiff == nil {
+		return 0
+	}
+	_, orientation := findOrientationTag(tiff)
+	if !validOrientation(orientation) {
+		return 0
+	}
+	return orientation
+}
+
+// findEXIFTIFF locates the TIFF structure holding EXIF IFD0
+func findEXIFTIFF(data []byte) []byte {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8}):
+		for offset := 2; offset+4 <= len(data); {
+			if data[offset] != 0xFF {
+				return nil
+			}
+			marker := data[offset+1]
+			if marker == 0xDA || marker == 0xD9 {
+				return nil
+			}
+			size := int(binary.BigEndian.Uint16(data[offset+2:]))
+			end := offset + 2 + size
+			if size < 2 || end > len(data) {
+				return nil
+			}
+			segment := data[offset+4 : end]
+			if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+				return segment[6:]
+			}
+			offset = end
+		}
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		for offset := 8; offset+8 <= len(data); {
+			length := int(binary.BigEndian.Uint32(data[offset:]))
+			end := offset + 12 + length
+			if length < 0 || end > len(data) {
+				return nil
+			}
+			if string(data[offset+4:offset+8]) == "eXIf" {
+				return data[offset+8 : offset+8+length]
+			}
+			offset = end
+		}
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		for offset := 12; offset+8 <= len(data); {
+			size := int(binary.LittleEndian.Uint32(data[offset+4:]))
+			end := offset + 8 + size + size%2
+			if offset+8+size > len(data) {
+				return nil
+			}
+			if string(data[offset:offset+4]) == "EXIF" {
+				return bytes.TrimPrefix(data[offset+8:offset+8+size], []byte("Exif\x00\x00"))
+			}
+			offset = end
+		}
+	case bytes.HasPrefix(data, []byte("II")), bytes.HasPrefix(data, []byte("MM")):
+		return data
+	}
+	return nil
+}
+
+// findOrientationTag walks IFD0 and returns the byte offset of the
+// Orientation value within tiff together with the value itself
+func findOrientationTag(tiff []byte) (int, int) {
+	if len(tiff) < 8 {
+		return -1, 0
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return -1, 0
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return -1, 0
+	}
+
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return entry + 8, int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return -1, 0
+}
+
+// resetEXIFOrientation rewrites the Orientation tag in place to 1, for
+// images whose pixels have been transformed upright
+func resetEXIFOrientation(data []byte) {
+	tiff := findEXIFTIFF(data)
+	if tiff == nil {
+		return
+	}
+	offset, _ := findOrientationTag(tiff)
+	if offset < 0 {
+		return
+	}
+	if string(tiff[:2]) == "II" {
+		binary.LittleEndian.PutUint16(tiff[offset:], orientationNormal)
+	} else {
+		binary.BigEndian.PutUint16(tiff[offset:], orientationNormal)
+	}
+}
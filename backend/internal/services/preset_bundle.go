@@ -0,0 +1,306 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"mediaVault-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// MaxPresetImportSize bounds uploaded bundles and .xmp files; bundles
+	// carry their LUTs, which can be several MB each
+	MaxPresetImportSize = 64 << 20
+	// maxBundlePresets bounds the presets in one bundle
+	maxBundlePresets = 100
+	// presetThumbnailPrefix is where preset thumbnails live in the bucket
+	presetThumbnailPrefix = "preset-thumbnails/"
+)
+
+// ErrInvalidPresetImport is returned for files that can't be imported
+var ErrInvalidPresetImport = errors.New("invalid preset import")
+
+// ExportPresets bundles presets the user may apply with the LUTs and masks
+// they uploaded and the presets reference. Assets that can't be included
+// are reported in the result.
+func (fs *FilterService) ExportPresets(ctx context.Context, userID primitive.ObjectID, presetIDs []primitive.ObjectID) (*models.PresetExportResult, error) {
+	bundle := &models.PresetBundle{SchemaVersion: models.PresetBundleSchema, ExportedAt: time.Now()}
+	result := &models.PresetExportResult{Bundle: bundle, Skipped: []models.PresetExportIssue{}}
+	luts, masks := map[string]bool{}, map[string]bool{}
+
+	for _, id := range presetIDs {
+		preset, err := fs.getAccessiblePreset(ctx, id, userID)
+		if err != nil {
+			return nil, err
+		}
+		entry := models.BundlePreset{
+			ID:          preset.ID.Hex(),
+			Version:     preset.Version,
+			Name:        preset.Name,
+			Category:    preset.Category,
+			Type:        preset.Type,
+			Description: preset.Description,
+			Config:      preset.Config,
+		}
+		skip := func(asset, ref string, err error) {
+			reason := "couldn't be read"
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				reason = "only your own uploads are exported"
+			} else {
+				log.Printf("Leaving %s %s of preset %s out of the export: %v", asset, ref, preset.ID.Hex(), err)
+			}
+			result.Skipped = append(result.Skipped, models.PresetExportIssue{Preset: preset.Name, Asset: asset, ID: ref, Reason: reason})
+		}
+
+		if preset.Thumbnail != nil {
+			if data, err := fs.readObject(*preset.Thumbnail); err == nil {
+				entry.Thumbnail = &models.BundleAsset{MimeType: http.DetectContentType(data), Data: data}
+			} else {
+				skip("thumbnail", "", err)
+			}
+		}
+		bundle.Presets = append(bundle.Presets, entry)
+
+		for _, effect := range preset.Config.Effects {
+			if ref := paramString(effect.Params, "lut", ""); effect.Type == "lut" && !isBuiltinLUT(ref) && !luts[ref] {
+				luts[ref] = true
+				if asset, err := fs.exportAsset(ctx, lutCollection, userID, ref); err == nil {
+					bundle.LUTs = append(bundle.LUTs, *asset)
+				} else {
+					skip("lut", ref, err)
+				}
+			}
+		}
+		if mask := preset.Config.Mask; mask != nil && mask.MaskID != nil && !masks[mask.MaskID.Hex()] {
+			ref := mask.MaskID.Hex()
+			masks[ref] = true
+			if asset, err := fs.exportAsset(ctx, maskCollection, userID, ref); err == nil {
+				bundle.Masks = append(bundle.Masks, *asset)
+			} else {
+				skip("mask", ref, err)
+			}
+		}
+	}
+	return result, nil
+}
+
+// exportAsset reads one of the user's uploaded LUTs or masks
+func (fs *FilterService) exportAsset(ctx context.Context, collection string, userID primitive.ObjectID, ref string) (*models.BundleAsset, error) {
+	id, err := primitive.ObjectIDFromHex(ref)
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Name     string `bson:"name"`
+		FileName string `bson:"fileName"`
+	}
+	if err := fs.db.Collection(collection).FindOne(ctx, bson.M{"_id": id, "userId": userID}).Decode(&doc); err != nil {
+		return nil, err
+	}
+	data, err := fs.readObject(doc.FileName)
+	if err != nil {
+		return nil, err
+	}
+	return &models.BundleAsset{ID: ref, Name: doc.Name, Data: data}, nil
+}
+
+// ImportPresets creates custom presets from a JSON bundle or a Lightroom
+// .xmp preset. Files that can't be read wrap ErrInvalidPresetImport;
+// settings that can't be carried over are reported in the result.
+func (fs *FilterService) ImportPresets(ctx context.Context, userID primitive.ObjectID, fileName string, data []byte) (*models.PresetImportResult, error) {
+	switch strings.ToLower(path.Ext(fileName)) {
+	case ".xmp":
+		return fs.importXMP(ctx, userID, fileName, data)
+	case ".json":
+		var bundle models.PresetBundle
+		if err := json.Unmarshal(data, &bundle); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPresetImport, err)
+		}
+		return fs.importBundle(ctx, userID, &bundle)
+	}
+	return nil, fmt.Errorf("%w: expected a .json bundle or a Lightroom .xmp preset", ErrInvalidPresetImport)
+}
+
+func (fs *FilterService) importBundle(ctx context.Context, userID primitive.ObjectID, bundle *models.PresetBundle) (*models.PresetImportResult, error) {
+	if bundle.SchemaVersion < 1 || bundle.SchemaVersion > models.PresetBundleSchema {
+		return nil, fmt.Errorf("%w: unsupported bundle schema version %d", ErrInvalidPresetImport, bundle.SchemaVersion)
+	}
+	if len(bundle.Presets) == 0 || len(bundle.Presets) > maxBundlePresets {
+		return nil, fmt.Errorf("%w: bundles hold between 1 and %d presets", ErrInvalidPresetImport, maxBundlePresets)
+	}
+	result := &models.PresetImportResult{Presets: []models.FilterPreset{}, Unsupported: []models.PresetImportIssue{}}
+
+	// Assets get new IDs here; configs are rewritten to match
+	luts := map[string]string{}
+	for _, asset := range bundle.LUTs {
+		lut, err := fs.UploadLUT(ctx, userID, asset.Name+".cube", asset.Data)
+		if err != nil {
+			log.Printf("Failed to import LUT %s: %v", asset.ID, err)
+			continue
+		}
+		luts[asset.ID] = lut.ID.Hex()
+	}
+	masks := map[string]primitive.ObjectID{}
+	for _, asset := range bundle.Masks {
+		mask, err := fs.UploadMask(ctx, userID, asset.Name+".png", asset.Data)
+		if err != nil {
+			log.Printf("Failed to import mask %s: %v", asset.ID, err)
+			continue
+		}
+		masks[asset.ID] = mask.ID
+	}
+
+	for _, p := range bundle.Presets {
+		report := func(setting, value, reason string) {
+			result.Unsupported = append(result.Unsupported, models.PresetImportIssue{Preset: p.Name, Setting: setting, Value: value, Reason: reason})
+		}
+
+		if p.Name == "" {
+			report("name", "", "presets need a name")
+			continue
+		}
+
+		config := p.Config
+		effects := make([]models.Effect, 0, len(config.Effects))
+		for i, effect := range config.Effects {
+			switch ref := paramString(effect.Params, "lut", ""); {
+			case effect.Type == "lut" && ref != "" && !isBuiltinLUT(ref):
+				newRef, ok := luts[ref]
+				if !ok {
+					report(fmt.Sprintf("effects[%d]", i), ref, "the LUT isn't in the bundle or couldn't be imported")
+					continue
+				}
+				params := make(map[string]interface{}, len(effect.Params))
+				for k, v := range effect.Params {
+					params[k] = v
+				}
+				params["lut"] = newRef
+				effect.Params = params
+			case effect.Type == "watermark" && paramString(effect.Params, "logo", "") != "":
+				report(fmt.Sprintf("effects[%d]", i), paramString(effect.Params, "logo", ""), "watermark logos are media items and aren't included in bundles")
+				continue
+			}
+			effects = append(effects, effect)
+		}
+		config.Effects = effects
+		if mask := config.Mask; mask != nil && mask.MaskID != nil {
+			if newID, ok := masks[mask.MaskID.Hex()]; ok {
+				imported := *mask
+				imported.MaskID = &newID
+				config.Mask = &imported
+			} else {
+				report("mask", mask.MaskID.Hex(), "the mask isn't in the bundle or couldn't be imported")
+				config.Mask = nil
+			}
+		}
+
+		var thumbnail []byte
+		if p.Thumbnail != nil {
+			if _, _, err := presetThumbnailType(p.Thumbnail.Data); err != nil {
+				report("thumbnail", "", err.Error())
+			} else {
+				thumbnail = p.Thumbnail.Data
+			}
+		}
+
+		preset, err := fs.newCustomPreset(ctx, userID, models.CreateFilterPresetRequest{
+			Name:        p.Name,
+			Category:    p.Category,
+			Type:        p.Type,
+			Description: p.Description,
+			Config:      config,
+		}, nil, thumbnail)
+		if errors.Is(err, ErrInvalidPreset) {
+			report("config", "", err.Error())
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		result.Presets = append(result.Presets, *preset)
+	}
+	return result, nil
+}
+
+// importXMP maps a Lightroom develop preset onto a new custom preset
+func (fs *FilterService) importXMP(ctx context.Context, userID primitive.ObjectID, fileName string, data []byte) (*models.PresetImportResult, error) {
+	xmp, err := parseXMPPreset(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPresetImport, err)
+	}
+	name := xmp.name()
+	if name == "" {
+		name = strings.TrimSuffix(path.Base(fileName), path.Ext(fileName))
+	}
+
+	config, unsupported := xmp.toFilterConfig()
+	result := &models.PresetImportResult{Presets: []models.FilterPreset{}, Unsupported: []models.PresetImportIssue{}}
+	for _, key := range sortedKeys(unsupported) {
+		result.Unsupported = append(result.Unsupported, models.PresetImportIssue{
+			Preset: name, Setting: key, Value: unsupported[key], Reason: "no equivalent in filter configs",
+		})
+	}
+
+	preset, err := fs.CreateCustomPreset(ctx, userID, models.CreateFilterPresetRequest{
+		Name:        name,
+		Category:    models.FilterCategoryColor,
+		Type:        "lightroom",
+		Description: "Imported from Lightroom",
+		Config:      config,
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.Presets = append(result.Presets, *preset)
+	return result, nil
+}
+
+// presetThumbnailType returns the content type and extension of a JPEG, PNG
+// or WebP thumbnail
+func presetThumbnailType(data []byte) (string, string, error) {
+	mimeType := http.DetectContentType(data)
+	switch mimeType {
+	case "image/jpeg":
+		return mimeType, ".jpg", nil
+	case "image/png":
+		return mimeType, ".png", nil
+	case "image/webp":
+		return mimeType, ".webp", nil
+	}
+	return "", "", fmt.Errorf("thumbnails must be JPEG, PNG or WebP, not %s", mimeType)
+}
+
+// uploadPresetThumbnail stores a supplied thumbnail for a preset and
+// returns its object name
+func (fs *FilterService) uploadPresetThumbnail(presetID primitive.ObjectID, data []byte) (string, error) {
+	mimeType, ext, err := presetThumbnailType(data)
+	if err != nil {
+		return "", err
+	}
+	name := presetThumbnailPrefix + presetID.Hex() + ext
+	if err := fs.minioSvc.UploadBytes(name, data, mimeType); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+func (fs *FilterService) readObject(name string) ([]byte, error) {
+	reader, err := fs.minioSvc.GetFileContent(name)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
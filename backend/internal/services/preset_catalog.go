@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"mediaVault-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const presetCollection = "filter_presets"
+
+// presetCatalogFormat is the catalog file layout this build understands
+const presetCatalogFormat = 1
+
+// The built-in presets. IDs are fixed so clients can keep referring to
+// them; bump a preset's version whenever its definition changes and the
+// next sync rewrites the stored copy.
+//
+//go:embed presets/catalog.json
+var presetCatalogData []byte
+
+type presetCatalog struct {
+	Version int             `json:"version"`
+	Presets []catalogPreset `json:"presets"`
+}
+
+type catalogPreset struct {
+	ID          primitive.ObjectID    `json:"id"`
+	Version     int                   `json:"version"`
+	Name        string                `json:"name"`
+	Category    models.FilterCategory `json:"category"`
+	Type        string                `json:"type"`
+	Description string                `json:"description"`
+	Config      models.FilterConfig   `json:"config"`
+}
+
+// BuiltinPresets returns the presets of the embedded catalog
+func BuiltinPresets() ([]*models.FilterPreset, error) {
+	var catalog presetCatalog
+	if err := json.Unmarshal(presetCatalogData, &catalog); err != nil {
+		return nil, fmt.Errorf("failed to parse preset catalog: %w", err)
+	}
+	if catalog.Version != presetCatalogFormat {
+		return nil, fmt.Errorf("unsupported preset catalog version %d", catalog.Version)
+	}
+
+	seen := make(map[primitive.ObjectID]bool, len(catalog.Presets))
+	presets := make([]*models.FilterPreset, 0, len(catalog.Presets))
+	for _, p := range catalog.Presets {
+		if p.ID.IsZero() || seen[p.ID] {
+			return nil, fmt.Errorf("preset %q: missing or duplicate id", p.Name)
+		}
+		seen[p.ID] = true
+		if p.Version < 1 {
+			return nil, fmt.Errorf("preset %q: version must be at least 1", p.Name)
+		}
+		if err := ValidateFilterConfig(p.Config); err != nil {
+			return nil, fmt.Errorf("preset %q: %w", p.Name, err)
+		}
+
+		presets = append(presets, &models.FilterPreset{
+			ID:          p.ID,
+			Name:        p.Name,
+			Category:    p.Category,
+			Type:        p.Type,
+			Description: p.Description,
+			Config:      p.Config,
+			Version:     p.Version,
+		})
+	}
+	return presets, nil
+}
+
+// SyncPresetCatalog writes the built-in presets into filter_presets. Stored
+// copies are only rewritten when the catalog has a newer version, so running
+// it again changes nothing. Built-ins seeded before the catalog existed have
+// their references moved to the catalog preset of the same name, and any
+// built-in no longer in the catalog is removed. It returns how many presets
+// were written.
+func SyncPresetCatalog(ctx context.Context, db *mongo.Database) (int, error) {
+	presets, err := BuiltinPresets()
+	if err != nil {
+		return 0, err
+	}
+	collection := db.Collection(presetCollection)
+
+	written := 0
+	ids := make([]primitive.ObjectID, 0, len(presets))
+	for _, preset := range presets {
+		ids = append(ids, preset.ID)
+		if err := adoptLegacyPreset(ctx, db, preset); err != nil {
+			return written, err
+		}
+
+		var stored models.FilterPreset
+		err := collection.FindOne(ctx, bson.M{"_id": preset.ID}).Decode(&stored)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return written, fmt.Errorf("failed to read preset %s: %w", preset.Name, err)
+		}
+		if err == nil && stored.Version >= preset.Version {
+			continue
+		}
+
+		now := time.Now()
+		_, err = collection.UpdateOne(ctx, bson.M{"_id": preset.ID}, bson.M{
+			"$set": bson.M{
+				"name":        preset.Name,
+				"category":    preset.Category,
+				"type":        preset.Type,
+				"description": preset.Description,
+				"config":      preset.Config,
+				"isCustom":    false,
+				"version":     preset.Version,
+				"updatedAt":   now,
+			},
+			"$setOnInsert": bson.M{"createdAt": now},
+		}, options.Update().SetUpsert(true))
+		if err != nil {
+			return written, fmt.Errorf("failed to write preset %s: %w", preset.Name, err)
+		}
+		if err := savePresetVersion(ctx, db, preset); err != nil {
+			return written, err
+		}
+		written++
+	}
+
+	retired := bson.M{"isCustom": false, "_id": bson.M{"$nin": ids}}
+	result, err := collection.DeleteMany(ctx, retired)
+	if err != nil {
+		return written, fmt.Errorf("failed to remove retired presets: %w", err)
+	}
+	if result.DeletedCount > 0 {
+		log.Printf("Removed %d built-in presets that are no longer in the catalog", result.DeletedCount)
+	}
+	return written, nil
+}
+
+// adoptLegacyPreset points everything that references a built-in seeded
+// under a random ID, with the same name as preset, at the catalog ID
+func adoptLegacyPreset(ctx context.Context, db *mongo.Database, preset *models.FilterPreset) error {
+	var legacy models.FilterPreset
+	err := db.Collection(presetCollection).FindOne(ctx, bson.M{
+		"_id":      bson.M{"$ne": preset.ID},
+		"name":     preset.Name,
+		"isCustom": false,
+		"version":  bson.M{"$exists": false},
+	}).Decode(&legacy)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up legacy preset %s: %w", preset.Name, err)
+	}
+	oldID, newID := legacy.ID, preset.ID
+
+	updates := []struct {
+		collection string
+		filter     bson.M
+		update     bson.M
+		opts       *options.UpdateOptions
+	}{
+		{"filter_applications", bson.M{"filterId": oldID}, bson.M{"$set": bson.M{"filterId": newID}}, nil},
+		{
+			mediaCollection,
+			bson.M{"edits.steps.filterId": oldID},
+			bson.M{"$set": bson.M{"edits.steps.$[step].filterId": newID}},
+			options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"step.filterId": oldID}}}),
+		},
+		{"user_filter_preferences", bson.M{"lastUsed": oldID}, bson.M{"$set": bson.M{"lastUsed": newID}}, nil},
+		{
+			"user_filter_preferences",
+			bson.M{"frequentlyUsed": oldID},
+			bson.M{"$set": bson.M{"frequentlyUsed.$[id]": newID}},
+			options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"id": oldID}}}),
+		},
+		{
+			"user_filter_preferences",
+			bson.M{"$or": []bson.M{{"presetTweaks." + oldID.Hex(): bson.M{"$exists": true}}, {"usageCount." + oldID.Hex(): bson.M{"$exists": true}}}},
+			bson.M{"$rename": bson.M{"presetTweaks." + oldID.Hex(): "presetTweaks." + newID.Hex(), "usageCount." + oldID.Hex(): "usageCount." + newID.Hex()}},
+			nil,
+		},
+	}
+	for _, u := range updates {
+		opts := u.opts
+		if opts == nil {
+			opts = options.Update()
+		}
+		if _, err := db.Collection(u.collection).UpdateMany(ctx, u.filter, u.update, opts); err != nil {
+			return fmt.Errorf("failed to move %s references of preset %s: %w", u.collection, preset.Name, err)
+		}
+	}
+
+	log.Printf("Moved references of legacy preset %s from %s to %s", preset.Name, oldID.Hex(), newID.Hex())
+	return nil
+}
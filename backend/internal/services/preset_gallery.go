@@ -0,0 +1,303 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+
+	"mediaVault-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const presetRatingCollection = "filter_preset_ratings"
+
+// ErrPresetModerated is returned when publishing a preset an admin took out
+// of the gallery before its owner changed it
+var ErrPresetModerated = errors.New("preset was unpublished by a moderator")
+
+// ensureGalleryIndexes creates the indexes the gallery queries rely on
+func (fs *FilterService) ensureGalleryIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	indexes := []struct {
+		collection string
+		model      mongo.IndexModel
+	}{
+		{"filter_applications", mongo.IndexModel{Keys: bson.D{{Key: "filterId", Value: 1}}}},
+		{presetCollection, mongo.IndexModel{Keys: bson.D{{Key: "visibility", Value: 1}, {Key: "publishedAt", Value: -1}}}},
+		{presetRatingCollection, mongo.IndexModel{
+			Keys:    bson.D{{Key: "presetId", Value: 1}, {Key: "userId", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		}},
+	}
+	for _, index := range indexes {
+		if _, err := fs.db.Collection(index.collection).Indexes().CreateOne(ctx, index.model); err != nil {
+			log.Printf("Failed to create %s index: %v", index.collection, err)
+		}
+	}
+}
+
+// SetPresetVisibility publishes one of the user's presets to the gallery or
+// makes it private again. Other users lose access to a preset once it's
+// private; forks they made are theirs to keep.
+func (fs *FilterService) SetPresetVisibility(ctx context.Context, userID, presetID primitive.ObjectID, visibility models.PresetVisibility) (*models.FilterPreset, error) {
+	current, err := fs.GetCustomPreset(ctx, userID, presetID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	update := bson.M{"$set": bson.M{"visibility": models.PresetPrivate}}
+	if visibility == models.PresetPublic {
+		if m := current.Moderation; m != nil && current.Version <= m.Version {
+			return nil, fmt.Errorf("%w: %s", ErrPresetModerated, m.Reason)
+		}
+		update = bson.M{
+			"$set":   bson.M{"visibility": models.PresetPublic, "publishedAt": now},
+			"$unset": bson.M{"moderation": ""},
+		}
+	}
+
+	var updated models.FilterPreset
+	err = fs.db.Collection(presetCollection).FindOneAndUpdate(ctx, ownedPreset(userID, presetID), update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrPresetNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to change preset visibility: %w", err)
+	}
+	return &updated, nil
+}
+
+// ListGalleryPresets searches the public presets. Popularity is the number
+// of times a preset has been applied.
+func (fs *FilterService) ListGalleryPresets(ctx context.Context, query models.PresetGalleryQuery) ([]models.GalleryPreset, int64, error) {
+	match := bson.M{"isCustom": true, "visibility": models.PresetPublic}
+	if query.Category != "" {
+		match["category"] = query.Category
+	}
+	if query.Type != "" {
+		match["type"] = query.Type
+	}
+	if query.Search != "" {
+		pattern := bson.M{"$regex": regexp.QuoteMeta(query.Search), "$options": "i"}
+		match["$or"] = []bson.M{{"name": pattern}, {"description": pattern}}
+	}
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	if query.Limit < 1 || query.Limit > 100 {
+		query.Limit = 20
+	}
+
+	collection := fs.db.Collection(presetCollection)
+	total, err := collection.CountDocuments(ctx, match)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count gallery presets: %w", err)
+	}
+
+	page := mongo.Pipeline{
+		{{Key: "$skip", Value: int64((query.Page - 1) * query.Limit)}},
+		{{Key: "$limit", Value: int64(query.Limit)}},
+	}
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: match}}}
+	switch query.Sort {
+	case models.GallerySortRating:
+		pipeline = append(pipeline, bson.D{{Key: "$sort", Value: bson.D{{Key: "rating.average", Value: -1}, {Key: "rating.count", Value: -1}, {Key: "_id", Value: -1}}}})
+		pipeline = append(append(pipeline, page...), usageCountStages()...)
+	case models.GallerySortNewest:
+		pipeline = append(pipeline, bson.D{{Key: "$sort", Value: bson.D{{Key: "publishedAt", Value: -1}, {Key: "_id", Value: -1}}}})
+		pipeline = append(append(pipeline, page...), usageCountStages()...)
+	default:
+		// Usage has to be counted for every match before it can be sorted on
+		pipeline = append(pipeline, usageCountStages()...)
+		pipeline = append(pipeline, bson.D{{Key: "$sort", Value: bson.D{{Key: "usageCount", Value: -1}, {Key: "rating.average", Value: -1}, {Key: "_id", Value: -1}}}})
+		pipeline = append(pipeline, page...)
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list gallery presets: %w", err)
+	}
+	presets := []models.GalleryPreset{}
+	if err := cursor.All(ctx, &presets); err != nil {
+		return nil, 0, fmt.Errorf("failed to list gallery presets: %w", err)
+	}
+	return presets, total, nil
+}
+
+// GetGalleryPreset returns a public preset with the user's rating of it
+func (fs *FilterService) GetGalleryPreset(ctx context.Context, userID, presetID primitive.ObjectID) (*models.GalleryPreset, error) {
+	pipeline := append(mongo.Pipeline{{{Key: "$match", Value: publicPreset(presetID)}}}, usageCountStages()...)
+	cursor, err := fs.db.Collection(presetCollection).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get gallery preset: %w", err)
+	}
+	var presets []models.GalleryPreset
+	if err := cursor.All(ctx, &presets); err != nil {
+		return nil, fmt.Errorf("failed to get gallery preset: %w", err)
+	}
+	if len(presets) == 0 {
+		return nil, ErrPresetNotFound
+	}
+	preset := &presets[0]
+
+	var rating models.FilterPresetRating
+	err = fs.db.Collection(presetRatingCollection).FindOne(ctx, bson.M{"presetId": presetID, "userId": userID}).Decode(&rating)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("failed to get rating: %w", err)
+	}
+	preset.MyRating = rating.Rating
+	return preset, nil
+}
+
+// ForkPreset copies a public preset into the user's presets, remembering
+// where it came from
+func (fs *FilterService) ForkPreset(ctx context.Context, userID, sourceID primitive.ObjectID, name string) (*models.FilterPreset, error) {
+	var source models.FilterPreset
+	err := fs.db.Collection(presetCollection).FindOne(ctx, publicPreset(sourceID)).Decode(&source)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrPresetNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get filter preset: %w", err)
+	}
+	if name == "" {
+		name = source.Name
+	}
+
+	fork, err := fs.newCustomPreset(ctx, userID, models.CreateFilterPresetRequest{
+		Name:        name,
+		Category:    source.Category,
+		Type:        source.Type,
+		Description: source.Description,
+		Config:      mergeConfigs(source.Config),
+	}, &sourceID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := fs.db.Collection(presetCollection).UpdateOne(ctx, bson.M{"_id": sourceID}, bson.M{"$inc": bson.M{"forks": 1}}); err != nil {
+		log.Printf("Failed to count fork of preset %s: %v", sourceID.Hex(), err)
+	}
+	return fork, nil
+}
+
+// RatePreset records the user's 1-5 star rating of someone else's public
+// preset, replacing any earlier rating, and returns the new aggregate
+func (fs *FilterService) RatePreset(ctx context.Context, userID, presetID primitive.ObjectID, stars int) (*models.PresetRating, error) {
+	if stars < 1 || stars > 5 {
+		return nil, fmt.Errorf("%w: ratings are between 1 and 5", ErrInvalidPreset)
+	}
+	var preset models.FilterPreset
+	err := fs.db.Collection(presetCollection).FindOne(ctx, publicPreset(presetID)).Decode(&preset)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrPresetNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get filter preset: %w", err)
+	}
+	if preset.CreatedBy != nil && *preset.CreatedBy == userID {
+		return nil, fmt.Errorf("%w: you can't rate your own preset", ErrInvalidPreset)
+	}
+
+	now := time.Now()
+	_, err = fs.db.Collection(presetRatingCollection).UpdateOne(ctx,
+		bson.M{"presetId": presetID, "userId": userID},
+		bson.M{
+			"$set":         bson.M{"rating": stars, "updatedAt": now},
+			"$setOnInsert": bson.M{"createdAt": now},
+		},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to save rating: %w", err)
+	}
+	return fs.updatePresetRating(ctx, presetID)
+}
+
+// updatePresetRating recomputes the aggregate rating stored on a preset
+func (fs *FilterService) updatePresetRating(ctx context.Context, presetID primitive.ObjectID) (*models.PresetRating, error) {
+	cursor, err := fs.db.Collection(presetRatingCollection).Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"presetId": presetID}}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "average": bson.M{"$avg": "$rating"}, "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate ratings: %w", err)
+	}
+	var results []models.PresetRating
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, fmt.Errorf("failed to aggregate ratings: %w", err)
+	}
+
+	rating := &models.PresetRating{}
+	if len(results) > 0 {
+		rating = &results[0]
+	}
+	if _, err := fs.db.Collection(presetCollection).UpdateOne(ctx, bson.M{"_id": presetID}, bson.M{"$set": bson.M{"rating": rating}}); err != nil {
+		return nil, fmt.Errorf("failed to save rating: %w", err)
+	}
+	return rating, nil
+}
+
+// UnpublishPreset takes a public preset out of the gallery on behalf of an
+// admin. The owner can't publish it again until they save a new version.
+func (fs *FilterService) UnpublishPreset(ctx context.Context, adminID, presetID primitive.ObjectID, reason string) error {
+	var preset models.FilterPreset
+	err := fs.db.Collection(presetCollection).FindOne(ctx, publicPreset(presetID)).Decode(&preset)
+	if err == mongo.ErrNoDocuments {
+		return ErrPresetNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get filter preset: %w", err)
+	}
+
+	moderation := models.PresetModeration{
+		Reason:        reason,
+		Version:       preset.Version,
+		UnpublishedBy: adminID,
+		UnpublishedAt: time.Now(),
+	}
+	result, err := fs.db.Collection(presetCollection).UpdateOne(ctx, publicPreset(presetID), bson.M{"$set": bson.M{
+		"visibility": models.PresetPrivate,
+		"moderation": moderation,
+	}})
+	if err != nil {
+		return fmt.Errorf("failed to unpublish preset: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrPresetNotFound
+	}
+	log.Printf("Preset %s unpublished by %s: %s", presetID.Hex(), adminID.Hex(), reason)
+	return nil
+}
+
+// usageCountStages adds usageCount, the number of filter_applications of
+// each preset
+func usageCountStages() mongo.Pipeline {
+	return mongo.Pipeline{
+		{{Key: "$lookup", Value: bson.M{
+			"from": "filter_applications",
+			"let":  bson.M{"presetId": "$_id"},
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$filterId", "$$presetId"}}}},
+				bson.M{"$count": "n"},
+			},
+			"as": "usage",
+		}}},
+		{{Key: "$addFields", Value: bson.M{"usageCount": bson.M{"$ifNull": bson.A{bson.M{"$arrayElemAt": bson.A{"$usage.n", 0}}, 0}}}}},
+		{{Key: "$project", Value: bson.M{"usage": 0}}},
+	}
+}
+
+func publicPreset(presetID primitive.ObjectID) bson.M {
+	return bson.M{"_id": presetID, "isCustom": true, "visibility": models.PresetPublic}
+}
@@ -0,0 +1,275 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"mediaVault-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// PresetThumbnailDim is the long edge of preset thumbnails
+	PresetThumbnailDim = 256
+	// DefaultThumbnailReference is the reference image shown as a preset's
+	// Thumbnail
+	DefaultThumbnailReference = "landscape"
+	// thumbnailQueueSize bounds the presets waiting for new thumbnails;
+	// overflow is caught up on at the next start
+	thumbnailQueueSize = 256
+	// thumbnailTimeout bounds rendering the thumbnails of one preset
+	thumbnailTimeout = time.Minute
+)
+
+// Reference images presets are rendered on for their thumbnails
+//
+//go:embed references/*.jpg
+var referenceFS embed.FS
+
+var (
+	referencesOnce sync.Once
+	references     map[string]*decodedImage
+	referencesErr  error
+
+	thumbnailQuality = 82
+	thumbnailOutput  = models.OutputOptions{Format: "jpeg", Quality: &thumbnailQuality}
+)
+
+// referenceImages returns the embedded reference images by name, decoded
+// and shrunk to thumbnail size
+func referenceImages() (map[string]*decodedImage, error) {
+	referencesOnce.Do(func() {
+		entries, err := referenceFS.ReadDir("references")
+		if err != nil {
+			referencesErr = err
+			return
+		}
+		references = make(map[string]*decodedImage, len(entries))
+		for _, entry := range entries {
+			data, err := referenceFS.ReadFile("references/" + entry.Name())
+			if err != nil {
+				referencesErr = err
+				return
+			}
+			decoded, err := decodeImage(context.Background(), data, "jpeg", 1)
+			if err != nil {
+				referencesErr = fmt.Errorf("failed to decode reference image %s: %w", entry.Name(), err)
+				return
+			}
+			references[strings.TrimSuffix(entry.Name(), path.Ext(entry.Name()))] = fitDecoded(decoded, PresetThumbnailDim)
+		}
+	})
+	return references, referencesErr
+}
+
+// startThumbnailWorker renders thumbnails of queued presets in the
+// background, after bringing every stored preset up to date
+func (fs *FilterService) startThumbnailWorker() {
+	fs.thumbnailQueue = make(chan primitive.ObjectID, thumbnailQueueSize)
+	go func() {
+		fs.refreshPresetThumbnails()
+		for presetID := range fs.thumbnailQueue {
+			ctx, cancel := context.WithTimeout(context.Background(), thumbnailTimeout)
+			if err := fs.generatePresetThumbnails(ctx, presetID); err != nil {
+				log.Printf("Failed to render thumbnails of preset %s: %v", presetID.Hex(), err)
+			}
+			cancel()
+		}
+	}()
+}
+
+// queuePresetThumbnails asks for a preset's thumbnails to be rendered again
+func (fs *FilterService) queuePresetThumbnails(presetID primitive.ObjectID) {
+	select {
+	case fs.thumbnailQueue <- presetID:
+	default:
+		log.Printf("Thumbnail queue full, skipping preset %s", presetID.Hex())
+	}
+}
+
+// refreshPresetThumbnails renders thumbnails of every preset whose config
+// changed since they were last rendered, such as built-ins the catalog sync
+// just rewrote
+func (fs *FilterService) refreshPresetThumbnails() {
+	ctx := context.Background()
+	cursor, err := fs.db.Collection(presetCollection).Find(ctx, bson.M{})
+	if err != nil {
+		log.Printf("Failed to list presets for thumbnails: %v", err)
+		return
+	}
+	var stale []primitive.ObjectID
+	for cursor.Next(ctx) {
+		var preset models.FilterPreset
+		if err := cursor.Decode(&preset); err != nil {
+			continue
+		}
+		if hash, err := presetThumbnailHash(preset.Config); err == nil && hash != preset.ThumbnailHash {
+			stale = append(stale, preset.ID)
+		}
+	}
+	cursor.Close(ctx)
+
+	rendered := 0
+	for _, presetID := range stale {
+		ctx, cancel := context.WithTimeout(context.Background(), thumbnailTimeout)
+		if err := fs.generatePresetThumbnails(ctx, presetID); err != nil {
+			log.Printf("Failed to render thumbnails of preset %s: %v", presetID.Hex(), err)
+		} else {
+			rendered++
+		}
+		cancel()
+	}
+	if rendered > 0 {
+		log.Printf("Rendered thumbnails of %d presets", rendered)
+	}
+}
+
+// generatePresetThumbnails renders a preset on every reference image and
+// stores the results, unless they already match its config. The default
+// one becomes the preset's thumbnail unless a custom one was supplied.
+// Objects of earlier thumbnails are removed.
+func (fs *FilterService) generatePresetThumbnails(ctx context.Context, presetID primitive.ObjectID) error {
+	collection := fs.db.Collection(presetCollection)
+	var preset models.FilterPreset
+	err := collection.FindOne(ctx, bson.M{"_id": presetID}).Decode(&preset)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil // deleted since it was queued
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get preset: %w", err)
+	}
+	hash, err := presetThumbnailHash(preset.Config)
+	if err != nil {
+		return err
+	}
+	if hash == preset.ThumbnailHash {
+		return nil
+	}
+
+	refs, err := referenceImages()
+	if err != nil {
+		return err
+	}
+	assets, err := fs.resolveAssets(ctx, preset.Config)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	thumbnails := make([]models.PresetThumbnail, 0, len(names))
+	keep := map[string]bool{}
+	for _, name := range names {
+		data, _, err := fs.renderDecoded(ctx, refs[name], thumbnailOutput, func(img image.Image) (image.Image, error) {
+			bounds := img.Bounds()
+			return runPipeline(ctx, img, buildPipeline(preset.Config, bounds.Dx(), bounds.Dy(), assets))
+		})
+		if err != nil {
+			return fmt.Errorf("failed to render %s thumbnail: %w", name, err)
+		}
+		object := fmt.Sprintf("%s%s/%s-%s.jpg", presetThumbnailPrefix, preset.ID.Hex(), name, hash)
+		if err := fs.minioSvc.UploadBytes(object, data, "image/jpeg"); err != nil {
+			return err
+		}
+		thumbnails = append(thumbnails, models.PresetThumbnail{Reference: name, Object: object})
+		keep[object] = true
+	}
+
+	set := bson.M{"thumbnails": thumbnails, "thumbnailHash": hash}
+	if preset.CustomThumbnail && preset.Thumbnail != nil {
+		keep[*preset.Thumbnail] = true
+	} else {
+		for _, t := range thumbnails {
+			if t.Reference == DefaultThumbnailReference {
+				set["thumbnail"] = t.Object
+			}
+		}
+	}
+	// Only if the preset and its thumbnails weren't changed meanwhile; an
+	// edit queues its own render
+	filter := bson.M{"_id": preset.ID, "updatedAt": preset.UpdatedAt, "thumbnailHash": preset.ThumbnailHash}
+	if preset.ThumbnailHash == "" {
+		filter["thumbnailHash"] = bson.M{"$exists": false}
+	}
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		return fmt.Errorf("failed to save thumbnails: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return nil // what was uploaded is cleaned up by the next render
+	}
+
+	if err := fs.minioSvc.DeletePrefix(presetThumbnailPrefix+preset.ID.Hex(), func(name string) bool { return !keep[name] }); err != nil {
+		log.Printf("Failed to remove old thumbnails of preset %s: %v", preset.ID.Hex(), err)
+	}
+	return nil
+}
+
+// deletePresetThumbnails removes every thumbnail object of a preset
+func (fs *FilterService) deletePresetThumbnails(presetID primitive.ObjectID) {
+	go func() {
+		if err := fs.minioSvc.DeletePrefix(presetThumbnailPrefix+presetID.Hex(), nil); err != nil {
+			log.Printf("Failed to remove thumbnails of preset %s: %v", presetID.Hex(), err)
+		}
+	}()
+}
+
+// ResolveThumbnailURLs fills in links to a preset's thumbnails
+func (fs *FilterService) ResolveThumbnailURLs(preset *models.FilterPreset) {
+	if preset.Thumbnail != nil {
+		if url, err := fs.minioSvc.GetFileURL(*preset.Thumbnail); err == nil {
+			preset.ThumbnailURL = url
+		}
+	}
+	for i := range preset.Thumbnails {
+		if url, err := fs.minioSvc.GetFileURL(preset.Thumbnails[i].Object); err == nil {
+			preset.Thumbnails[i].URL = url
+		}
+	}
+}
+
+// RenderMediaPreviews renders presets on the user's own media at thumbnail
+// size, with their saved tweaks, for the suggestions panel. Results go
+// through the render cache, so they follow preset and media changes.
+// Presets that can't be rendered are left out.
+func (fs *FilterService) RenderMediaPreviews(ctx context.Context, mediaID, userID primitive.ObjectID, presetIDs []primitive.ObjectID) map[primitive.ObjectID][]byte {
+	previews := make(map[primitive.ObjectID][]byte, len(presetIDs))
+	for _, presetID := range presetIDs {
+		result, err := fs.ApplyFilterPreview(ctx, mediaID, presetID, userID, nil, thumbnailOutput, PresetThumbnailDim)
+		if err != nil {
+			log.Printf("Failed to render preview of preset %s on %s: %v", presetID.Hex(), mediaID.Hex(), err)
+			continue
+		}
+		previews[presetID] = result.Data
+	}
+	return previews
+}
+
+// presetThumbnailHash identifies the look of a config
+func presetThumbnailHash(config models.FilterConfig) (string, error) {
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash preset config: %w", err)
+	}
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:8]), nil
+}
@@ -0,0 +1,245 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"mediaVault-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// renderCacheMemory bounds the in-memory tier of the render cache
+	renderCacheMemory = 256 << 20
+	// renderCachePrefix is where the bucket tier keeps results
+	renderCachePrefix = "render-cache/"
+	// renderIndexPrefix holds an empty marker per stored result, keyed
+	// "<mediaID>/<filterID>/<hash>", so a media item's results can be found
+	// without listing every preset
+	renderIndexPrefix = "render-index/"
+)
+
+// Render cache tiers a result came from
+const (
+	RenderCacheMemory = "memory"
+	RenderCacheBucket = "bucket"
+	RenderCacheMiss   = "miss"
+)
+
+// RenderCacheStats reports how well the render cache is doing
+type RenderCacheStats struct {
+	MemoryHits    int64 `json:"memoryHits"`
+	BucketHits    int64 `json:"bucketHits"`
+	Misses        int64 `json:"misses"`
+	MemoryEntries int   `json:"memoryEntries"`
+	MemoryBytes   int64 `json:"memoryBytes"`
+	MemoryLimit   int64 `json:"memoryLimit"`
+}
+
+// renderCache keeps encoded filter results, in memory and in the bucket.
+// Keys are "<filterID>/<mediaID>/<hash>", where the hash covers the stored
+// content, the effective config and the output options, so a changed
+// original or preset never matches an old entry. Invalidation just reclaims
+// the space, so the bucket tier is cleaned up in the background. Both ways
+// of invalidating are lookups rather than scans: a preset's results share a
+// prefix, and a media item's are indexed separately.
+type renderCache struct {
+	minioSvc *MinioService
+	memory   *lruCache[*cachedRender]
+
+	// byMedia indexes the memory tier's keys by media ID
+	mu      sync.Mutex
+	byMedia map[string]map[string]struct{}
+
+	memoryHits, bucketHits, misses atomic.Int64
+}
+
+type cachedRender struct {
+	data   []byte
+	format string
+}
+
+func newRenderCache(minioSvc *MinioService) *renderCache {
+	rc := &renderCache{
+		minioSvc: minioSvc,
+		memory:   newSizedLRUCache(renderCacheMemory, func(r *cachedRender) int64 { return int64(len(r.data)) }),
+		byMedia:  make(map[string]map[string]struct{}),
+	}
+	rc.memory.onRemove = rc.unindex
+	return rc
+}
+
+// key identifies a render of media with config. maxDim is the preview size,
+// 0 for full resolution. The stored content is identified from the media
+// document alone, so lookups don't touch the bucket.
+func (rc *renderCache) key(media *models.MediaFile, filterID primitive.ObjectID, config models.FilterConfig, output models.OutputOptions, maxDim int) (string, error) {
+	payload, err := json.Marshal(struct {
+		FileName       string               `json:"fileName"`
+		Size           int64                `json:"size"`
+		ContentVersion int                  `json:"contentVersion"`
+		Orientation    int                  `json:"orientation"`
+		Config         models.FilterConfig  `json:"config"`
+		Output         models.OutputOptions `json:"output"`
+		MaxDim         int                  `json:"maxDim"`
+	}{media.WorkingFileName(), media.Size, media.ContentVersion, media.WorkingOrientation(), config, output, maxDim})
+	if err != nil {
+		return "", fmt.Errorf("failed to hash render: %w", err)
+	}
+	sum := sha256.Sum256(payload)
+	return fmt.Sprintf("%s/%s/%s", filterID.Hex(), media.ID.Hex(), hex.EncodeToString(sum[:])), nil
+}
+
+// get looks key up in memory, then in the bucket, and returns the tier it
+// was found in
+func (rc *renderCache) get(key string) (*cachedRender, string) {
+	if r, ok := rc.memory.get(key); ok {
+		rc.memoryHits.Add(1)
+		return r, RenderCacheMemory
+	}
+
+	if r := rc.getStored(key); r != nil {
+		rc.bucketHits.Add(1)
+		rc.remember(key, r)
+		return r, RenderCacheBucket
+	}
+
+	rc.misses.Add(1)
+	return nil, RenderCacheMiss
+}
+
+func (rc *renderCache) getStored(key string) *cachedRender {
+	info, err := rc.minioSvc.GetFileInfo(renderCachePrefix + key)
+	if err != nil {
+		return nil
+	}
+	reader, err := rc.minioSvc.GetFileContent(renderCachePrefix + key)
+	if err != nil {
+		return nil
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil
+	}
+	return &cachedRender{data: data, format: normalizeFormat(strings.TrimPrefix(info.ContentType, "image/"))}
+}
+
+// put stores a render in memory right away and in the bucket in the
+// background
+func (rc *renderCache) put(key string, data []byte, format string) {
+	rc.remember(key, &cachedRender{data: data, format: format})
+	go func() {
+		if err := rc.minioSvc.UploadBytes(renderCachePrefix+key, data, MimeTypeForFormat(format)); err != nil {
+			log.Printf("Failed to store cached render %s: %v", key, err)
+			return
+		}
+		if err := rc.minioSvc.UploadBytes(renderIndexName(key), nil, "application/octet-stream"); err != nil {
+			log.Printf("Failed to index cached render %s: %v", key, err)
+		}
+	}()
+}
+
+// remember keeps a render in the memory tier and indexes it by media
+func (rc *renderCache) remember(key string, r *cachedRender) {
+	mediaID := renderKeyMedia(key)
+	rc.mu.Lock()
+	keys := rc.byMedia[mediaID]
+	if keys == nil {
+		keys = make(map[string]struct{})
+		rc.byMedia[mediaID] = keys
+	}
+	keys[key] = struct{}{}
+	rc.mu.Unlock()
+
+	rc.memory.put(key, r)
+}
+
+// unindex forgets a key that left the memory tier
+func (rc *renderCache) unindex(key string) {
+	mediaID := renderKeyMedia(key)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if keys := rc.byMedia[mediaID]; keys != nil {
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(rc.byMedia, mediaID)
+		}
+	}
+}
+
+// renderKeyMedia returns the media ID part of a key
+func renderKeyMedia(key string) string {
+	_, rest, _ := strings.Cut(key, "/")
+	mediaID, _, _ := strings.Cut(rest, "/")
+	return mediaID
+}
+
+// renderIndexName is the marker of a stored render under renderIndexPrefix
+func renderIndexName(key string) string {
+	filterID, rest, _ := strings.Cut(key, "/")
+	mediaID, hash, _ := strings.Cut(rest, "/")
+	return renderIndexPrefix + mediaID + "/" + filterID + "/" + hash
+}
+
+// invalidateMedia drops every cached render of a media item, found through
+// the media index of each tier
+func (rc *renderCache) invalidateMedia(mediaID primitive.ObjectID) {
+	rc.mu.Lock()
+	keys := rc.byMedia[mediaID.Hex()]
+	delete(rc.byMedia, mediaID.Hex())
+	rc.mu.Unlock()
+	for key := range keys {
+		rc.memory.delete(key)
+	}
+
+	go func() {
+		prefix := renderIndexPrefix + mediaID.Hex() + "/"
+		markers, err := rc.minioSvc.ListPrefix(prefix)
+		if err != nil {
+			log.Printf("Failed to drop cached renders of %s: %v", mediaID.Hex(), err)
+			return
+		}
+		for _, marker := range markers {
+			filterID, hash, _ := strings.Cut(strings.TrimPrefix(marker, prefix), "/")
+			if err := rc.minioSvc.DeleteFile(renderCachePrefix + filterID + "/" + mediaID.Hex() + "/" + hash); err != nil {
+				log.Printf("Failed to drop cached render of %s: %v", mediaID.Hex(), err)
+				continue
+			}
+			_ = rc.minioSvc.DeleteFile(marker)
+		}
+	}()
+}
+
+// invalidateFilter drops every cached render made with a preset. Its
+// markers in the media index are left to be cleared with the media, as
+// deleting a missing render is harmless.
+func (rc *renderCache) invalidateFilter(filterID primitive.ObjectID) {
+	prefix := filterID.Hex() + "/"
+	rc.memory.removeIf(func(key string) bool { return strings.HasPrefix(key, prefix) })
+	go func() {
+		if err := rc.minioSvc.DeletePrefix(renderCachePrefix+prefix, nil); err != nil {
+			log.Printf("Failed to drop cached renders of preset %s: %v", filterID.Hex(), err)
+		}
+	}()
+}
+
+func (rc *renderCache) stats() RenderCacheStats {
+	entries, bytes := rc.memory.usage()
+	return RenderCacheStats{
+		MemoryHits:    rc.memoryHits.Load(),
+		BucketHits:    rc.bucketHits.Load(),
+		Misses:        rc.misses.Load(),
+		MemoryEntries: entries,
+		MemoryBytes:   bytes,
+		MemoryLimit:   renderCacheMemory,
+	}
+}
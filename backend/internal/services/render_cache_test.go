@@ -0,0 +1,31 @@
+package services
+
+import (
+	"testing"
+)
+
+// Keys leaving the memory tier, by eviction or deletion, leave the media
+// index too
+func TestRenderCacheMediaIndex(t *testing.T) {
+	rc := newRenderCache(nil)
+	keys := []string{"f1/m1/a", "f2/m1/b", "f1/m2/c"}
+	for _, key := range keys {
+		rc.remember(key, &cachedRender{data: []byte{1}, format: "png"})
+	}
+	if got := renderIndexName("f1/m2/c"); got != renderIndexPrefix+"m2/f1/c" {
+		t.Errorf("renderIndexName = %q", got)
+	}
+	if len(rc.byMedia["m1"]) != 2 || len(rc.byMedia["m2"]) != 1 {
+		t.Fatalf("byMedia = %v", rc.byMedia)
+	}
+
+	rc.memory.delete("f1/m2/c")
+	if _, ok := rc.byMedia["m2"]; ok {
+		t.Errorf("m2 still indexed: %v", rc.byMedia)
+	}
+
+	rc.memory.removeIf(func(key string) bool { return key == "f2/m1/b" })
+	if _, ok := rc.byMedia["m1"]["f2/m1/b"]; ok || len(rc.byMedia["m1"]) != 1 {
+		t.Errorf("m1 index = %v", rc.byMedia["m1"])
+	}
+}
@@ -0,0 +1,290 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"math"
+	"mime/multipart"
+	"regexp"
+	"strings"
+
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+)
+
+const (
+	// maxSVGSize bounds how much markup is parsed and sanitized
+	maxSVGSize = 10 << 20
+	// svgRasterSize is the longest side of the PNG preview rendered for SVGs
+	svgRasterSize = 2048
+
+	// SVGContentSecurityPolicy is sent whenever an SVG is served directly, so
+	// anything the sanitizer missed still can't run scripts or load resources
+	SVGContentSecurityPolicy = "default-src 'none'; style-src 'unsafe-inline'; img-src data:; sandbox"
+)
+
+// svgBlockedElements are removed together with their content
+var svgBlockedElements = map[string]bool{
+	"script":        true,
+	"foreignobject": true,
+	"iframe":        true,
+	"embed":         true,
+	"object":        true,
+	"audio":         true,
+	"video":         true,
+	"handler":       true,
+	"listener":      true,
+}
+
+// svgHrefAttributes may only reference fragments inside the document or
+// inline raster data. They are matched on the local name, since any prefix
+// can be bound to the XLink namespace.
+var svgHrefAttributes = map[string]bool{
+	"href": true,
+	"src":  true,
+}
+
+var (
+	svgURLPattern      = regexp.MustCompile(`(?i)url\s*\(\s*['"]?\s*([^'")\s]*)\s*['"]?\s*\)`)
+	svgImportPattern   = regexp.MustCompile(`(?i)@import[^;]*;?`)
+	svgDataImagePrefix = regexp.MustCompile(`(?i)^data:image/(png|jpeg|gif|webp);`)
+)
+
+// IsSVGUpload reports whether an upload is an SVG document. The markup is
+// sniffed too, since the client-supplied content type can't be trusted.
+func IsSVGUpload(file *multipart.FileHeader) bool {
+	if strings.Contains(file.Header.Get("Content-Type"), "svg") || strings.HasSuffix(strings.ToLower(file.Filename), ".svg") {
+		return true
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return false
+	}
+	defer src.Close()
+
+	head := make([]byte, 1024)
+	n, _ := io.ReadFull(src, head)
+	return isSVGData(head[:n])
+}
+
+// ReadSanitizedSVG reads an SVG upload and returns its sanitized markup
+func ReadSanitizedSVG(file *multipart.FileHeader) ([]byte, error) {
+	src, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload: %w", err)
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(io.LimitReader(src, maxSVGSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload: %w", err)
+	}
+	if len(data) > maxSVGSize {
+		return nil, fmt.Errorf("SVG exceeds the %d MB limit", maxSVGSize>>20)
+	}
+
+	return SanitizeSVG(data)
+}
+
+// SanitizeSVG strips everything that can execute script or pull in external
+// content: script-like elements, event handler attributes, javascript: and
+// remote references, DOCTYPE/entity declarations and stylesheet imports.
+// Sanitizing already sanitized markup returns it unchanged.
+func SanitizeSVG(data []byte) ([]byte, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = true
+
+	var out bytes.Buffer
+	skipDepth := 0
+	inStyle := false
+	sawSVG := false
+
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid SVG: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if skipDepth > 0 {
+				skipDepth++
+				continue
+			}
+			name := strings.ToLower(t.Name.Local)
+			if svgBlockedElements[name] || isUnsafeAnimation(t) {
+				skipDepth = 1
+				continue
+			}
+			if name == "svg" {
+				sawSVG = true
+			}
+			inStyle = name == "style"
+			writeSVGStart(&out, t)
+
+		case xml.EndElement:
+			if skipDepth > 0 {
+				skipDepth--
+				continue
+			}
+			inStyle = false
+			out.WriteString("</" + svgQualifiedName(t.Name) + ">")
+
+		case xml.CharData:
+			if skipDepth > 0 {
+				continue
+			}
+			text := []byte(t)
+			if inStyle {
+				text = []byte(sanitizeSVGStyle(string(t)))
+			}
+			_ = xml.EscapeText(&out, text)
+
+		case xml.ProcInst:
+			// Keep the XML declaration; stylesheet PIs can load external CSS
+			if skipDepth == 0 && t.Target == "xml" {
+				out.WriteString("<?xml " + string(t.Inst) + "?>")
+			}
+
+		case xml.Comment, xml.Directive:
+			// Comments are dropped; DOCTYPE and entity declarations are never needed
+		}
+	}
+
+	if !sawSVG {
+		return nil, fmt.Errorf("invalid SVG: no <svg> element")
+	}
+
+	return out.Bytes(), nil
+}
+
+// isUnsafeAnimation catches <set>/<animate> elements that rewrite links or
+// event handlers at runtime
+func isUnsafeAnimation(el xml.StartElement) bool {
+	switch strings.ToLower(el.Name.Local) {
+	case "set", "animate", "animatetransform", "animatemotion":
+	default:
+		return false
+	}
+	for _, attr := range el.Attr {
+		if strings.ToLower(attr.Name.Local) != "attributename" {
+			continue
+		}
+		target := strings.ToLower(strings.TrimSpace(attr.Value))
+		if strings.HasSuffix(target, "href") || strings.HasPrefix(target, "on") {
+			return true
+		}
+	}
+	return false
+}
+
+func writeSVGStart(out *bytes.Buffer, el xml.StartElement) {
+	out.WriteString("<" + svgQualifiedName(el.Name))
+	for _, attr := range el.Attr {
+		value, ok := sanitizeSVGAttr(attr)
+		if !ok {
+			continue
+		}
+		out.WriteString(" " + svgQualifiedName(attr.Name) + `="`)
+		_ = xml.EscapeText(out, []byte(value))
+		out.WriteString(`"`)
+	}
+	out.WriteString(">")
+}
+
+// sanitizeSVGAttr returns the value to keep for attr, or false to drop it
+func sanitizeSVGAttr(attr xml.Attr) (string, bool) {
+	local := strings.ToLower(attr.Name.Local)
+	value := attr.Value
+
+	if strings.HasPrefix(local, "on") {
+		return "", false
+	}
+	if svgHrefAttributes[local] {
+		return value, isSafeSVGReference(value)
+	}
+	if local == "style" {
+		value = sanitizeSVGStyle(value)
+		return value, value != ""
+	}
+	// Presentation attributes such as fill="url(...)" may only point inside the document
+	for _, match := range svgURLPattern.FindAllStringSubmatch(value, -1) {
+		if !isSafeSVGReference(match[1]) {
+			return "", false
+		}
+	}
+	return value, true
+}
+
+// sanitizeSVGStyle removes @import rules and external url() references from CSS
+func sanitizeSVGStyle(css string) string {
+	css = svgImportPattern.ReplaceAllString(css, "")
+	css = svgURLPattern.ReplaceAllStringFunc(css, func(match string) string {
+		ref := svgURLPattern.FindStringSubmatch(match)[1]
+		if isSafeSVGReference(ref) {
+			return match
+		}
+		return "none"
+	})
+	if strings.Contains(strings.ToLower(css), "expression(") {
+		return ""
+	}
+	return css
+}
+
+// isSafeSVGReference allows in-document fragments and inline raster images
+func isSafeSVGReference(ref string) bool {
+	ref = strings.TrimSpace(ref)
+	return strings.HasPrefix(ref, "#") || svgDataImagePrefix.MatchString(ref)
+}
+
+func svgQualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+// rasterizeSVG renders sanitized SVG markup to an image whose longest side is
+// svgRasterSize, using rsvg-convert when installed and oksvg otherwise
+func rasterizeSVG(ctx context.Context, data []byte) (image.Image, error) {
+	icon, err := oksvg.ReadIconStream(bytes.NewReader(data), oksvg.IgnoreErrorMode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SVG: %w", err)
+	}
+	width, height := svgRasterDimensions(icon.ViewBox.W, icon.ViewBox.H)
+
+	if tool, ok := lookupImageTool("rsvg-convert", "RSVG_CONVERT_PATH"); ok {
+		args := []string{"-f", "png", "-w", fmt.Sprint(width), "-h", fmt.Sprint(height)}
+		converted, err := runImageTool(ctx, tool, args, data)
+		if err == nil {
+			if img, err := png.Decode(bytes.NewReader(converted)); err == nil {
+				return img, nil
+			}
+		}
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	icon.SetTarget(0, 0, float64(width), float64(height))
+	scanner := rasterx.NewScannerGV(width, height, img, img.Bounds())
+	icon.Draw(rasterx.NewDasher(width, height, scanner), 1)
+	return img, nil
+}
+
+// svgRasterDimensions scales the viewBox so its longest side is svgRasterSize
+func svgRasterDimensions(w, h float64) (int, int) {
+	if w <= 0 || h <= 0 {
+		return svgRasterSize, svgRasterSize
+	}
+	scale := svgRasterSize / math.Max(w, h)
+	return max(1, int(math.Round(w*scale))), max(1, int(math.Round(h*scale)))
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeSVGReferences(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		blocked string
+		kept    string
+	}{
+		{
+			name:    "href",
+			input:   `<svg xmlns="http://www.w3.org/2000/svg"><a href="javascript:alert(1)"><rect/></a></svg>`,
+			blocked: "javascript:",
+		},
+		{
+			name:    "xlink href",
+			input:   `<svg xmlns:xlink="http://www.w3.org/1999/xlink"><a xlink:href="javascript:alert(1)"><rect/></a></svg>`,
+			blocked: "javascript:",
+		},
+		{
+			name:    "xlink href under another prefix",
+			input:   `<svg xmlns:foo="http://www.w3.org/1999/xlink"><a foo:href="javascript:alert(1)"><rect/></a></svg>`,
+			blocked: "javascript:",
+		},
+		{
+			name:    "prefixed src",
+			input:   `<svg xmlns:foo="http://example.com/ns"><image foo:src="https://example.com/x.png"/></svg>`,
+			blocked: "example.com/x.png",
+		},
+		{
+			name:  "fragment",
+			input: `<svg xmlns:foo="http://www.w3.org/1999/xlink"><use foo:href="#shape"/></svg>`,
+			kept:  `foo:href="#shape"`,
+		},
+		{
+			name:  "inline raster",
+			input: `<svg><image href="data:image/png;base64,AAAA"/></svg>`,
+			kept:  `href="data:image/png;base64,AAAA"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := SanitizeSVG([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("SanitizeSVG: %v", err)
+			}
+			if tt.blocked != "" && strings.Contains(string(out), tt.blocked) {
+				t.Errorf("output still contains %q: %s", tt.blocked, out)
+			}
+			if tt.kept != "" && !strings.Contains(string(out), tt.kept) {
+				t.Errorf("output lost %q: %s", tt.kept, out)
+			}
+		})
+	}
+}
+
+func TestSanitizeSVGIdempotent(t *testing.T) {
+	input := `<svg xmlns:foo="http://www.w3.org/1999/xlink"><use foo:href="#a" onload="x()"/><a foo:href="javascript:x()"/></svg>`
+	once, err := SanitizeSVG([]byte(input))
+	if err != nil {
+		t.Fatalf("SanitizeSVG: %v", err)
+	}
+	twice, err := SanitizeSVG(once)
+	if err != nil {
+		t.Fatalf("SanitizeSVG: %v", err)
+	}
+	if string(once) != string(twice) {
+		t.Errorf("second pass changed output:\n%s\n%s", once, twice)
+	}
+}
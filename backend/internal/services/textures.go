@@ -0,0 +1,65 @@
+package services
+
+import (
+	"embed"
+	"fmt"
+	"image"
+	"image/png"
+	"sync"
+)
+
+// Tileable grayscale textures used by the overlay effects
+//
+//go:embed textures/*.png
+var textureFS embed.FS
+
+// texture is a tileable grayscale texture with values in 0..1
+type texture struct {
+	w, h int
+	pix  []float32
+}
+
+var (
+	textureMu    sync.Mutex
+	textureCache = make(map[string]*texture)
+)
+
+// loadTexture returns an embedded texture by name (e.g. "watercolor")
+func loadTexture(name string) (*texture, error) {
+	textureMu.Lock()
+	defer textureMu.Unlock()
+
+	if t, ok := textureCache[name]; ok {
+		return t, nil
+	}
+
+	f, err := textureFS.Open("textures/" + name + ".png")
+	if err != nil {
+		return nil, fmt.Errorf("unknown texture %q", name)
+	}
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode texture %q: %w", name, err)
+	}
+
+	gray, ok := img.(*image.Gray)
+	if !ok {
+		return nil, fmt.Errorf("texture %q is not grayscale", name)
+	}
+
+	t := &texture{w: gray.Rect.Dx(), h: gray.Rect.Dy(), pix: make([]float32, len(gray.Pix))}
+	for i, v := range gray.Pix {
+		t.pix[i] = float32(v) / 255
+	}
+	textureCache[name] = t
+	return t, nil
+}
+
+// at samples the texture tiled across the image, scaled up by scale
+func (t *texture) at(x, y int, scale float64) float32 {
+	tx := int(float64(x)/scale) % t.w
+	ty := int(float64(y)/scale) % t.h
+	return t.pix[ty*t.w+tx]
+}
@@ -0,0 +1,375 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"mediaVault-backend/internal/models"
+)
+
+const (
+	maxCurvePoints = 16
+	// toneTableSize is the resolution of the per-channel lookup tables the
+	// levels and curves are baked into
+	toneTableSize = 1024
+)
+
+// hslBands are the mixer bands with the hue (degrees) each is centered on
+var hslBands = []struct {
+	name   string
+	center float32
+}{
+	{models.HSLReds, 0},
+	{models.HSLOranges, 30},
+	{models.HSLYellows, 60},
+	{models.HSLGreens, 120},
+	{models.HSLAquas, 180},
+	{models.HSLBlues, 240},
+	{models.HSLPurples, 270},
+	{models.HSLMagentas, 300},
+}
+
+// toneOp builds the levels, curves and HSL adjustments of config as a single
+// per-pixel function, or nil when none are set. Levels and curves are 1D per
+// channel, so they are composed into one lookup table per channel.
+func toneOp(config models.FilterConfig) func(px *[4]float32) {
+	tables := toneTables(config.Levels, config.Curves)
+	mixer := hslMixer(config.HSL)
+	if tables == nil && mixer == nil {
+		return nil
+	}
+
+	return func(px *[4]float32) {
+		if tables != nil {
+			for c := 0; c < 3; c++ {
+				px[c] = tables[c].at(px[c])
+			}
+		}
+		if mixer != nil {
+			mixer(px)
+		}
+	}
+}
+
+// toneTable samples a 0..1 -> 0..1 tone mapping at toneTableSize+1 points
+type toneTable []float32
+
+func newToneTable(fn func(v float64) float64) toneTable {
+	t := make(toneTable, toneTableSize+1)
+	for i := range t {
+		t[i] = float32(clampParam(fn(float64(i)/toneTableSize), 0, 1))
+	}
+	return t
+}
+
+func (t toneTable) at(v float32) float32 {
+	p := clampUnit(v) * toneTableSize
+	i := int(p)
+	if i >= toneTableSize {
+		return t[toneTableSize]
+	}
+	return t[i] + (t[i+1]-t[i])*(p-float32(i))
+}
+
+func toneTables(levels *models.LevelsConfig, curves *models.ToneCurves) *[3]toneTable {
+	var steps []func(float64) float64
+	if fn := levelsFunc(levels); fn != nil {
+		steps = append(steps, fn)
+	}
+	var channel [3]func(float64) float64
+	if curves != nil {
+		if fn := curveFunc(curves.RGB); fn != nil {
+			steps = append(steps, fn)
+		}
+		channel = [3]func(float64) float64{curveFunc(curves.Red), curveFunc(curves.Green), curveFunc(curves.Blue)}
+	}
+	if len(steps) == 0 && channel[0] == nil && channel[1] == nil && channel[2] == nil {
+		return nil
+	}
+
+	var tables [3]toneTable
+	for c := range tables {
+		fns := steps
+		if channel[c] != nil {
+			fns = append(fns[:len(fns):len(fns)], channel[c])
+		}
+		tables[c] = newToneTable(func(v float64) float64 {
+			for _, fn := range fns {
+				v = fn(v)
+			}
+			return v
+		})
+	}
+	return &tables
+}
+
+// levelsFunc maps input black/white to output black/white through gamma,
+// or returns nil when levels are unset or neutral
+func levelsFunc(l *models.LevelsConfig) func(float64) float64 {
+	if l == nil {
+		return nil
+	}
+	inBlack, inWhite := optFloat(l.InputBlack, 0)/255, optFloat(l.InputWhite, 255)/255
+	outBlack, outWhite := optFloat(l.OutputBlack, 0)/255, optFloat(l.OutputWhite, 255)/255
+	gamma := optFloat(l.Gamma, 1)
+	if inBlack == 0 && inWhite == 1 && outBlack == 0 && outWhite == 1 && gamma == 1 {
+		return nil
+	}
+
+	return func(v float64) float64 {
+		v = clampParam((v-inBlack)/(inWhite-inBlack), 0, 1)
+		v = math.Pow(v, 1/gamma)
+		return outBlack + v*(outWhite-outBlack)
+	}
+}
+
+// curveFunc interpolates the control points with a monotone cubic spline
+// (Fritsch-Carlson), so the curve never overshoots between points. Tones
+// outside the first and last point hold their values. Returns nil for an
+// empty curve.
+func curveFunc(points []models.CurvePoint) func(float64) float64 {
+	if len(points) < 2 {
+		return nil
+	}
+	sorted := append([]models.CurvePoint(nil), points...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].X < sorted[j].X })
+
+	n := len(sorted)
+	xs, ys := make([]float64, n), make([]float64, n)
+	for i, p := range sorted {
+		xs[i], ys[i] = p.X/255, p.Y/255
+	}
+
+	// Secant slopes, then tangents limited to keep each segment monotone
+	delta := make([]float64, n-1)
+	for i := range delta {
+		delta[i] = (ys[i+1] - ys[i]) / (xs[i+1] - xs[i])
+	}
+	m := make([]float64, n)
+	m[0], m[n-1] = delta[0], delta[n-2]
+	for i := 1; i < n-1; i++ {
+		if delta[i-1]*delta[i] <= 0 {
+			m[i] = 0
+		} else {
+			m[i] = (delta[i-1] + delta[i]) / 2
+		}
+	}
+	for i, d := range delta {
+		if d == 0 {
+			m[i], m[i+1] = 0, 0
+			continue
+		}
+		a, b := m[i]/d, m[i+1]/d
+		if s := a*a + b*b; s > 9 {
+			t := 3 / math.Sqrt(s)
+			m[i], m[i+1] = t*a*d, t*b*d
+		}
+	}
+
+	return func(v float64) float64 {
+		if v <= xs[0] {
+			return ys[0]
+		}
+		if v >= xs[n-1] {
+			return ys[n-1]
+		}
+		i := sort.SearchFloat64s(xs, v) - 1
+		h := xs[i+1] - xs[i]
+		t := (v - xs[i]) / h
+		t2, t3 := t*t, t*t*t
+		return (2*t3-3*t2+1)*ys[i] + (t3-2*t2+t)*h*m[i] + (-2*t3+3*t2)*ys[i+1] + (t3-t2)*h*m[i+1]
+	}
+}
+
+// hslMixer adjusts hue, saturation and luminance per color band. A pixel's
+// hue blends the two nearest bands, and every change scales with its
+// saturation so neutral tones are left alone. Returns nil when no band
+// changes anything.
+func hslMixer(adjustments map[string]models.HSLAdjustment) func(px *[4]float32) {
+	var hue, sat, lum [8]float32
+	active := false
+	for i, band := range hslBands {
+		adj, ok := adjustments[band.name]
+		if !ok {
+			continue
+		}
+		// Full scale: ±30° of hue, saturation from gray to doubled, and
+		// half the distance to black or white
+		hue[i] = float32(optFloat(adj.Hue, 0) / 100 * 30)
+		sat[i] = float32(optFloat(adj.Saturation, 0) / 100)
+		lum[i] = float32(optFloat(adj.Luminance, 0) / 100 * 0.5)
+		active = active || hue[i] != 0 || sat[i] != 0 || lum[i] != 0
+	}
+	if !active {
+		return nil
+	}
+
+	return func(px *[4]float32) {
+		h, s, l := rgbToHSL(px[0], px[1], px[2])
+		if s == 0 {
+			return
+		}
+
+		// Find the bands either side of h and blend them with a cosine ramp
+		n := len(hslBands)
+		i := n - 1
+		for j := 0; j < n; j++ {
+			if hslBands[j].center > h {
+				i = j - 1
+				break
+			}
+		}
+		lo, hi := hslBands[i].center, float32(360)
+		if i+1 < n {
+			hi = hslBands[i+1].center
+		}
+		t := (h - lo) / (hi - lo)
+		wHi := (1 - float32(math.Cos(float64(t)*math.Pi))) / 2
+		wLo := 1 - wHi
+		next := (i + 1) % n
+
+		dh := wLo*hue[i] + wHi*hue[next]
+		ds := wLo*sat[i] + wHi*sat[next]
+		dl := (wLo*lum[i] + wHi*lum[next]) * s
+
+		h = float32(math.Mod(float64(h+dh)+360, 360))
+		s = clampUnit(s * (1 + ds))
+		if dl > 0 {
+			l += (1 - l) * dl
+		} else {
+			l += l * dl
+		}
+		px[0], px[1], px[2] = hslToRGB(h, s, l)
+	}
+}
+
+// rgbToHSL returns hue in degrees and saturation and lightness in 0..1
+func rgbToHSL(r, g, b float32) (h, s, l float32) {
+	r, g, b = clampUnit(r), clampUnit(g), clampUnit(b)
+	hi, lo := max(r, g, b), min(r, g, b)
+	l = (hi + lo) / 2
+	d := hi - lo
+	if d == 0 {
+		return 0, 0, l
+	}
+	if l > 0.5 {
+		s = d / (2 - hi - lo)
+	} else {
+		s = d / (hi + lo)
+	}
+	switch hi {
+	case r:
+		h = (g - b) / d
+		if g < b {
+			h += 6
+		}
+	case g:
+		h = (b-r)/d + 2
+	default:
+		h = (r-g)/d + 4
+	}
+	return h * 60, s, l
+}
+
+func hslToRGB(h, s, l float32) (float32, float32, float32) {
+	if s == 0 {
+		return l, l, l
+	}
+	var q float32
+	if l < 0.5 {
+		q = l * (1 + s)
+	} else {
+		q = l + s - l*s
+	}
+	p := 2*l - q
+	hk := h / 360
+	channel := func(t float32) float32 {
+		if t < 0 {
+			t++
+		} else if t > 1 {
+			t--
+		}
+		switch {
+		case t < 1.0/6:
+			return p + (q-p)*6*t
+		case t < 0.5:
+			return q
+		case t < 2.0/3:
+			return p + (q-p)*(2.0/3-t)*6
+		}
+		return p
+	}
+	return channel(hk + 1.0/3), channel(hk), channel(hk - 1.0/3)
+}
+
+// validateTone rejects levels, curves and HSL settings that can't be applied
+func validateTone(config models.FilterConfig) error {
+	if l := config.Levels; l != nil {
+		for name, v := range map[string]*float64{
+			"inputBlack": l.InputBlack, "inputWhite": l.InputWhite,
+			"outputBlack": l.OutputBlack, "outputWhite": l.OutputWhite,
+		} {
+			if v != nil && (*v < 0 || *v > 255) {
+				return fmt.Errorf("levels.%s must be between 0 and 255", name)
+			}
+		}
+		if optFloat(l.InputBlack, 0) >= optFloat(l.InputWhite, 255) {
+			return fmt.Errorf("levels.inputBlack must be below levels.inputWhite")
+		}
+		if l.Gamma != nil && (*l.Gamma < 0.1 || *l.Gamma > 10) {
+			return fmt.Errorf("levels.gamma must be between 0.1 and 10")
+		}
+	}
+
+	if c := config.Curves; c != nil {
+		for name, points := range map[string][]models.CurvePoint{"rgb": c.RGB, "red": c.Red, "green": c.Green, "blue": c.Blue} {
+			if err := validateCurve(points); err != nil {
+				return fmt.Errorf("curves.%s: %w", name, err)
+			}
+		}
+	}
+
+	for name, adj := range config.HSL {
+		known := false
+		for _, band := range hslBands {
+			known = known || band.name == name
+		}
+		if !known {
+			return fmt.Errorf("hsl: unknown band %q", name)
+		}
+		for field, v := range map[string]*float64{"hue": adj.Hue, "saturation": adj.Saturation, "luminance": adj.Luminance} {
+			if v != nil && (*v < -100 || *v > 100) {
+				return fmt.Errorf("hsl.%s.%s must be between -100 and 100", name, field)
+			}
+		}
+	}
+	return nil
+}
+
+func validateCurve(points []models.CurvePoint) error {
+	if len(points) == 0 {
+		return nil
+	}
+	if len(points) < 2 || len(points) > maxCurvePoints {
+		return fmt.Errorf("needs between 2 and %d points", maxCurvePoints)
+	}
+	seen := make(map[float64]bool, len(points))
+	for _, p := range points {
+		if p.X < 0 || p.X > 255 || p.Y < 0 || p.Y > 255 {
+			return fmt.Errorf("points must be between 0 and 255")
+		}
+		if seen[p.X] {
+			return fmt.Errorf("duplicate point at x=%g", p.X)
+		}
+		seen[p.X] = true
+	}
+	return nil
+}
+
+func optFloat(v *float64, def float64) float64 {
+	if v == nil {
+		return def
+	}
+	return *v
+}
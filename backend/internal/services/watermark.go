@@ -0,0 +1,246 @@
+package services
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	maxWatermarkText = 200
+	// maxLogoWidth bounds decoded logos kept in memory; they are scaled
+	// down to a fraction of the image anyway
+	maxLogoWidth = 1024
+)
+
+// watermarkAnchors maps anchor names to their position as fractions of the
+// free space around the mark
+var watermarkAnchors = map[string][2]float64{
+	"top-left":     {0, 0},
+	"top":          {0.5, 0},
+	"top-right":    {1, 0},
+	"left":         {0, 0.5},
+	"center":       {0.5, 0.5},
+	"right":        {1, 0.5},
+	"bottom-left":  {0, 1},
+	"bottom":       {0.5, 1},
+	"bottom-right": {1, 1},
+}
+
+// watermarkFonts are the embedded TrueType fonts text marks can use
+var watermarkFonts = map[string][]byte{
+	"regular": goregular.TTF,
+	"bold":    gobold.TTF,
+}
+
+var (
+	parsedFontsMu sync.Mutex
+	parsedFonts   = make(map[string]*opentype.Font)
+)
+
+// applyWatermark draws a logo or a line of text onto the image.
+// Params: text or logo (media ID), font ("regular", "bold"), color (hex, text
+// only), anchor ("bottom-right" etc.), offsetX and offsetY (fractions of the
+// image width, inwards from the anchored edges), opacity (0-1), scale (mark
+// width as a fraction of the image width), tiled (repeat across the image)
+// and spacing (gap between tiles, fraction of the image width).
+func applyWatermark(buf *rgbBuffer, params map[string]interface{}, assets *renderAssets) {
+	opacity := float32(clampParam(paramFloat(params, "opacity", 0.5), 0, 1))
+	scale := clampParam(paramFloat(params, "scale", 0.2), 0.01, 1)
+	if opacity == 0 {
+		return
+	}
+
+	markWidth := max(1, int(math.Round(scale*float64(buf.w))))
+	var mark *image.NRGBA
+	if ref := paramString(params, "logo", ""); ref != "" {
+		logo := assets.logos[ref]
+		if logo == nil {
+			return
+		}
+		mark = scaleToWidth(logo, markWidth)
+	} else {
+		mark = renderWatermarkText(paramString(params, "text", ""), paramString(params, "font", "bold"),
+			parseHexColor(paramString(params, "color", "#ffffff"), [3]float32{1, 1, 1}), markWidth)
+	}
+	if mark == nil {
+		return
+	}
+
+	mw, mh := mark.Rect.Dx(), mark.Rect.Dy()
+	offsetX := paramFloat(params, "offsetX", 0.02) * float64(buf.w)
+	offsetY := paramFloat(params, "offsetY", 0.02) * float64(buf.w)
+
+	if paramBool(params, "tiled", false) {
+		gap := clampParam(paramFloat(params, "spacing", 0.1), 0, 1) * float64(buf.w)
+		stepX, stepY := mw+int(gap), mh+int(gap)
+		for y := int(offsetY) % stepY; y < buf.h; y += stepY {
+			for x := int(offsetX) % stepX; x < buf.w; x += stepX {
+				compositeMark(buf, mark, x, y, opacity)
+			}
+		}
+		return
+	}
+
+	anchor, ok := watermarkAnchors[paramString(params, "anchor", "bottom-right")]
+	if !ok {
+		anchor = watermarkAnchors["bottom-right"]
+	}
+	x := anchor[0]*float64(buf.w-mw) + (1-2*anchor[0])*offsetX
+	y := anchor[1]*float64(buf.h-mh) + (1-2*anchor[1])*offsetY
+	compositeMark(buf, mark, int(math.Round(x)), int(math.Round(y)), opacity)
+}
+
+// compositeMark draws mark with its top-left corner at x, y, source-over
+func compositeMark(buf *rgbBuffer, mark *image.NRGBA, x, y int, opacity float32) {
+	area := image.Rect(x, y, x+mark.Rect.Dx(), y+mark.Rect.Dy()).Intersect(image.Rect(0, 0, buf.w, buf.h))
+	if area.Empty() {
+		return
+	}
+
+	parallelFor(area.Dy(), func(r0, r1 int) {
+		for by := area.Min.Y + r0; by < area.Min.Y+r1; by++ {
+			row := mark.Pix[(by-y)*mark.Stride:]
+			for bx := area.Min.X; bx < area.Max.X; bx++ {
+				m := row[(bx-x)*4:]
+				a := float32(m[3]) / 255 * opacity
+				if a == 0 {
+					continue
+				}
+				i := by*buf.w + bx
+				for c := 0; c < 3; c++ {
+					buf.pix[i*3+c] += (float32(m[c])/255 - buf.pix[i*3+c]) * a
+				}
+				ba := float32(buf.alpha[i]) / 255
+				buf.alpha[i] = toByte(a + ba*(1-a))
+			}
+		}
+	})
+}
+
+// renderWatermarkText renders text in an embedded font, sized so the line
+// is width pixels wide
+func renderWatermarkText(text, fontName string, rgb [3]float32, width int) *image.NRGBA {
+	text = strings.TrimSpace(text)
+	f, err := loadWatermarkFont(fontName)
+	if text == "" || err != nil {
+		return nil
+	}
+
+	// Measure at a reference size, then scale to the requested width
+	const refSize = 100
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: refSize, DPI: 72, Hinting: font.HintingNone})
+	if err != nil {
+		return nil
+	}
+	advance := font.MeasureString(face, text).Ceil()
+	face.Close()
+	if advance == 0 {
+		return nil
+	}
+
+	size := refSize * float64(width) / float64(advance)
+	face, err = opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingNone})
+	if err != nil {
+		return nil
+	}
+	defer face.Close()
+
+	metrics := face.Metrics()
+	w := font.MeasureString(face, text).Ceil()
+	h := (metrics.Ascent + metrics.Descent).Ceil()
+	if w <= 0 || h <= 0 {
+		return nil
+	}
+
+	mark := image.NewNRGBA(image.Rect(0, 0, w, h))
+	drawer := &font.Drawer{
+		Dst:  mark,
+		Src:  image.NewUniform(color.NRGBA{toByte(rgb[0]), toByte(rgb[1]), toByte(rgb[2]), 255}),
+		Face: face,
+		Dot:  fixed.Point26_6{X: 0, Y: metrics.Ascent},
+	}
+	drawer.DrawString(text)
+	return mark
+}
+
+func loadWatermarkFont(name string) (*opentype.Font, error) {
+	parsedFontsMu.Lock()
+	defer parsedFontsMu.Unlock()
+
+	if f, ok := parsedFonts[name]; ok {
+		return f, nil
+	}
+	data, ok := watermarkFonts[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown font %q", name)
+	}
+	f, err := opentype.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse font %q: %w", name, err)
+	}
+	parsedFonts[name] = f
+	return f, nil
+}
+
+// scaleToWidth resizes img to width pixels, keeping its aspect ratio
+func scaleToWidth(img image.Image, width int) *image.NRGBA {
+	bounds := img.Bounds()
+	if bounds.Dx() == 0 || bounds.Dy() == 0 {
+		return nil
+	}
+	height := max(1, int(math.Round(float64(bounds.Dy())*float64(width)/float64(bounds.Dx()))))
+	out := image.NewNRGBA(image.Rect(0, 0, width, height))
+	xdraw.CatmullRom.Scale(out, out.Rect, img, bounds, xdraw.Src, nil)
+	return out
+}
+
+// validateWatermarkParams checks a watermark effect's params without
+// loading its logo
+func validateWatermarkParams(params map[string]interface{}) error {
+	text, logo := paramString(params, "text", ""), paramString(params, "logo", "")
+	switch {
+	case (text == "") == (logo == ""):
+		return fmt.Errorf("watermark needs either text or logo")
+	case logo != "" && !primitive.IsValidObjectID(logo):
+		return fmt.Errorf("logo must be a media ID")
+	case utf8.RuneCountInString(text) > maxWatermarkText:
+		return fmt.Errorf("watermark text is limited to %d characters", maxWatermarkText)
+	}
+	if _, ok := watermarkAnchors[paramString(params, "anchor", "bottom-right")]; !ok {
+		return fmt.Errorf("unknown anchor %q", paramString(params, "anchor", ""))
+	}
+	if _, ok := watermarkFonts[paramString(params, "font", "bold")]; !ok {
+		return fmt.Errorf("unknown font %q", paramString(params, "font", ""))
+	}
+	if scale := paramFloat(params, "scale", 0.2); scale <= 0 || scale > 1 {
+		return fmt.Errorf("scale must be above 0 and at most 1")
+	}
+	for _, r := range []struct {
+		name   string
+		def    float64
+		lo, hi float64
+	}{
+		{"opacity", 0.5, 0, 1},
+		{"offsetX", 0.02, -1, 1},
+		{"offsetY", 0.02, -1, 1},
+		{"spacing", 0.1, 0, 1},
+	} {
+		if v := paramFloat(params, r.name, r.def); v < r.lo || v > r.hi {
+			return fmt.Errorf("%s must be between %g and %g", r.name, r.lo, r.hi)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,340 @@
+package services
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"mediaVault-backend/internal/models"
+)
+
+const (
+	rdfNamespace = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	crsNamespace = "http://ns.adobe.com/camera-raw-settings/1.0/"
+)
+
+// xmpPreset holds the camera raw settings of a Lightroom .xmp preset.
+// Settings are stored as attributes or child elements; lists (tone curves)
+// and language alternatives (names) as rdf:li items. Settings with any other
+// element content (looks, masks, retouch areas) are kept in structured by
+// the name they carry, if any.
+type xmpPreset struct {
+	values     map[string]string
+	lists      map[string][]string
+	structured map[string]string
+}
+
+// xmpMetadata are settings that describe the preset rather than the look
+var xmpMetadata = map[string]bool{
+	"Version": true, "ProcessVersion": true, "PresetType": true, "UUID": true, "Cluster": true,
+	"Name": true, "ShortName": true, "SortName": true, "Group": true, "Description": true,
+	"SupportsAmount": true, "SupportsAmount2": true, "SupportsColor": true, "SupportsMonochrome": true,
+	"SupportsHighDynamicRange": true, "SupportsNormalDynamicRange": true,
+	"SupportsSceneReferred": true, "SupportsOutputReferred": true,
+	"CameraModelRestrictive": true, "CopyrightRestrictive": true, "HasSettings": true,
+	"RequiresRGBTables": true, "ToneCurveName": true, "ToneCurveName2012": true,
+	"AlreadyApplied": true, "Copyright": true, "Contact": true,
+}
+
+// xmpDependents are settings that only matter when their master setting,
+// the key, isn't neutral
+var xmpDependents = map[string][]string{
+	"Sharpness":                      {"SharpenRadius", "SharpenDetail", "SharpenEdgeMasking"},
+	"LuminanceSmoothing":             {"LuminanceNoiseReductionDetail", "LuminanceNoiseReductionContrast"},
+	"ColorNoiseReduction":            {"ColorNoiseReductionDetail", "ColorNoiseReductionSmoothness"},
+	"GrainAmount":                    {"GrainSize", "GrainFrequency"},
+	"PostCropVignetteAmount":         {"PostCropVignetteMidpoint", "PostCropVignetteFeather", "PostCropVignetteRoundness", "PostCropVignetteStyle", "PostCropVignetteHighlightContrast"},
+	"SplitToningShadowSaturation":    {"SplitToningShadowHue"},
+	"SplitToningHighlightSaturation": {"SplitToningHighlightHue"},
+}
+
+// Lightroom HSL bands in mixer order
+var xmpHSLBands = map[string]string{
+	"Red": models.HSLReds, "Orange": models.HSLOranges, "Yellow": models.HSLYellows,
+	"Green": models.HSLGreens, "Aqua": models.HSLAquas, "Blue": models.HSLBlues,
+	"Purple": models.HSLPurples, "Magenta": models.HSLMagentas,
+}
+
+// parseXMPPreset reads the top-level camera raw settings of an XMP packet
+func parseXMPPreset(data []byte) (*xmpPreset, error) {
+	p := &xmpPreset{values: map[string]string{}, lists: map[string][]string{}, structured: map[string]string{}}
+	dec := xml.NewDecoder(bytes.NewReader(data))
+
+	var (
+		setting string // top-level crs element being read
+		inner   int    // elements open inside setting
+		inItem  bool
+		nested  bool   // setting has element content besides an rdf list
+		summary string // crs:Name found in that content
+		text    strings.Builder
+		found   bool
+	)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("malformed XMP: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch {
+			case setting != "":
+				inner++
+				switch {
+				case t.Name.Space == rdfNamespace && inner == 1 && (t.Name.Local == "Seq" || t.Name.Local == "Bag" || t.Name.Local == "Alt"):
+				case t.Name.Space == rdfNamespace && inner == 2 && t.Name.Local == "li":
+					inItem = true
+					text.Reset()
+				default:
+					nested = true
+					for _, attr := range t.Attr {
+						if attr.Name.Space == crsNamespace && attr.Name.Local == "Name" && summary == "" {
+							summary = attr.Value
+						}
+					}
+				}
+			case t.Name.Space == rdfNamespace && t.Name.Local == "Description":
+				for _, attr := range t.Attr {
+					if attr.Name.Space == crsNamespace {
+						p.values[attr.Name.Local] = attr.Value
+						found = true
+					}
+				}
+			case t.Name.Space == crsNamespace:
+				setting, inner, nested, summary = t.Name.Local, 0, false, ""
+				text.Reset()
+				found = true
+			}
+		case xml.CharData:
+			if setting != "" {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			switch {
+			case setting == "":
+			case inner > 0:
+				if inItem && inner == 2 && t.Name.Space == rdfNamespace && t.Name.Local == "li" {
+					p.lists[setting] = append(p.lists[setting], strings.TrimSpace(text.String()))
+					inItem = false
+					text.Reset()
+				}
+				inner--
+			default:
+				if nested {
+					delete(p.lists, setting)
+					if summary == "" {
+						summary = "structured value"
+					}
+					p.structured[setting] = summary
+				} else if _, isList := p.lists[setting]; !isList {
+					p.values[setting] = strings.TrimSpace(text.String())
+				}
+				setting = ""
+			}
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf("no camera raw settings found")
+	}
+	return p, nil
+}
+
+// name returns the preset's name, if it has one
+func (p *xmpPreset) name() string {
+	if items := p.lists["Name"]; len(items) > 0 && items[0] != "" {
+		return items[0]
+	}
+	return p.values["Name"]
+}
+
+// toFilterConfig maps the settings FilterConfig can express and returns the
+// rest, with their values, as unsupported
+func (p *xmpPreset) toFilterConfig() (models.FilterConfig, map[string]string) {
+	var config models.FilterConfig
+	unsupported := map[string]string{}
+	used := map[string]bool{}
+
+	number := func(key string) (float64, bool) {
+		raw, ok := p.values[key]
+		if !ok {
+			return 0, false
+		}
+		used[key] = true
+		v, err := strconv.ParseFloat(strings.TrimPrefix(raw, "+"), 64)
+		if err != nil {
+			unsupported[key] = raw
+			return 0, false
+		}
+		return v, v != 0
+	}
+	addEffect := func(effectType string, params map[string]interface{}) {
+		config.Effects = append(config.Effects, models.Effect{Type: effectType, Params: params})
+	}
+
+	// Exposure is in stops; brightness multiplies linearly
+	if v, ok := number("Exposure2012"); ok {
+		config.Brightness = floatPtr(math.Pow(2, v))
+	}
+	if v, ok := number("Contrast2012"); ok {
+		config.Contrast = floatPtr(1 + v/200)
+	}
+	if v, ok := number("Saturation"); ok {
+		config.Saturation = floatPtr(1 + v/100)
+	}
+	if v, ok := number("Vibrance"); ok {
+		addEffect("vibrance", map[string]interface{}{"amount": v / 100})
+	}
+	if v, ok := number("Clarity2012"); ok {
+		if v > 0 {
+			addEffect("clarity", map[string]interface{}{"strength": v / 100})
+		} else {
+			unsupported["Clarity2012"] = p.values["Clarity2012"]
+		}
+	}
+	if v, ok := number("PostCropVignetteAmount"); ok {
+		if v < 0 {
+			addEffect("vignette", map[string]interface{}{"intensity": -v / 100})
+		} else {
+			unsupported["PostCropVignetteAmount"] = p.values["PostCropVignetteAmount"]
+		}
+	}
+	if v, ok := number("GrainAmount"); ok {
+		addEffect("film_grain", map[string]interface{}{"amount": v / 100})
+	}
+	if strings.EqualFold(p.values["ConvertToGrayscale"], "true") {
+		config.Grayscale = floatPtr(1)
+	}
+	used["ConvertToGrayscale"] = true
+
+	for key, band := range xmpHSLBands {
+		var adj models.HSLAdjustment
+		set := false
+		for field, target := range map[string]**float64{"HueAdjustment": &adj.Hue, "SaturationAdjustment": &adj.Saturation, "LuminanceAdjustment": &adj.Luminance} {
+			if v, ok := number(field + key); ok {
+				*target = floatPtr(math.Max(-100, math.Min(100, v)))
+				set = true
+			}
+		}
+		if set {
+			if config.HSL == nil {
+				config.HSL = map[string]models.HSLAdjustment{}
+			}
+			config.HSL[band] = adj
+		}
+	}
+
+	var curves models.ToneCurves
+	hasCurve := false
+	for key, target := range map[string]*[]models.CurvePoint{
+		"ToneCurvePV2012": &curves.RGB, "ToneCurvePV2012Red": &curves.Red,
+		"ToneCurvePV2012Green": &curves.Green, "ToneCurvePV2012Blue": &curves.Blue,
+	} {
+		items, ok := p.lists[key]
+		if !ok {
+			continue
+		}
+		used[key] = true
+		points, err := parseXMPCurve(items)
+		if err != nil {
+			unsupported[key] = strings.Join(items, "; ")
+			continue
+		}
+		if points != nil {
+			*target = points
+			hasCurve = true
+		}
+	}
+	if hasCurve {
+		config.Curves = &curves
+	}
+
+	// Vignette and grain shape are approximated by the effects' defaults;
+	// other dependents are inert while their master setting is
+	for master, dependents := range xmpDependents {
+		if used[master] || xmpNeutral(p.values[master]) {
+			for _, key := range dependents {
+				used[key] = true
+			}
+		}
+	}
+
+	// Everything else is reported unless it's left at its neutral value
+	for key, raw := range p.values {
+		if used[key] || xmpMetadata[key] || xmpNeutral(raw) {
+			continue
+		}
+		unsupported[key] = raw
+	}
+	for key, items := range p.lists {
+		if used[key] || xmpMetadata[key] {
+			continue
+		}
+		if points, err := parseXMPCurve(items); err == nil && points == nil {
+			continue // a linear curve
+		}
+		unsupported[key] = strings.Join(items, "; ")
+	}
+	for key, summary := range p.structured {
+		if !xmpMetadata[key] {
+			unsupported[key] = summary
+		}
+	}
+	return config, unsupported
+}
+
+// parseXMPCurve reads "x, y" points. It returns nil for the identity curve.
+func parseXMPCurve(items []string) ([]models.CurvePoint, error) {
+	points := make([]models.CurvePoint, 0, len(items))
+	identity := true
+	for _, item := range items {
+		parts := strings.Split(item, ",")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("malformed curve point %q", item)
+		}
+		x, errX := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+		y, errY := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if errX != nil || errY != nil {
+			return nil, fmt.Errorf("malformed curve point %q", item)
+		}
+		points = append(points, models.CurvePoint{X: x, Y: y})
+		identity = identity && x == y
+	}
+	if identity {
+		return nil, nil
+	}
+	if err := validateCurve(points); err != nil {
+		return nil, err
+	}
+	return points, nil
+}
+
+// xmpNeutral reports whether a raw setting value leaves the image alone
+func xmpNeutral(raw string) bool {
+	switch strings.ToLower(raw) {
+	case "", "false", "as shot", "0", "+0", "-0", "0.00", "+0.00":
+		return true
+	}
+	if v, err := strconv.ParseFloat(strings.TrimPrefix(raw, "+"), 64); err == nil {
+		return v == 0
+	}
+	return false
+}
+
+// sortedKeys returns the keys of m in order, for stable reports
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
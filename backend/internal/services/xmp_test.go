@@ -0,0 +1,142 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"mediaVault-backend/internal/models"
+)
+
+// xmpPacket wraps camera raw settings in the envelope Lightroom writes
+func xmpPacket(attrs, elements string) string {
+	return `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about="" xmlns:crs="http://ns.adobe.com/camera-raw-settings/1.0/" ` + attrs + `>
+` + elements + `
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>`
+}
+
+func TestParseXMPPreset(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       string
+		wantErr    string
+		values     map[string]string
+		lists      map[string][]string
+		structured map[string]string
+	}{
+		{
+			name:   "attributes",
+			data:   xmpPacket(`crs:Exposure2012="+0.50" crs:Contrast2012="-10"`, ""),
+			values: map[string]string{"Exposure2012": "+0.50", "Contrast2012": "-10"},
+		},
+		{
+			name:   "element values",
+			data:   xmpPacket("", `<crs:Saturation> 20 </crs:Saturation><crs:ConvertToGrayscale>False</crs:ConvertToGrayscale>`),
+			values: map[string]string{"Saturation": "20", "ConvertToGrayscale": "False"},
+		},
+		{
+			name: "lists",
+			data: xmpPacket("", `<crs:Name><rdf:Alt><rdf:li xml:lang="x-default">Warm Fade</rdf:li></rdf:Alt></crs:Name>
+<crs:ToneCurvePV2012><rdf:Seq><rdf:li>0, 20</rdf:li><rdf:li>255, 240</rdf:li></rdf:Seq></crs:ToneCurvePV2012>`),
+			lists: map[string][]string{"Name": {"Warm Fade"}, "ToneCurvePV2012": {"0, 20", "255, 240"}},
+		},
+		{
+			name: "nested look",
+			data: xmpPacket(`crs:Vibrance="10"`, `<crs:Look>
+ <rdf:Description crs:Name="Adobe Vivid" crs:Amount="1" crs:Exposure2012="+3">
+  <crs:Parameters><rdf:Description crs:Saturation="40"/></crs:Parameters>
+ </rdf:Description>
+</crs:Look>`),
+			values:     map[string]string{"Vibrance": "10"},
+			structured: map[string]string{"Look": "Adobe Vivid"},
+		},
+		{
+			name:       "list of descriptions",
+			data:       xmpPacket("", `<crs:RetouchAreas><rdf:Seq><rdf:li><rdf:Description crs:SpotType="heal"/></rdf:li></rdf:Seq></crs:RetouchAreas>`),
+			structured: map[string]string{"RetouchAreas": "structured value"},
+		},
+		{name: "no settings", data: `<x:xmpmeta xmlns:x="adobe:ns:meta/"></x:xmpmeta>`, wantErr: "no camera raw settings"},
+		{name: "malformed", data: xmpPacket(`crs:Exposure2012="1"`, "<crs:Saturation>")[:120], wantErr: "malformed XMP"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := parseXMPPreset([]byte(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.values == nil {
+				tt.values = map[string]string{}
+			}
+			if tt.lists == nil {
+				tt.lists = map[string][]string{}
+			}
+			if tt.structured == nil {
+				tt.structured = map[string]string{}
+			}
+			if !reflect.DeepEqual(p.values, tt.values) {
+				t.Errorf("values = %v, want %v", p.values, tt.values)
+			}
+			if !reflect.DeepEqual(p.lists, tt.lists) {
+				t.Errorf("lists = %v, want %v", p.lists, tt.lists)
+			}
+			if !reflect.DeepEqual(p.structured, tt.structured) {
+				t.Errorf("structured = %v, want %v", p.structured, tt.structured)
+			}
+		})
+	}
+}
+
+func TestXMPToFilterConfig(t *testing.T) {
+	data := xmpPacket(
+		`crs:Version="15.0" crs:Exposure2012="+1.00" crs:Contrast2012="+0" crs:Vibrance="+25"
+		 crs:HueAdjustmentRed="-10" crs:SaturationAdjustmentBlue="150" crs:GrainAmount="0" crs:GrainSize="25"
+		 crs:PostCropVignetteAmount="+20" crs:Dehaze="15" crs:WhiteBalance="As Shot"`,
+		`<crs:Name><rdf:Alt><rdf:li xml:lang="x-default">Test</rdf:li></rdf:Alt></crs:Name>
+<crs:ToneCurvePV2012><rdf:Seq><rdf:li>0, 0</rdf:li><rdf:li>255, 255</rdf:li></rdf:Seq></crs:ToneCurvePV2012>
+<crs:ToneCurvePV2012Red><rdf:Seq><rdf:li>0, 10</rdf:li><rdf:li>255, 255</rdf:li></rdf:Seq></crs:ToneCurvePV2012Red>
+<crs:Look><rdf:Description crs:Name="Adobe Color"/></crs:Look>`)
+	p, err := parseXMPPreset([]byte(data))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if p.name() != "Test" {
+		t.Errorf("name = %q", p.name())
+	}
+
+	config, unsupported := p.toFilterConfig()
+	if config.Brightness == nil || *config.Brightness != 2 || config.Contrast != nil {
+		t.Errorf("brightness %v, contrast %v", config.Brightness, config.Contrast)
+	}
+	if len(config.Effects) != 1 || config.Effects[0].Type != "vibrance" || config.Effects[0].Params["amount"] != 0.25 {
+		t.Errorf("effects = %+v", config.Effects)
+	}
+	if reds := config.HSL[models.HSLReds]; reds.Hue == nil || *reds.Hue != -10 {
+		t.Errorf("reds = %+v", reds)
+	}
+	if blues := config.HSL[models.HSLBlues]; blues.Saturation == nil || *blues.Saturation != 100 {
+		t.Errorf("blues = %+v", blues)
+	}
+	if config.Curves == nil || config.Curves.RGB != nil || len(config.Curves.Red) != 2 {
+		t.Errorf("curves = %+v", config.Curves)
+	}
+
+	want := map[string]string{
+		"PostCropVignetteAmount": "+20", // only darkening vignettes map
+		"Dehaze":                 "15",
+		"Look":                   "Adobe Color",
+	}
+	if !reflect.DeepEqual(unsupported, want) {
+		t.Errorf("unsupported = %v, want %v", unsupported, want)
+	}
+}